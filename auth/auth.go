@@ -0,0 +1,82 @@
+// Package auth hashes passwords and creates the random tokens of sessions
+// and the API.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// MinPasswordLength is the minimum number of bytes of a password.
+	MinPasswordLength = 8
+	// maxPasswordLength is the number of bytes bcrypt looks at.
+	maxPasswordLength = 72
+)
+
+var (
+	ErrPasswordTooShort = fmt.Errorf("password must have at least %d characters", MinPasswordLength)
+	ErrPasswordTooLong  = fmt.Errorf("password must have at most %d bytes", maxPasswordLength)
+)
+
+// dummyHash is compared against when a user doesn't exist, so a login takes
+// the same time for known and unknown users.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("sparschwein"), bcrypt.DefaultCost)
+	return hash
+})
+
+// HashPassword returns the bcrypt hash of the password.
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	if len(password) > maxPasswordLength {
+		return "", ErrPasswordTooLong
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("generate hash: %w", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether the password matches the hash.
+func CheckPassword(hash string, password string) bool {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	return err == nil
+}
+
+// CheckUnknownUser takes as long as CheckPassword and always fails.
+func CheckUnknownUser(password string) bool {
+	_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+	return false
+}
+
+// NewToken returns a random token that can be sent in a cookie or header.
+func NewToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", fmt.Errorf("read random: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// HashToken returns the hash that is stored instead of the token. Tokens are
+// random, so a fast hash is enough.
+func HashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+// IsPasswordError reports whether the password was rejected by
+// HashPassword.
+func IsPasswordError(err error) bool {
+	return errors.Is(err, ErrPasswordTooShort) || errors.Is(err, ErrPasswordTooLong)
+}
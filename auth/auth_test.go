@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashPassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		err      error
+	}{
+		{
+			name:     "valid",
+			password: "correct horse battery staple",
+		},
+		{
+			name:     "too short",
+			password: "short",
+			err:      ErrPasswordTooShort,
+		},
+		{
+			name:     "too long",
+			password: strings.Repeat("a", 73),
+			err:      ErrPasswordTooLong,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := HashPassword(tt.password)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				assert.True(t, IsPasswordError(err))
+				return
+			}
+			require.NoError(t, err)
+			assert.NotEqual(t, tt.password, hash)
+			assert.True(t, CheckPassword(hash, tt.password))
+			assert.False(t, CheckPassword(hash, tt.password+"!"))
+		})
+	}
+}
+
+func TestCheckUnknownUser(t *testing.T) {
+	assert.False(t, CheckUnknownUser("sparschwein"))
+}
+
+func TestNewToken(t *testing.T) {
+	first, err := NewToken()
+	require.NoError(t, err)
+	second, err := NewToken()
+	require.NoError(t, err)
+
+	assert.Len(t, first, 43)
+	assert.NotEqual(t, first, second)
+	assert.Equal(t, HashToken(first), HashToken(first))
+	assert.NotEqual(t, HashToken(first), HashToken(second))
+	assert.Len(t, HashToken(first), 32)
+}
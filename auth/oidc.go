@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/Opsi/sparschwein/util"
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// ErrInvalidNonce is returned when the ID token wasn't issued for the login
+// of the browser.
+var ErrInvalidNonce = errors.New("invalid nonce")
+
+// OIDCConfig configures the login with an OpenID Connect issuer, e.g.
+// Authelia or Keycloak.
+type OIDCConfig struct {
+	// Issuer is the URL of the issuer. The login is disabled without one.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered at the issuer, e.g.
+	// https://sparschwein.example.com/login/oidc/callback.
+	RedirectURL string
+	// Scopes are requested separated by spaces. The groups claim may need
+	// a scope of its own.
+	Scopes string
+	// UsernameClaim names the claim that becomes the name of new users.
+	UsernameClaim string
+	// GroupsClaim names the claim listing the groups of the user.
+	GroupsClaim string
+	// GroupPrefix marks the groups that grant access to a household. The
+	// rest of the group is the name of the household.
+	GroupPrefix string
+	// DisplayName is shown on the login button.
+	DisplayName string
+}
+
+// AddOIDCFlags adds the OpenID Connect flags and returns the configuration
+// struct to be filled with the values from the flags.
+func AddOIDCFlags() *OIDCConfig {
+	config := &OIDCConfig{}
+
+	flag.StringVar(
+		&config.Issuer,
+		"oidc-issuer",
+		util.LookupStringEnv("OIDC_ISSUER", ""),
+		"URL of the OpenID Connect issuer (default: login with passwords only)")
+	flag.StringVar(
+		&config.ClientID,
+		"oidc-client-id",
+		util.LookupStringEnv("OIDC_CLIENT_ID", "sparschwein"),
+		"OpenID Connect client id (default: sparschwein)")
+	flag.StringVar(
+		&config.ClientSecret,
+		"oidc-client-secret",
+		util.LookupStringEnv("OIDC_CLIENT_SECRET", ""),
+		"OpenID Connect client secret")
+	flag.StringVar(
+		&config.RedirectURL,
+		"oidc-redirect-url",
+		util.LookupStringEnv("OIDC_REDIRECT_URL", "http://localhost:8080/login/oidc/callback"),
+		"callback URL registered at the issuer (default: http://localhost:8080/login/oidc/callback)")
+	flag.StringVar(
+		&config.Scopes,
+		"oidc-scopes",
+		util.LookupStringEnv("OIDC_SCOPES", "openid profile email groups"),
+		"scopes requested from the issuer (default: openid profile email groups)")
+	flag.StringVar(
+		&config.UsernameClaim,
+		"oidc-username-claim",
+		util.LookupStringEnv("OIDC_USERNAME_CLAIM", "preferred_username"),
+		"claim with the name of the user (default: preferred_username)")
+	flag.StringVar(
+		&config.GroupsClaim,
+		"oidc-groups-claim",
+		util.LookupStringEnv("OIDC_GROUPS_CLAIM", "groups"),
+		"claim with the groups of the user (default: groups)")
+	flag.StringVar(
+		&config.GroupPrefix,
+		"oidc-group-prefix",
+		util.LookupStringEnv("OIDC_GROUP_PREFIX", "sparschwein:"),
+		"prefix of the groups naming a household (default: sparschwein:)")
+	flag.StringVar(
+		&config.DisplayName,
+		"oidc-name",
+		util.LookupStringEnv("OIDC_NAME", "Single Sign-On"),
+		"name of the issuer on the login page (default: Single Sign-On)")
+
+	return config
+}
+
+// OIDCProvider logs users in with the authorization code flow and PKCE.
+type OIDCProvider struct {
+	config   OIDCConfig
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider discovers the endpoints of the issuer. It returns nil if
+// no issuer is configured.
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	if config.Issuer == "" {
+		return nil, nil
+	}
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover issuer: %w", err)
+	}
+	return &OIDCProvider{
+		config: config,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       strings.Fields(config.Scopes),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// DisplayName is the name of the issuer shown to users.
+func (p *OIDCProvider) DisplayName() string {
+	return p.config.DisplayName
+}
+
+// OIDCLogin is a login that was started in the browser but isn't finished
+// yet.
+type OIDCLogin struct {
+	State    string
+	Nonce    string
+	Verifier string
+}
+
+func NewOIDCLogin() (OIDCLogin, error) {
+	state, err := NewToken()
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	nonce, err := NewToken()
+	if err != nil {
+		return OIDCLogin{}, err
+	}
+	return OIDCLogin{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: oauth2.GenerateVerifier(),
+	}, nil
+}
+
+// AuthCodeURL is the page of the issuer the browser is sent to.
+func (p *OIDCProvider) AuthCodeURL(login OIDCLogin) string {
+	return p.oauth2.AuthCodeURL(login.State,
+		oidc.Nonce(login.Nonce),
+		oauth2.S256ChallengeOption(login.Verifier))
+}
+
+// OIDCIdentity is what the issuer told about the user.
+type OIDCIdentity struct {
+	// Subject identifies the user at the issuer. Unlike the username it
+	// never changes.
+	Subject  string
+	Username string
+	// Households are the names of the households the user may access.
+	// They are only known if HasGroups is true.
+	Households []string
+	HasGroups  bool
+}
+
+// Exchange redeems the code the issuer sent back to the callback and
+// verifies the ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, login OIDCLogin, code string) (*OIDCIdentity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("no id token returned")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id token: %w", err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(login.Nonce)) != 1 {
+		return nil, ErrInvalidNonce
+	}
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	return p.identity(idToken.Subject, claims), nil
+}
+
+func (p *OIDCProvider) identity(subject string, claims map[string]any) *OIDCIdentity {
+	identity := &OIDCIdentity{Subject: subject}
+	identity.Username, _ = claims[p.config.UsernameClaim].(string)
+	groups, ok := claims[p.config.GroupsClaim].([]any)
+	if !ok {
+		return identity
+	}
+	identity.HasGroups = true
+	for _, group := range groups {
+		name, ok := group.(string)
+		if !ok {
+			continue
+		}
+		if household, ok := strings.CutPrefix(name, p.config.GroupPrefix); ok && household != "" {
+			identity.Households = append(identity.Households, household)
+		}
+	}
+	return identity
+}
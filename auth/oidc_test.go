@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/Opsi/sparschwein/auth/oidctest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRedirectURL = "http://sparschwein.test/login/oidc/callback"
+
+func newTestProvider(t *testing.T) (*OIDCProvider, *oidctest.Issuer) {
+	t.Helper()
+	issuer, err := oidctest.NewIssuer("sparschwein")
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		Issuer:        issuer.URL(),
+		ClientID:      "sparschwein",
+		ClientSecret:  "secret",
+		RedirectURL:   testRedirectURL,
+		Scopes:        "openid profile groups",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupPrefix:   "sparschwein:",
+	})
+	require.NoError(t, err)
+	return provider, issuer
+}
+
+// authorize follows the browser to the issuer and returns the code it sends
+// back to the callback.
+func authorize(t *testing.T, provider *OIDCProvider, login OIDCLogin) string {
+	t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(provider.AuthCodeURL(login))
+	require.NoError(t, err)
+	defer response.Body.Close()
+	require.Equal(t, http.StatusFound, response.StatusCode)
+
+	callback, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(t, err)
+	assert.Equal(t, testRedirectURL, callback.Scheme+"://"+callback.Host+callback.Path)
+	assert.Equal(t, login.State, callback.Query().Get("state"))
+	return callback.Query().Get("code")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	issuer.SetClaims(map[string]any{
+		"sub":                "1234",
+		"preferred_username": "alice",
+		"groups":             []string{"admins", "sparschwein:Family", "sparschwein:Flat Share"},
+	})
+	login, err := NewOIDCLogin()
+	require.NoError(t, err)
+
+	code := authorize(t, provider, login)
+	identity, err := provider.Exchange(context.Background(), login, code)
+	require.NoError(t, err)
+	assert.Equal(t, &OIDCIdentity{
+		Subject:    "1234",
+		Username:   "alice",
+		Households: []string{"Family", "Flat Share"},
+		HasGroups:  true,
+	}, identity)
+
+	// codes can only be used once
+	_, err = provider.Exchange(context.Background(), login, code)
+	assert.Error(t, err)
+}
+
+func TestOIDCLoginWithWrongVerifier(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	issuer.SetClaims(map[string]any{"sub": "1234"})
+	login, err := NewOIDCLogin()
+	require.NoError(t, err)
+
+	code := authorize(t, provider, login)
+	other, err := NewOIDCLogin()
+	require.NoError(t, err)
+	login.Verifier = other.Verifier
+	_, err = provider.Exchange(context.Background(), login, code)
+	assert.Error(t, err)
+}
+
+func TestOIDCLoginWithWrongNonce(t *testing.T) {
+	provider, issuer := newTestProvider(t)
+	issuer.SetClaims(map[string]any{"sub": "1234"})
+	login, err := NewOIDCLogin()
+	require.NoError(t, err)
+
+	code := authorize(t, provider, login)
+	login.Nonce = "other"
+	_, err = provider.Exchange(context.Background(), login, code)
+	assert.ErrorIs(t, err, ErrInvalidNonce)
+}
+
+func TestOIDCIdentity(t *testing.T) {
+	provider := &OIDCProvider{config: OIDCConfig{
+		UsernameClaim: "email",
+		GroupsClaim:   "roles",
+		GroupPrefix:   "finance-",
+	}}
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   *OIDCIdentity
+	}{
+		{
+			name:   "no groups",
+			claims: map[string]any{"email": "alice@example.com"},
+			want:   &OIDCIdentity{Subject: "1", Username: "alice@example.com"},
+		},
+		{
+			name:   "empty groups",
+			claims: map[string]any{"roles": []any{}},
+			want:   &OIDCIdentity{Subject: "1", HasGroups: true},
+		},
+		{
+			name:   "prefix only",
+			claims: map[string]any{"roles": []any{"finance-", "finance-Family", 42}},
+			want:   &OIDCIdentity{Subject: "1", Households: []string{"Family"}, HasGroups: true},
+		},
+		{
+			name:   "groups not a list",
+			claims: map[string]any{"roles": "finance-Family"},
+			want:   &OIDCIdentity{Subject: "1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, provider.identity("1", tt.claims))
+		})
+	}
+}
+
+func TestNewOIDCProviderDisabled(t *testing.T) {
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{})
+	require.NoError(t, err)
+	assert.Nil(t, provider)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const usage = `usage: blz [flags] <file or URL>
+
+Converts the Bankleitzahlendatei of the Deutsche Bundesbank into the file
+embedded by the iban package. Download the current "Bankleitzahlendatei im
+TXT-Format" from
+https://www.bundesbank.de/de/aufgaben/unbarer-zahlungsverkehr/serviceangebot/bankleitzahlen/download-bankleitzahlen-602592
+or pass its URL. Only the main entry of every BLZ is kept.`
+
+const (
+	// lineLength is the length of a record without the line break.
+	lineLength = 174
+	// minBanks guards against converting an excerpt. The full file has
+	// about 3,000 main entries.
+	minBanks = 1000
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	out := flag.String("out", "iban/blz.txt", "file the main entries are written to")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		return fmt.Errorf("the Bankleitzahlendatei is required")
+	}
+
+	content, err := read(flag.Arg(0))
+	if err != nil {
+		return err
+	}
+	converted, banks, err := mainEntries(content)
+	if err != nil {
+		return err
+	}
+	if banks < minBanks {
+		return fmt.Errorf("only %d banks found, is %s the full file?", banks, flag.Arg(0))
+	}
+	if err := os.WriteFile(*out, converted, 0o644); err != nil {
+		return fmt.Errorf("write %s: %w", *out, err)
+	}
+	fmt.Printf("wrote %d banks to %s\n", banks, *out)
+	return nil
+}
+
+func read(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "https://") {
+		content, err := os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("read %s: %w", source, err)
+		}
+		return content, nil
+	}
+	client := &http.Client{Timeout: time.Minute}
+	response, err := client.Get(source)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", source, err)
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download %s: %s", source, response.Status)
+	}
+	content, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("download %s: %w", source, err)
+	}
+	return content, nil
+}
+
+// mainEntries keeps the records marked as main entry of their BLZ. The ISO
+// 8859-1 encoding is kept as it is.
+func mainEntries(content []byte) ([]byte, int, error) {
+	var converted bytes.Buffer
+	banks := 0
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for number := 1; scanner.Scan(); number++ {
+		line := bytes.TrimRight(scanner.Bytes(), "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) != lineLength {
+			return nil, 0, fmt.Errorf("line %d has %d instead of %d characters", number, len(line), lineLength)
+		}
+		// 1 marks the main entry, 2 a branch
+		if line[8] != '1' {
+			continue
+		}
+		converted.Write(line)
+		converted.WriteByte('\n')
+		banks++
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("read lines: %w", err)
+	}
+	return converted.Bytes(), banks, nil
+}
@@ -19,8 +19,11 @@ CREATE TABLE IF NOT EXISTS transactions (
     from_holder_id INT NOT NULL,
     to_holder_id INT NOT NULL,
     amount INT,
-    timestamp TIMESTAMP,
+    timestamp TIMESTAMPTZ,
+    booking_date DATE,
+    value_date DATE,
     data JSONB,
+    note TEXT NOT NULL DEFAULT '',
     parent_transaction_id INT,
     created_at TIMESTAMP DEFAULT NOW(),
     CONSTRAINT fk_from_holder FOREIGN KEY (from_holder_id)
@@ -62,3 +65,301 @@ CREATE TABLE IF NOT EXISTS transactions_tags (
         REFERENCES tags (id) ON DELETE CASCADE,
     CONSTRAINT pk_transactions_tags PRIMARY KEY (transaction_id, tag_id)
 );
+
+-- Migration: timestamps used to be stored without time zone as midnight of
+-- the value date. Interpret them as local time in Europe/Berlin and keep the
+-- booking and value date as plain dates.
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'transactions'
+        AND column_name = 'timestamp'
+        AND data_type = 'timestamp without time zone'
+    ) THEN
+        ALTER TABLE transactions
+            ALTER COLUMN timestamp TYPE TIMESTAMPTZ
+            USING timestamp AT TIME ZONE 'Europe/Berlin';
+    END IF;
+END $$;
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS booking_date DATE;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS value_date DATE;
+
+UPDATE transactions
+SET
+    booking_date = COALESCE(
+        booking_date,
+        (data ->> 'BookingDate')::TIMESTAMPTZ AT TIME ZONE 'UTC',
+        timestamp AT TIME ZONE 'Europe/Berlin'),
+    value_date = COALESCE(
+        value_date,
+        timestamp AT TIME ZONE 'Europe/Berlin')
+WHERE booking_date IS NULL OR value_date IS NULL;
+
+-- Table for rules that tag transactions automatically
+CREATE TABLE IF NOT EXISTS rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255),
+    tag_id INT NOT NULL,
+    conditions JSONB NOT NULL,
+    enabled BOOLEAN DEFAULT TRUE,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_rule_tag FOREIGN KEY (tag_id)
+        REFERENCES tags (id) ON DELETE CASCADE
+);
+
+-- Table for additional identifiers that resolve to a holder
+CREATE TABLE IF NOT EXISTS holder_aliases (
+    type VARCHAR(31) NOT NULL,
+    identifier VARCHAR(255) NOT NULL,
+    holder_id INT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT pk_holder_aliases PRIMARY KEY (type, identifier),
+    CONSTRAINT fk_alias_holder FOREIGN KEY (holder_id)
+        REFERENCES holders (id) ON DELETE CASCADE
+);
+
+-- Notes of transactions, e.g. of the parts of a split transaction
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS note TEXT NOT NULL DEFAULT '';
+
+-- Table for users of the web interface and the API
+CREATE TABLE IF NOT EXISTS users (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    password_hash VARCHAR(255) NOT NULL,
+    admin BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Table for login sessions. Only the SHA-256 hash of the cookie is stored.
+CREATE TABLE IF NOT EXISTS sessions (
+    token_hash BYTEA PRIMARY KEY,
+    user_id INT NOT NULL,
+    csrf_token VARCHAR(63) NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_session_user FOREIGN KEY (user_id)
+        REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Table for tokens of the JSON API. Only the SHA-256 hash of the token is
+-- stored.
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    token_hash BYTEA NOT NULL UNIQUE,
+    last_used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_api_token_user FOREIGN KEY (user_id)
+        REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Table for households. Holders, transactions, tags and rules belong to a
+-- household and are only visible to its members.
+CREATE TABLE IF NOT EXISTS households (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT NOW()
+);
+
+-- Many-to-many relation table between households and users
+CREATE TABLE IF NOT EXISTS household_members (
+    household_id INT NOT NULL,
+    user_id INT NOT NULL,
+    CONSTRAINT pk_household_members PRIMARY KEY (household_id, user_id),
+    CONSTRAINT fk_member_household FOREIGN KEY (household_id)
+        REFERENCES households (id) ON DELETE CASCADE,
+    CONSTRAINT fk_member_user FOREIGN KEY (user_id)
+        REFERENCES users (id) ON DELETE CASCADE
+);
+
+-- Migration: everything created before households existed moves to a
+-- default household and all existing users become its members. Identifiers
+-- and tag names only need to be unique inside a household. Transactions and
+-- rules can only reference holders and tags of their own household.
+DO $$
+DECLARE
+    default_household_id INT;
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema()
+        AND table_name = 'holders'
+        AND column_name = 'household_id'
+    ) THEN
+        SELECT MIN(id) INTO default_household_id FROM households;
+        IF default_household_id IS NULL THEN
+            INSERT INTO households (name) VALUES ('Default')
+                RETURNING id INTO default_household_id;
+        END IF;
+        INSERT INTO household_members (household_id, user_id)
+            SELECT default_household_id, id FROM users
+            ON CONFLICT DO NOTHING;
+
+        ALTER TABLE holders ADD COLUMN household_id INT;
+        UPDATE holders SET household_id = default_household_id;
+        ALTER TABLE holders
+            ALTER COLUMN household_id SET NOT NULL,
+            DROP CONSTRAINT unique_type_identifier,
+            ADD CONSTRAINT unique_household_type_identifier
+                UNIQUE (household_id, type, identifier),
+            ADD CONSTRAINT unique_holder_household UNIQUE (household_id, id),
+            ADD CONSTRAINT fk_holder_household FOREIGN KEY (household_id)
+                REFERENCES households (id) ON DELETE CASCADE;
+
+        ALTER TABLE transactions ADD COLUMN household_id INT;
+        UPDATE transactions SET household_id = default_household_id;
+        ALTER TABLE transactions
+            ALTER COLUMN household_id SET NOT NULL,
+            DROP CONSTRAINT fk_from_holder,
+            DROP CONSTRAINT fk_to_holder,
+            ADD CONSTRAINT fk_transaction_from_holder FOREIGN KEY (household_id, from_holder_id)
+                REFERENCES holders (household_id, id) ON DELETE CASCADE,
+            ADD CONSTRAINT fk_transaction_to_holder FOREIGN KEY (household_id, to_holder_id)
+                REFERENCES holders (household_id, id) ON DELETE CASCADE;
+
+        ALTER TABLE tags ADD COLUMN household_id INT;
+        UPDATE tags SET household_id = default_household_id;
+        ALTER TABLE tags
+            ALTER COLUMN household_id SET NOT NULL,
+            ADD CONSTRAINT unique_tag_household UNIQUE (household_id, id),
+            ADD CONSTRAINT fk_tag_household FOREIGN KEY (household_id)
+                REFERENCES households (id) ON DELETE CASCADE;
+
+        ALTER TABLE rules ADD COLUMN household_id INT;
+        UPDATE rules SET household_id = default_household_id;
+        ALTER TABLE rules
+            ALTER COLUMN household_id SET NOT NULL,
+            DROP CONSTRAINT fk_rule_tag,
+            ADD CONSTRAINT fk_rule_household_tag FOREIGN KEY (household_id, tag_id)
+                REFERENCES tags (household_id, id) ON DELETE CASCADE;
+
+        ALTER TABLE holder_aliases ADD COLUMN household_id INT;
+        UPDATE holder_aliases SET household_id = default_household_id;
+        ALTER TABLE holder_aliases
+            ALTER COLUMN household_id SET NOT NULL,
+            DROP CONSTRAINT pk_holder_aliases,
+            DROP CONSTRAINT fk_alias_holder,
+            ADD CONSTRAINT pk_household_holder_aliases PRIMARY KEY (household_id, type, identifier),
+            ADD CONSTRAINT fk_alias_household_holder FOREIGN KEY (household_id, holder_id)
+                REFERENCES holders (household_id, id) ON DELETE CASCADE;
+
+        -- the household a session is looking at
+        ALTER TABLE sessions ADD COLUMN household_id INT;
+        UPDATE sessions SET household_id = default_household_id;
+        ALTER TABLE sessions
+            ALTER COLUMN household_id SET NOT NULL,
+            ADD CONSTRAINT fk_session_household FOREIGN KEY (household_id)
+                REFERENCES households (id) ON DELETE CASCADE;
+
+        ALTER TABLE api_tokens ADD COLUMN household_id INT;
+        UPDATE api_tokens SET household_id = default_household_id;
+        ALTER TABLE api_tokens
+            ALTER COLUMN household_id SET NOT NULL,
+            ADD CONSTRAINT fk_api_token_household FOREIGN KEY (household_id)
+                REFERENCES households (id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+-- Tag names are unique among their siblings
+DROP INDEX IF EXISTS unique_tag_parent_name;
+CREATE UNIQUE INDEX IF NOT EXISTS unique_household_tag_parent_name
+    ON tags (household_id, COALESCE(parent_tag_id, 0), name);
+
+-- Users logging in with OpenID Connect are identified by the subject the
+-- issuer gave them. Their password hash stays empty.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS oidc_subject VARCHAR(255) UNIQUE;
+
+-- OIDC groups name households, so the names have to be unique. Households
+-- that share a name get their id appended before the index is created.
+UPDATE households SET name = households.name || ' (' || households.id || ')'
+    FROM households other
+    WHERE other.name = households.name AND other.id < households.id;
+CREATE UNIQUE INDEX IF NOT EXISTS unique_household_name ON households (name);
+
+-- Migration: parents and tags have to belong to the household of the row
+-- referencing them. Composite foreign keys enforce it in the database. Links
+-- across households were never allowed, so any left over are dropped first.
+-- Setting only the parent column to NULL needs Postgres 15 or newer.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.table_constraints
+        WHERE table_schema = current_schema()
+        AND constraint_name = 'fk_holder_household_parent'
+    ) THEN
+        UPDATE holders SET parent_holder_id = NULL
+            FROM holders parent
+            WHERE parent.id = holders.parent_holder_id
+            AND parent.household_id <> holders.household_id;
+        ALTER TABLE holders
+            DROP CONSTRAINT fk_parent_holder,
+            ADD CONSTRAINT fk_holder_household_parent FOREIGN KEY (household_id, parent_holder_id)
+                REFERENCES holders (household_id, id) ON DELETE SET NULL (parent_holder_id);
+
+        UPDATE tags SET parent_tag_id = NULL
+            FROM tags parent
+            WHERE parent.id = tags.parent_tag_id
+            AND parent.household_id <> tags.household_id;
+        ALTER TABLE tags
+            DROP CONSTRAINT fk_parent_tag,
+            ADD CONSTRAINT fk_tag_household_parent FOREIGN KEY (household_id, parent_tag_id)
+                REFERENCES tags (household_id, id) ON DELETE SET NULL (parent_tag_id);
+
+        UPDATE transactions SET parent_transaction_id = NULL
+            FROM transactions parent
+            WHERE parent.id = transactions.parent_transaction_id
+            AND parent.household_id <> transactions.household_id;
+        ALTER TABLE transactions
+            ADD CONSTRAINT unique_transaction_household UNIQUE (household_id, id);
+        ALTER TABLE transactions
+            DROP CONSTRAINT fk_parent_transaction,
+            ADD CONSTRAINT fk_transaction_household_parent FOREIGN KEY (household_id, parent_transaction_id)
+                REFERENCES transactions (household_id, id) ON DELETE SET NULL (parent_transaction_id);
+
+        ALTER TABLE holders_tags ADD COLUMN household_id INT;
+        UPDATE holders_tags SET household_id = holders.household_id
+            FROM holders
+            WHERE holders.id = holders_tags.holder_id;
+        DELETE FROM holders_tags
+            USING tags
+            WHERE tags.id = holders_tags.tag_id
+            AND tags.household_id <> holders_tags.household_id;
+        ALTER TABLE holders_tags
+            ALTER COLUMN household_id SET NOT NULL,
+            DROP CONSTRAINT fk_holder,
+            DROP CONSTRAINT fk_tag,
+            ADD CONSTRAINT fk_holder_tag_household_holder FOREIGN KEY (household_id, holder_id)
+                REFERENCES holders (household_id, id) ON DELETE CASCADE,
+            ADD CONSTRAINT fk_holder_tag_household_tag FOREIGN KEY (household_id, tag_id)
+                REFERENCES tags (household_id, id) ON DELETE CASCADE;
+
+        ALTER TABLE transactions_tags ADD COLUMN household_id INT;
+        UPDATE transactions_tags SET household_id = transactions.household_id
+            FROM transactions
+            WHERE transactions.id = transactions_tags.transaction_id;
+        DELETE FROM transactions_tags
+            USING tags
+            WHERE tags.id = transactions_tags.tag_id
+            AND tags.household_id <> transactions_tags.household_id;
+        ALTER TABLE transactions_tags
+            ALTER COLUMN household_id SET NOT NULL,
+            DROP CONSTRAINT fk_transaction,
+            DROP CONSTRAINT fk_tag_transaction,
+            ADD CONSTRAINT fk_transaction_tag_household_transaction FOREIGN KEY (household_id, transaction_id)
+                REFERENCES transactions (household_id, id) ON DELETE CASCADE,
+            ADD CONSTRAINT fk_transaction_tag_household_tag FOREIGN KEY (household_id, tag_id)
+                REFERENCES tags (household_id, id) ON DELETE CASCADE;
+    END IF;
+END $$;
+
+-- The server is only ready if the database has the schema it was built for.
+-- Bump the version together with db.SchemaVersion.
+CREATE TABLE IF NOT EXISTS schema_version (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    version INT NOT NULL
+);
+INSERT INTO schema_version (version) VALUES (3)
+    ON CONFLICT (id) DO UPDATE SET version = EXCLUDED.version;
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload/dkb"
+	"github.com/Opsi/sparschwein/upload/normalize"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: holders [flags] <command>
+
+commands:
+  list                                   list all holders
+  tree <holder id>                       list a holder and its descendants
+  parent <holder id> <parent id|none>    put a holder below another one
+  aliases <holder id>                    list the aliases of a holder
+  alias <holder id> <type> <identifier>  resolve the identifier to the holder
+  unalias <type> <identifier>            remove an alias
+  merge <from id> <into id>              merge a holder into another one
+  rekey-dkb                              identify DKB counterparties by creditor id or IBAN`
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("load .env: %w", err)
+	}
+
+	// flags
+	logConfig := util.AddLogFlags()
+	dbConfig := db.AddFlags()
+	householdID := db.AddHouseholdFlag()
+	var (
+		dry            = flag.Bool("dry", false, "only print what rekey-dkb would do")
+		normalizerPath = flag.String(
+			"normalizer-config",
+			"",
+			"json file configuring how counterparty names are cleaned up (default: built-in rules)")
+	)
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := logConfig.InitSlogDefault(); err != nil {
+		return fmt.Errorf("init slog: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return fmt.Errorf("command is required")
+	}
+
+	// connect to db
+	dbConn, err := dbConfig.OpenPingedConnection()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer dbConn.Close()
+
+	args := flag.Args()
+	switch args[0] {
+	case "list":
+		return list(ctx, dbConn, *householdID)
+	case "tree":
+		if len(args) != 2 {
+			return fmt.Errorf("tree needs a holder id")
+		}
+		holderID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse holder id: %w", err)
+		}
+		return tree(ctx, dbConn, *householdID, holderID)
+	case "parent":
+		if len(args) != 3 {
+			return fmt.Errorf("parent needs a holder id and a parent id")
+		}
+		holderID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse holder id: %w", err)
+		}
+		var parentID *int
+		if args[2] != "none" {
+			id, err := strconv.Atoi(args[2])
+			if err != nil {
+				return fmt.Errorf("parse parent id: %w", err)
+			}
+			parentID = &id
+		}
+		return db.SetHolderParent(ctx, dbConn, *householdID, holderID, parentID)
+	case "aliases":
+		if len(args) != 2 {
+			return fmt.Errorf("aliases needs a holder id")
+		}
+		holderID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse holder id: %w", err)
+		}
+		return aliases(ctx, dbConn, *householdID, holderID)
+	case "alias":
+		if len(args) != 4 {
+			return fmt.Errorf("alias needs a holder id, a type and an identifier")
+		}
+		holderID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse holder id: %w", err)
+		}
+		return db.AddHolderAlias(ctx, dbConn, *householdID, db.HolderIdentifier{
+			Type:       args[2],
+			Identifier: args[3],
+		}, holderID)
+	case "unalias":
+		if len(args) != 3 {
+			return fmt.Errorf("unalias needs a type and an identifier")
+		}
+		return db.DeleteHolderAlias(ctx, dbConn, *householdID, db.HolderIdentifier{
+			Type:       args[1],
+			Identifier: args[2],
+		})
+	case "merge":
+		if len(args) != 3 {
+			return fmt.Errorf("merge needs the id of the holder to merge and the id of the holder to merge into")
+		}
+		fromID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse from id: %w", err)
+		}
+		intoID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("parse into id: %w", err)
+		}
+		return merge(ctx, dbConn, *householdID, fromID, intoID)
+	case "rekey-dkb":
+		normalizerConfig := normalize.DefaultConfig()
+		if *normalizerPath != "" {
+			normalizerConfig, err = normalize.ReadConfig(*normalizerPath)
+			if err != nil {
+				return fmt.Errorf("read normalizer config: %w", err)
+			}
+		}
+		normalizer, err := normalize.New(normalizerConfig)
+		if err != nil {
+			return fmt.Errorf("new normalizer: %w", err)
+		}
+		return rekeyDKB(ctx, dbConn, *householdID, normalizer, *dry)
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+func list(ctx context.Context, dbConn *sqlx.DB, householdID int) error {
+	holders, err := db.GetHolders(ctx, dbConn, householdID)
+	if err != nil {
+		return fmt.Errorf("get holders: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tType\tIdentifier\tName")
+	for _, holder := range holders {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n",
+			holder.ID, holder.Type, holder.Identifier, holder.Name)
+	}
+	return w.Flush()
+}
+
+func tree(ctx context.Context, dbConn *sqlx.DB, householdID, holderID int) error {
+	holders, err := db.GetHolderSubtree(ctx, dbConn, householdID, holderID)
+	if err != nil {
+		return fmt.Errorf("get holder subtree: %w", err)
+	}
+	children := make(map[int][]db.Holder)
+	for _, holder := range holders {
+		if holder.ParentHolderID != nil && holder.ID != holderID {
+			children[*holder.ParentHolderID] = append(children[*holder.ParentHolderID], holder)
+		}
+	}
+	var printHolder func(holder db.Holder, depth int)
+	printHolder = func(holder db.Holder, depth int) {
+		fmt.Printf("%s%d %s\n", strings.Repeat("  ", depth), holder.ID, holder.Name)
+		for _, child := range children[holder.ID] {
+			printHolder(child, depth+1)
+		}
+	}
+	for _, holder := range holders {
+		if holder.ID == holderID {
+			printHolder(holder, 0)
+		}
+	}
+	return nil
+}
+
+func aliases(ctx context.Context, dbConn *sqlx.DB, householdID, holderID int) error {
+	holderAliases, err := db.GetHolderAliases(ctx, dbConn, householdID, holderID)
+	if err != nil {
+		return fmt.Errorf("get holder aliases: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "Type\tIdentifier")
+	for _, alias := range holderAliases {
+		fmt.Fprintf(w, "%s\t%s\n", alias.Type, alias.Identifier)
+	}
+	return w.Flush()
+}
+
+func merge(ctx context.Context, dbConn *sqlx.DB, householdID, fromID, intoID int) error {
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := db.MergeHolders(ctx, tx, householdID, fromID, intoID); err != nil {
+		return fmt.Errorf("merge holders: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	slog.Info("merged holders", slog.Int("from", fromID), slog.Int("into", intoID))
+	return nil
+}
+
+func rekeyDKB(ctx context.Context, dbConn *sqlx.DB, householdID int, normalizer *normalize.Normalizer, dry bool) error {
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	rekeys, err := dkb.RekeyHolders(ctx, tx, householdID, normalizer)
+	if err != nil {
+		return fmt.Errorf("rekey holders: %w", err)
+	}
+	for _, rekey := range rekeys {
+		slog.Info("rekey", slog.Any("rekey", rekey))
+	}
+	if dry {
+		return nil
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
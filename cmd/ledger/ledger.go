@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("load .env: %w", err)
+	}
+
+	// flags
+	logConfig := util.AddLogFlags()
+	dbConfig := db.AddFlags()
+	householdID := db.AddHouseholdFlag()
+	var (
+		holderID  = flag.Int("holder", 0, "id of the holder to show the transactions of")
+		direction = flag.String("direction", "", "only show incoming (in), outgoing (out) or internal transactions")
+		fromDate  = flag.String("from", "", "first day to show (YYYY-MM-DD)")
+		toDate    = flag.String("to", "", "first day not to show anymore (YYYY-MM-DD)")
+		subtree   = flag.Bool("subtree", false, "include the descendants of the holder")
+		report    = flag.String("report", "transactions", "what to show (transactions, cashflow or balances)")
+	)
+	flag.Parse()
+
+	if err := logConfig.InitSlogDefault(); err != nil {
+		return fmt.Errorf("init slog: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	// validate flags
+	if *holderID == 0 {
+		return fmt.Errorf("holder is required")
+	}
+	loc, err := dbConfig.Location()
+	if err != nil {
+		return fmt.Errorf("location: %w", err)
+	}
+	filter := db.HolderTransactionFilter{
+		Direction: db.Direction(*direction),
+	}
+	if *fromDate != "" {
+		from, err := time.ParseInLocation(time.DateOnly, *fromDate, loc)
+		if err != nil {
+			return fmt.Errorf("parse from: %w", err)
+		}
+		filter.From = &from
+	}
+	if *toDate != "" {
+		to, err := time.ParseInLocation(time.DateOnly, *toDate, loc)
+		if err != nil {
+			return fmt.Errorf("parse to: %w", err)
+		}
+		filter.To = &to
+	}
+
+	// connect to db
+	dbConn, err := dbConfig.OpenPingedConnection()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer dbConn.Close()
+
+	switch *report {
+	case "transactions":
+		return printTransactions(ctx, dbConn, *householdID, *holderID, *subtree, filter)
+	case "cashflow":
+		return printCashFlow(ctx, dbConn, *householdID, *holderID, filter)
+	case "balances":
+		return printBalances(ctx, dbConn, *householdID, *holderID)
+	default:
+		return fmt.Errorf("unknown report: %s", *report)
+	}
+}
+
+func printTransactions(ctx context.Context,
+	dbConn *sqlx.DB,
+	householdID int,
+	holderID int,
+	subtree bool,
+	filter db.HolderTransactionFilter) error {
+	var transactions []db.HolderTransaction
+	var err error
+	if subtree {
+		transactions, err = db.GetSubtreeTransactions(ctx, dbConn, householdID, holderID, filter)
+	} else {
+		transactions, err = db.GetHolderTransactions(ctx, dbConn, householdID, holderID, filter)
+	}
+	if err != nil {
+		return fmt.Errorf("get transactions: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ID\tDate\tDirection\tCounterparty\tAmount\t")
+	total := 0
+	for _, t := range transactions {
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t\n",
+			t.ID,
+			t.Timestamp.Format("02.01.2006"),
+			t.Direction,
+			t.Counterparty.Name,
+			util.FormatCents(t.SignedAmountInCents))
+		// internal transfers don't change the total of the subtree
+		if t.Direction != db.DirectionInternal {
+			total += t.SignedAmountInCents
+		}
+	}
+	fmt.Fprintf(w, "\t\t\tTotal\t%s\t\n", util.FormatCents(total))
+	return w.Flush()
+}
+
+func printCashFlow(ctx context.Context,
+	dbConn *sqlx.DB,
+	householdID int,
+	holderID int,
+	filter db.HolderTransactionFilter) error {
+	cashFlows, err := db.GetSubtreeCashFlow(ctx, dbConn, householdID, holderID, filter.From, filter.To)
+	if err != nil {
+		return fmt.Errorf("get cash flow: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "Month\tIncome\tExpenses\tNet\tInternal\t")
+	for _, cashFlow := range cashFlows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n",
+			cashFlow.Month.Format("01/2006"),
+			util.FormatCents(cashFlow.IncomeInCents),
+			util.FormatCents(cashFlow.ExpensesInCents),
+			util.FormatCents(cashFlow.IncomeInCents-cashFlow.ExpensesInCents),
+			util.FormatCents(cashFlow.InternalInCents))
+	}
+	return w.Flush()
+}
+
+func printBalances(ctx context.Context, dbConn *sqlx.DB, householdID, holderID int) error {
+	balances, err := db.GetSubtreeBalances(ctx, dbConn, householdID, holderID)
+	if err != nil {
+		return fmt.Errorf("get balances: %w", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "ID\tHolder\tBalance\t")
+	total := 0
+	for _, balance := range balances {
+		fmt.Fprintf(w, "%d\t%s\t%s\t\n",
+			balance.HolderID,
+			balance.Name,
+			util.FormatCents(balance.BalanceInCents))
+		total += balance.BalanceInCents
+	}
+	fmt.Fprintf(w, "\tTotal\t%s\t\n", util.FormatCents(total))
+	return w.Flush()
+}
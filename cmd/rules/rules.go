@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/rules"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/joho/godotenv"
+)
+
+const usage = `usage: rules [flags] <command>
+
+commands:
+  list                           list all rules
+  add <name> <tag id> <json>     add a rule with a JSON array of conditions
+  delete <rule id>               delete a rule
+  apply                          apply the enabled rules to all stored transactions`
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("load .env: %w", err)
+	}
+
+	// flags
+	logConfig := util.AddLogFlags()
+	dbConfig := db.AddFlags()
+	householdID := db.AddHouseholdFlag()
+	dry := flag.Bool("dry", false, "only print the hits of apply without tagging the transactions")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := logConfig.InitSlogDefault(); err != nil {
+		return fmt.Errorf("init slog: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return fmt.Errorf("command is required")
+	}
+
+	// connect to db
+	dbConn, err := dbConfig.OpenPingedConnection()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer dbConn.Close()
+
+	args := flag.Args()
+	switch args[0] {
+	case "list":
+		return list(ctx, dbConn, *householdID)
+	case "add":
+		if len(args) != 4 {
+			return fmt.Errorf("add needs a name, a tag id and the conditions")
+		}
+		tagID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return fmt.Errorf("parse tag id: %w", err)
+		}
+		return add(ctx, dbConn, *householdID, args[1], tagID, args[3])
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("delete needs a rule id")
+		}
+		ruleID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse rule id: %w", err)
+		}
+		return db.DeleteRule(ctx, dbConn, *householdID, ruleID)
+	case "apply":
+		return apply(ctx, dbConn, *householdID, !*dry)
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+func list(ctx context.Context, dbConn *sqlx.DB, householdID int) error {
+	dbRules, err := db.GetRules(ctx, dbConn, householdID)
+	if err != nil {
+		return fmt.Errorf("get rules: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tTag\tEnabled\tConditions")
+	for _, rule := range dbRules {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%t\t%s\n",
+			rule.ID, rule.Name, rule.TagID, rule.Enabled, rule.Conditions)
+	}
+	return w.Flush()
+}
+
+func add(ctx context.Context, dbConn *sqlx.DB, householdID int, name string, tagID int, conditions string) error {
+	createRule := db.CreateRule{
+		Name:       name,
+		TagID:      tagID,
+		Conditions: types.JSONText(conditions),
+		Enabled:    true,
+	}
+	// make sure the rule compiles before storing it
+	if _, err := rules.Compile(db.Rule{CreateRule: createRule}); err != nil {
+		return fmt.Errorf("compile rule: %w", err)
+	}
+	rule, err := db.InsertRule(ctx, dbConn, householdID, createRule)
+	if err != nil {
+		return fmt.Errorf("insert rule: %w", err)
+	}
+	slog.Info("added rule", slog.Int("id", rule.ID))
+	return nil
+}
+
+func apply(ctx context.Context, dbConn *sqlx.DB, householdID int, tag bool) error {
+	dbRules, err := db.GetRules(ctx, dbConn, householdID)
+	if err != nil {
+		return fmt.Errorf("get rules: %w", err)
+	}
+	compiledRules, err := rules.CompileEnabled(dbRules)
+	if err != nil {
+		return fmt.Errorf("compile rules: %w", err)
+	}
+
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	hits, err := rules.ApplyToExisting(ctx, tx, householdID, compiledRules, tag)
+	if err != nil {
+		return fmt.Errorf("apply rules: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return json.NewEncoder(os.Stdout).Encode(hits)
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/Opsi/sparschwein/auth"
 	"github.com/Opsi/sparschwein/db"
 	"github.com/Opsi/sparschwein/server"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/Opsi/sparschwein/upload/dkb"
+	"github.com/Opsi/sparschwein/upload/normalize"
 	"github.com/Opsi/sparschwein/util"
 	"github.com/joho/godotenv"
 )
@@ -26,16 +33,64 @@ func run() error {
 	// init and parse flags
 	logConfig := util.AddLogFlags()
 	dbConfig := db.AddFlags()
+	oidcConfig := auth.AddOIDCFlags()
+	listenConfig := server.AddListenFlags()
+	normalizerPath := flag.String(
+		"normalizer-config",
+		"",
+		"json file configuring how counterparty names of uploads are cleaned up (default: built-in rules)")
+	dev := flag.Bool(
+		"dev",
+		false,
+		"reload templates and static files from server/ on every request, needs the repository root as working directory")
 	flag.Parse()
 
 	if err := logConfig.InitSlogDefault(); err != nil {
 		return fmt.Errorf("init slog: %w", err)
 	}
 
+	loc, err := dbConfig.Location()
+	if err != nil {
+		return fmt.Errorf("location: %w", err)
+	}
+
+	normalizerConfig := normalize.DefaultConfig()
+	if *normalizerPath != "" {
+		normalizerConfig, err = normalize.ReadConfig(*normalizerPath)
+		if err != nil {
+			return fmt.Errorf("read normalizer config: %w", err)
+		}
+	}
+	normalizer, err := normalize.New(normalizerConfig)
+	if err != nil {
+		return fmt.Errorf("new normalizer: %w", err)
+	}
+	uploads := &upload.Service{
+		Parsers:    map[string]upload.Parser{"dkb": dkb.ParseCSV},
+		Location:   loc,
+		Normalizer: normalizer,
+	}
+
+	// the server drains its requests when it's stopped
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	oidc, err := auth.NewOIDCProvider(ctx, *oidcConfig)
+	if err != nil {
+		return fmt.Errorf("new oidc provider: %w", err)
+	}
+
 	dbConn, err := dbConfig.OpenPingedConnection()
 	if err != nil {
 		return fmt.Errorf("open db connection: %w", err)
 	}
+	defer dbConn.Close()
 
-	return server.ListenAndServe(dbConn)
+	return server.ListenAndServe(ctx, dbConn, server.Config{
+		Location: loc,
+		Uploads:  uploads,
+		OIDC:     oidc,
+		Listen:   *listenConfig,
+		Dev:      *dev,
+	})
 }
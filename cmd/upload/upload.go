@@ -12,8 +12,8 @@ import (
 	"github.com/Opsi/sparschwein/db"
 	"github.com/Opsi/sparschwein/upload"
 	"github.com/Opsi/sparschwein/upload/dkb"
+	"github.com/Opsi/sparschwein/upload/normalize"
 	"github.com/Opsi/sparschwein/util"
-	"github.com/jmoiron/sqlx"
 	"github.com/joho/godotenv"
 )
 
@@ -32,6 +32,7 @@ func run() error {
 	// flags
 	logConfig := util.AddLogFlags()
 	dbConfig := db.AddFlags()
+	householdID := db.AddHouseholdFlag()
 	var (
 		formatString = flag.String("format", "dkb", "what format the csv file is in")
 		filePath     = flag.String("file", "", "path to the csv file")
@@ -39,12 +40,23 @@ func run() error {
 			"dry-file",
 			"",
 			"dry run the script and save the transactions and holders that would be created to the json file")
+		ownerID = flag.Int(
+			"owner",
+			0,
+			"id of the holder that becomes the parent of newly created account holders")
+		normalizerPath = flag.String(
+			"normalizer-config",
+			"",
+			"json file configuring how counterparty names are cleaned up (default: built-in rules)")
 	)
 	flag.Parse()
 	slog.Info("flags", slog.Group("flags",
 		slog.String("format", *formatString),
 		slog.String("file", *filePath),
 		slog.String("dry-file", *dryFilePath),
+		slog.String("normalizer-config", *normalizerPath),
+		slog.Int("owner", *ownerID),
+		slog.Int("household", *householdID),
 	))
 
 	if err := logConfig.InitSlogDefault(); err != nil {
@@ -65,16 +77,30 @@ func run() error {
 		return fmt.Errorf("read csv file: %w", err)
 	}
 
-	var creators []upload.TransactionCreator
-	switch *formatString {
-	case "dkb":
-		creators, err = dkb.ParseCSV(csvFile)
-	default:
-		return fmt.Errorf("unknown format: %s", *formatString)
+	loc, err := dbConfig.Location()
+	if err != nil {
+		return fmt.Errorf("location: %w", err)
 	}
 
+	normalizerConfig := normalize.DefaultConfig()
+	if *normalizerPath != "" {
+		normalizerConfig, err = normalize.ReadConfig(*normalizerPath)
+		if err != nil {
+			return fmt.Errorf("read normalizer config: %w", err)
+		}
+	}
+	normalizer, err := normalize.New(normalizerConfig)
 	if err != nil {
-		return fmt.Errorf("parse csv: %w", err)
+		return fmt.Errorf("new normalizer: %w", err)
+	}
+
+	service := &upload.Service{
+		Parsers:    map[string]upload.Parser{"dkb": dkb.ParseCSV},
+		Location:   loc,
+		Normalizer: normalizer,
+	}
+	if _, ok := service.Parsers[*formatString]; !ok {
+		return fmt.Errorf("unknown format: %s", *formatString)
 	}
 
 	// connect to db
@@ -84,19 +110,19 @@ func run() error {
 	}
 	defer dbConn.Close()
 
-	dryRunResult, err := upload.DryRun(ctx, dbConn, creators)
-	if err != nil {
-		return fmt.Errorf("dry run: %w", err)
+	var options upload.DryRunOptions
+	if *ownerID != 0 {
+		options.OwnerHolderID = ownerID
 	}
-	slog.Debug("dry run result", slog.Group("result",
-		slog.Int("existingHolders", len(dryRunResult.ExistingHolders)),
-		slog.Int("holdersToCreate", len(dryRunResult.HoldersToCreate)),
-		slog.Int("transactions", len(dryRunResult.Transactions)),
-	))
 
 	if *dryFilePath != "" {
 		// this is a dry run, so we just save the result to the json file
-		jsonBytes, err := json.Marshal(dryRunResult)
+		preview, err := service.Preview(ctx, dbConn, *householdID, *formatString, csvFile, options)
+		if err != nil {
+			return fmt.Errorf("preview: %w", err)
+		}
+		slog.Debug("dry run result", slog.Any("preview", preview))
+		jsonBytes, err := json.Marshal(preview.DryRunResult)
 		if err != nil {
 			return fmt.Errorf("json marshal dry run result: %w", err)
 		}
@@ -106,38 +132,15 @@ func run() error {
 		return nil
 	}
 
-	return nonDryRun(ctx, dbConn, dryRunResult)
-}
-
-func nonDryRun(ctx context.Context,
-	dbConn sqlx.ExtContext,
-	result *upload.DryRunResult) error {
-
-	err := result.InsertHolders(ctx, dbConn)
+	summary, err := service.Import(ctx, dbConn, *householdID, *formatString, csvFile, options)
 	if err != nil {
-		return fmt.Errorf("insert holders: %w", err)
-	}
-
-	for _, transaction := range result.Transactions {
-		fromHolder, ok := result.ExistingHolders[transaction.FromIdentifier]
-		if !ok {
-			return fmt.Errorf("from holder not found")
-		}
-		toHolder, ok := result.ExistingHolders[transaction.ToIdentifier]
-		if !ok {
-			return fmt.Errorf("to holder not found")
-		}
-
-		create := db.CreateTransaction{
-			BaseTransaction: transaction.Transaction,
-			FromHolderID:    fromHolder.ID,
-			ToHolderID:      toHolder.ID,
-		}
-
-		_, err = db.InsertTransaction(ctx, dbConn, create)
-		if err != nil {
-			return fmt.Errorf("insert transaction: %w", err)
-		}
+		return fmt.Errorf("import: %w", err)
 	}
+	slog.Info("imported",
+		slog.Int("holdersCreated", summary.HoldersCreated),
+		slog.Int("transactionsInserted", summary.TransactionsInserted),
+		slog.Int("duplicates", summary.Duplicates),
+		slog.Int("rejected", summary.Rejected),
+		slog.Int("ruleHits", summary.RuleHits))
 	return nil
 }
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Opsi/sparschwein/auth"
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/jmoiron/sqlx"
+	"github.com/joho/godotenv"
+	"golang.org/x/term"
+)
+
+const usage = `usage: users [flags] <command>
+
+commands:
+  list                    list all users
+  add <name>              add a user to the household, e.g. the first admin with -admin
+  passwd <name>           change the password of a user and log them out
+  delete <name>           delete a user
+  link-oidc <name> <sub>  let an existing user log in as the subject of the OIDC issuer
+  tokens                  list the API tokens
+  token <name> <label>    create an API token for a user that can access the household
+  revoke <token id>       delete an API token
+  households              list all households
+  household <name>        create a household
+  join <name>             make a user a member of the household
+  leave <name>            remove a user from the household
+
+Passwords are read from the terminal, or from stdin if it isn't one. The
+household is selected with -household.`
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	if err := godotenv.Load(); err != nil {
+		return fmt.Errorf("load .env: %w", err)
+	}
+
+	// flags
+	logConfig := util.AddLogFlags()
+	dbConfig := db.AddFlags()
+	householdID := db.AddHouseholdFlag()
+	admin := flag.Bool("admin", false, "make the added user an admin")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if err := logConfig.InitSlogDefault(); err != nil {
+		return fmt.Errorf("init slog: %w", err)
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		return fmt.Errorf("command is required")
+	}
+
+	// connect to db
+	dbConn, err := dbConfig.OpenPingedConnection()
+	if err != nil {
+		return fmt.Errorf("open database: %w", err)
+	}
+	defer dbConn.Close()
+
+	args := flag.Args()
+	switch args[0] {
+	case "list":
+		return list(ctx, dbConn)
+	case "add":
+		if len(args) != 2 {
+			return fmt.Errorf("add needs a name")
+		}
+		return add(ctx, dbConn, *householdID, args[1], *admin)
+	case "passwd":
+		if len(args) != 2 {
+			return fmt.Errorf("passwd needs a name")
+		}
+		user, err := userByName(ctx, dbConn, args[1])
+		if err != nil {
+			return err
+		}
+		hash, err := readPassword()
+		if err != nil {
+			return err
+		}
+		return db.SetUserPassword(ctx, dbConn, user.ID, hash)
+	case "delete":
+		if len(args) != 2 {
+			return fmt.Errorf("delete needs a name")
+		}
+		user, err := userByName(ctx, dbConn, args[1])
+		if err != nil {
+			return err
+		}
+		return db.DeleteUser(ctx, dbConn, user.ID)
+	case "link-oidc":
+		if len(args) != 3 {
+			return fmt.Errorf("link-oidc needs a name and a subject")
+		}
+		user, err := userByName(ctx, dbConn, args[1])
+		if err != nil {
+			return err
+		}
+		return db.SetUserOIDCSubject(ctx, dbConn, user.ID, args[2])
+	case "tokens":
+		return tokens(ctx, dbConn)
+	case "token":
+		if len(args) != 3 {
+			return fmt.Errorf("token needs a name and a label")
+		}
+		return createToken(ctx, dbConn, *householdID, args[1], args[2])
+	case "revoke":
+		if len(args) != 2 {
+			return fmt.Errorf("revoke needs a token id")
+		}
+		tokenID, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse token id: %w", err)
+		}
+		return db.DeleteAPIToken(ctx, dbConn, tokenID)
+	case "households":
+		return households(ctx, dbConn)
+	case "household":
+		if len(args) != 2 {
+			return fmt.Errorf("household needs a name")
+		}
+		household, err := db.InsertHousehold(ctx, dbConn, args[1])
+		if db.IsUniqueViolation(err) {
+			return fmt.Errorf("household %q already exists", args[1])
+		}
+		if err != nil {
+			return err
+		}
+		slog.Info("added household", slog.Int("id", household.ID), slog.String("name", household.Name))
+		return nil
+	case "join":
+		if len(args) != 2 {
+			return fmt.Errorf("join needs a name")
+		}
+		user, err := userByName(ctx, dbConn, args[1])
+		if err != nil {
+			return err
+		}
+		return db.AddHouseholdMember(ctx, dbConn, *householdID, user.ID)
+	case "leave":
+		if len(args) != 2 {
+			return fmt.Errorf("leave needs a name")
+		}
+		user, err := userByName(ctx, dbConn, args[1])
+		if err != nil {
+			return err
+		}
+		return db.RemoveHouseholdMember(ctx, dbConn, *householdID, user.ID)
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+func list(ctx context.Context, dbConn *sqlx.DB) error {
+	users, err := db.GetUsers(ctx, dbConn)
+	if err != nil {
+		return fmt.Errorf("get users: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tAdmin\tCreated")
+	for _, user := range users {
+		fmt.Fprintf(w, "%d\t%s\t%t\t%s\n",
+			user.ID, user.Name, user.Admin, user.CreatedAt.Format(time.DateOnly))
+	}
+	return w.Flush()
+}
+
+func add(ctx context.Context, dbConn *sqlx.DB, householdID int, name string, admin bool) error {
+	hash, err := readPassword()
+	if err != nil {
+		return err
+	}
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := db.InsertUser(ctx, tx, db.CreateUser{
+		Name:         name,
+		PasswordHash: hash,
+		Admin:        admin,
+	})
+	if err != nil {
+		return fmt.Errorf("insert user: %w", err)
+	}
+	if err := db.AddHouseholdMember(ctx, tx, householdID, user.ID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	slog.Info("added user",
+		slog.Int("id", user.ID),
+		slog.String("name", user.Name),
+		slog.Int("householdID", householdID))
+	return nil
+}
+
+func households(ctx context.Context, dbConn *sqlx.DB) error {
+	households, err := db.GetHouseholds(ctx, dbConn)
+	if err != nil {
+		return fmt.Errorf("get households: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tName\tCreated")
+	for _, household := range households {
+		fmt.Fprintf(w, "%d\t%s\t%s\n",
+			household.ID, household.Name, household.CreatedAt.Format(time.DateOnly))
+	}
+	return w.Flush()
+}
+
+func tokens(ctx context.Context, dbConn *sqlx.DB) error {
+	users, err := db.GetUsers(ctx, dbConn)
+	if err != nil {
+		return fmt.Errorf("get users: %w", err)
+	}
+	names := make(map[int]string, len(users))
+	for _, user := range users {
+		names[user.ID] = user.Name
+	}
+	apiTokens, err := db.GetAPITokens(ctx, dbConn)
+	if err != nil {
+		return fmt.Errorf("get api tokens: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUser\tHousehold\tLabel\tLast Used")
+	for _, token := range apiTokens {
+		lastUsed := "never"
+		if token.LastUsedAt != nil {
+			lastUsed = token.LastUsedAt.Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n",
+			token.ID, names[token.UserID], token.HouseholdID, token.Name, lastUsed)
+	}
+	return w.Flush()
+}
+
+func createToken(ctx context.Context, dbConn *sqlx.DB, householdID int, name string, label string) error {
+	user, err := userByName(ctx, dbConn, name)
+	if err != nil {
+		return err
+	}
+	member, err := db.IsHouseholdMember(ctx, dbConn, householdID, user.ID)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return fmt.Errorf("user %s isn't a member of household %d", name, householdID)
+	}
+	token, err := auth.NewToken()
+	if err != nil {
+		return fmt.Errorf("new token: %w", err)
+	}
+	if _, err := db.InsertAPIToken(ctx, dbConn, user.ID, householdID, label, auth.HashToken(token)); err != nil {
+		return err
+	}
+	// the token can't be shown again, only its hash is stored
+	fmt.Println(token)
+	return nil
+}
+
+func userByName(ctx context.Context, dbConn *sqlx.DB, name string) (*db.User, error) {
+	user, found, err := db.GetUserByName(ctx, dbConn, name)
+	if err != nil {
+		return nil, fmt.Errorf("get user: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("user %s doesn't exist", name)
+	}
+	return user, nil
+}
+
+// readPassword asks for a new password twice and returns its hash.
+func readPassword() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password: %w", err)
+		}
+		return auth.HashPassword(strings.TrimRight(line, "\r\n"))
+	}
+
+	fmt.Fprint(os.Stderr, "Password: ")
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	fmt.Fprint(os.Stderr, "Repeat password: ")
+	repeated, err := term.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("read password: %w", err)
+	}
+	if string(password) != string(repeated) {
+		return "", fmt.Errorf("passwords don't match")
+	}
+	return auth.HashPassword(string(password))
+}
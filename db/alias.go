@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// AddHolderAlias makes the identifier resolve to the holder inside its
+// household. An existing alias with the same identifier is re-pointed.
+func AddHolderAlias(ctx context.Context, db sqlx.ExtContext, householdID int, identifier HolderIdentifier, holderID int) error {
+	ok, err := inHousehold(ctx, db, "holders", householdID, holderID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	owner, ok, err := GetHolderByIdentifier(ctx, db, householdID, identifier)
+	if err != nil {
+		return fmt.Errorf("get holder by identifier: %w", err)
+	}
+	if ok && owner.HolderIdentifier == identifier && owner.ID != holderID {
+		return fmt.Errorf("identifier belongs to holder %d, merge it instead", owner.ID)
+	}
+
+	const query = `
+		INSERT INTO holder_aliases (household_id, type, identifier, holder_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (household_id, type, identifier) DO UPDATE SET holder_id = EXCLUDED.holder_id`
+	_, err = db.ExecContext(ctx, query, householdID, identifier.Type, identifier.Identifier, holderID)
+	if err != nil {
+		return fmt.Errorf("insert holder alias: %w", err)
+	}
+	return nil
+}
+
+func DeleteHolderAlias(ctx context.Context, db sqlx.ExecerContext, householdID int, identifier HolderIdentifier) error {
+	const query = "DELETE FROM holder_aliases WHERE household_id = $1 AND type = $2 AND identifier = $3"
+	result, err := db.ExecContext(ctx, query, householdID, identifier.Type, identifier.Identifier)
+	if err != nil {
+		return fmt.Errorf("delete holder alias: %w", err)
+	}
+	return expectAffected(result)
+}
+
+func GetHolderAliases(ctx context.Context, db sqlx.QueryerContext, householdID, holderID int) ([]HolderAlias, error) {
+	var aliases []HolderAlias
+	const query = `
+		SELECT * FROM holder_aliases
+		WHERE holder_id = $1 AND household_id = $2
+		ORDER BY type ASC, identifier ASC`
+	err := sqlx.SelectContext(ctx, db, &aliases, query, holderID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select holder aliases: %w", err)
+	}
+	return aliases, nil
+}
+
+// MergeHolders moves the transactions, tags, children and aliases of the
+// holder fromID to the holder intoID and deletes fromID afterwards. The
+// identifier of the deleted holder becomes an alias of intoID, so future
+// imports resolve to it. Both holders must belong to the household. It
+// returns ErrHolderCycle if intoID is a descendant of fromID, because the
+// moved children would become its ancestors.
+func MergeHolders(ctx context.Context, db sqlx.ExtContext, householdID, fromID, intoID int) error {
+	if fromID == intoID {
+		return fmt.Errorf("can't merge holder %d into itself", fromID)
+	}
+	for _, id := range []int{fromID, intoID} {
+		ok, err := inHousehold(ctx, db, "holders", householdID, id)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("holder %d: %w", id, ErrNotFound)
+		}
+	}
+	if err := checkHolderCycle(ctx, db, householdID, fromID, &intoID); err != nil {
+		return fmt.Errorf("merge holder %d into %d: %w", fromID, intoID, err)
+	}
+	statements := []struct {
+		name  string
+		query string
+	}{
+		{
+			name:  "move outgoing transactions",
+			query: "UPDATE transactions SET from_holder_id = $2 WHERE from_holder_id = $1",
+		}, {
+			name:  "move incoming transactions",
+			query: "UPDATE transactions SET to_holder_id = $2 WHERE to_holder_id = $1",
+		}, {
+			name: "copy tags",
+			query: `
+				INSERT INTO holders_tags (household_id, holder_id, tag_id)
+				SELECT household_id, $2, tag_id FROM holders_tags WHERE holder_id = $1
+				ON CONFLICT DO NOTHING`,
+		}, {
+			name:  "move children",
+			query: "UPDATE holders SET parent_holder_id = $2 WHERE parent_holder_id = $1",
+		}, {
+			name:  "move aliases",
+			query: "UPDATE holder_aliases SET holder_id = $2 WHERE holder_id = $1",
+		}, {
+			name: "alias identifier",
+			query: `
+				INSERT INTO holder_aliases (household_id, type, identifier, holder_id)
+				SELECT household_id, type, identifier, $2 FROM holders WHERE id = $1
+				ON CONFLICT (household_id, type, identifier) DO UPDATE SET holder_id = EXCLUDED.holder_id`,
+		},
+	}
+	for _, statement := range statements {
+		_, err := db.ExecContext(ctx, statement.query, fromID, intoID)
+		if err != nil {
+			return fmt.Errorf("%s: %w", statement.name, err)
+		}
+	}
+
+	const query = "DELETE FROM holders WHERE id = $1"
+	result, err := db.ExecContext(ctx, query, fromID)
+	if err != nil {
+		return fmt.Errorf("delete holder: %w", err)
+	}
+	return expectAffected(result)
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeHolders(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	household, err := InsertHousehold(ctx, dbConn, "Family")
+	require.NoError(t, err)
+
+	insert := func(identifier string, parent *Holder) *Holder {
+		createHolder := CreateHolder{
+			HolderIdentifier: HolderIdentifier{Type: "test", Identifier: identifier},
+		}
+		if parent != nil {
+			createHolder.ParentHolderID = &parent.ID
+		}
+		holder, err := InsertHolder(ctx, dbConn, household.ID, createHolder)
+		require.NoError(t, err)
+		return holder
+	}
+	person := insert("person", nil)
+	account := insert("account", person)
+	savings := insert("savings", account)
+	duplicate := insert("duplicate", nil)
+	card := insert("card", duplicate)
+
+	tests := []struct {
+		name   string
+		fromID int
+		intoID int
+		want   error
+	}{
+		{name: "into child", fromID: person.ID, intoID: account.ID, want: ErrHolderCycle},
+		{name: "into grandchild", fromID: person.ID, intoID: savings.ID, want: ErrHolderCycle},
+		{name: "into itself", fromID: person.ID, intoID: person.ID},
+		{name: "unknown", fromID: person.ID, intoID: 0, want: ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := MergeHolders(ctx, dbConn, household.ID, tt.fromID, tt.intoID)
+			require.Error(t, err)
+			if tt.want != nil {
+				assert.ErrorIs(t, err, tt.want)
+			}
+			_, found, err := GetHolder(ctx, dbConn, household.ID, tt.fromID)
+			require.NoError(t, err)
+			assert.True(t, found, "the merged holder is kept")
+		})
+	}
+
+	// merging into another branch moves the children and aliases the holder
+	require.NoError(t, MergeHolders(ctx, dbConn, household.ID, duplicate.ID, account.ID))
+	_, found, err := GetHolder(ctx, dbConn, household.ID, duplicate.ID)
+	require.NoError(t, err)
+	assert.False(t, found)
+	moved, found, err := GetHolder(ctx, dbConn, household.ID, card.ID)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, &account.ID, moved.ParentHolderID)
+	aliases, err := GetHolderAliases(ctx, dbConn, household.ID, account.ID)
+	require.NoError(t, err)
+	require.Len(t, aliases, 1)
+	assert.Equal(t, "duplicate", aliases[0].Identifier)
+}
@@ -1,14 +1,47 @@
+// Package db reads and writes the households, their holders, transactions,
+// tags and rules and the users in postgres.
+//
+// Functions that run more than one statement, e.g. DeleteTag, MergeHolders
+// or SplitTransaction, don't start a database transaction themselves. Pass
+// them a *sqlx.Tx, so a failing statement doesn't leave half of the change
+// behind. The same holds for the functions of the importers that build on
+// them.
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"flag"
 	"fmt"
+	"time"
+	_ "time/tzdata"
 
 	"github.com/Opsi/sparschwein/util"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
+// ErrNotFound is returned when a row that should be changed doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// ErrDuplicate is returned when a row that should be inserted already
+// exists, but no unique constraint of the database says so.
+var ErrDuplicate = errors.New("already exists")
+
+// IsUniqueViolation reports whether the error was caused by a row that
+// already exists.
+func IsUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// IsForeignKeyViolation reports whether the error was caused by a reference
+// to a row that doesn't exist.
+func IsForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
+}
+
 // Config holds the database configuration values
 type Config struct {
 	// Host of the database
@@ -21,6 +54,9 @@ type Config struct {
 	Password string
 	// Database name
 	Database string
+	// TimeZone is the IANA name of the time zone used for reporting, e.g. to
+	// decide on which day a booking happened.
+	TimeZone string
 }
 
 // AddFlags adds the database flags and returns the configuration struct to
@@ -53,20 +89,45 @@ func AddFlags() *Config {
 		"db-name",
 		util.LookupStringEnv("DB_NAME", "sparschwein"),
 		"Database name (default: sparschwein)")
+	flag.StringVar(
+		&dbConfig.TimeZone,
+		"timezone",
+		util.LookupStringEnv("TIMEZONE", "Europe/Berlin"),
+		"Time zone for dates and reports (default: Europe/Berlin)")
 
 	return dbConfig
 }
 
+// Location loads the configured reporting time zone.
+func (c Config) Location() (*time.Location, error) {
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("load location %q: %w", c.TimeZone, err)
+	}
+	return loc, nil
+}
+
 func (c Config) OpenPingedConnection() (*sqlx.DB, error) {
+	if _, err := c.Location(); err != nil {
+		return nil, err
+	}
+
 	// Construct the connection string.
 	// SSL mode 'disable' is not recommended for production use.
+	// The session time zone makes postgres convert timestamps to dates in
+	// the reporting time zone.
 	dataSourceName := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		c.Host, c.Port, c.User, c.Password, c.Database)
+		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable timezone=%s",
+		c.Host, c.Port, c.User, c.Password, c.Database, c.TimeZone)
 
-	conn, err := sqlx.Connect("postgres", dataSourceName)
+	connector, err := pq.NewConnector(dataSourceName)
 	if err != nil {
 		return nil, fmt.Errorf("connect: %w", err)
 	}
+	conn := sqlx.NewDb(sql.OpenDB(logConnector{connector}), "postgres")
+	if err := conn.Ping(); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect: %w", err)
+	}
 	return conn, nil
 }
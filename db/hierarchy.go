@@ -0,0 +1,192 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrHolderCycle is returned when a holder would become its own ancestor.
+var ErrHolderCycle = errors.New("holder would become its own ancestor")
+
+// holderSubtreeCTE selects the ids of the holder $1 of the household $2 and
+// all of its descendants as the common table expression holder_subtree.
+// Parents and children are always in the same household.
+const holderSubtreeCTE = `
+	WITH RECURSIVE holder_subtree (id) AS (
+		SELECT id FROM holders WHERE id = $1 AND household_id = $2
+		UNION
+		SELECT holders.id FROM holders
+		JOIN holder_subtree ON holders.parent_holder_id = holder_subtree.id
+	)`
+
+// SetHolderParent changes the parent of the holder, e.g. to put an account
+// below a person. A nil parent makes it a root holder. It returns
+// ErrHolderCycle if the new parent is the holder itself or one of its
+// descendants.
+func SetHolderParent(ctx context.Context, db sqlx.ExtContext, householdID, id int, parentHolderID *int) error {
+	if err := checkReference(ctx, db, "holders", householdID, parentHolderID); err != nil {
+		return err
+	}
+	if err := checkHolderCycle(ctx, db, householdID, id, parentHolderID); err != nil {
+		return err
+	}
+
+	const query = "UPDATE holders SET parent_holder_id = $2 WHERE id = $1 AND household_id = $3"
+	result, err := db.ExecContext(ctx, query, id, parentHolderID, householdID)
+	if err != nil {
+		return fmt.Errorf("update holder: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// checkHolderCycle returns ErrHolderCycle if the parent is the holder or one
+// of its descendants.
+func checkHolderCycle(ctx context.Context, db sqlx.QueryerContext, householdID, id int, parentHolderID *int) error {
+	if parentHolderID == nil {
+		return nil
+	}
+	var isDescendant bool
+	query := holderSubtreeCTE + `
+		SELECT EXISTS (SELECT 1 FROM holder_subtree WHERE id = $3)`
+	err := sqlx.GetContext(ctx, db, &isDescendant, query, id, householdID, *parentHolderID)
+	if err != nil {
+		return fmt.Errorf("select holder subtree: %w", err)
+	}
+	if isDescendant {
+		return ErrHolderCycle
+	}
+	return nil
+}
+
+// GetHolderSubtree returns the holder and all of its descendants.
+func GetHolderSubtree(ctx context.Context, db sqlx.QueryerContext, householdID, rootID int) ([]Holder, error) {
+	var holders []Holder
+	query := holderSubtreeCTE + `
+		SELECT holders.* FROM holders
+		JOIN holder_subtree ON holder_subtree.id = holders.id
+		ORDER BY holders.id ASC`
+	err := sqlx.SelectContext(ctx, db, &holders, query, rootID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select holder subtree: %w", err)
+	}
+	return holders, nil
+}
+
+// GetSubtreeTransactions returns the transactions of the holder and all of
+// its descendants, newest first. The amount is signed from the perspective
+// of the whole subtree. Transfers between two holders of the subtree have
+// the direction DirectionInternal and keep the positive amount. They don't
+// change the balance of the subtree, so they must be skipped when summing.
+func GetSubtreeTransactions(ctx context.Context, db sqlx.QueryerContext, householdID, rootID int, filter HolderTransactionFilter) ([]HolderTransaction, error) {
+	query := holderSubtreeCTE + `
+		SELECT t.*,
+			CASE WHEN fs.id IS NULL THEN t.amount
+				WHEN ts.id IS NULL THEN -t.amount
+				ELSE t.amount
+			END AS signed_amount,
+			CASE WHEN fs.id IS NULL THEN 'in'
+				WHEN ts.id IS NULL THEN 'out'
+				ELSE 'internal'
+			END AS direction,
+			` + holderColumns("c", "counterparty") + `
+		FROM transactions t
+		LEFT JOIN holder_subtree fs ON fs.id = t.from_holder_id
+		LEFT JOIN holder_subtree ts ON ts.id = t.to_holder_id
+		JOIN holders c ON c.id = CASE
+			WHEN fs.id IS NULL THEN t.from_holder_id
+			ELSE t.to_holder_id
+		END
+		WHERE (fs.id IS NOT NULL OR ts.id IS NOT NULL)
+		AND ` + notSplitCondition
+	args := []any{rootID, householdID}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND t.timestamp >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND t.timestamp < $%d", len(args))
+	}
+	switch filter.Direction {
+	case "":
+	case DirectionIn:
+		query += " AND fs.id IS NULL"
+	case DirectionOut:
+		query += " AND ts.id IS NULL"
+	case DirectionInternal:
+		query += " AND fs.id IS NOT NULL AND ts.id IS NOT NULL"
+	default:
+		return nil, fmt.Errorf("unknown direction %q", filter.Direction)
+	}
+	query += " ORDER BY t.timestamp DESC, t.id DESC"
+
+	var transactions []HolderTransaction
+	err := sqlx.SelectContext(ctx, db, &transactions, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select subtree transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+// GetSubtreeCashFlow sums up the money entering, leaving and moving inside
+// the subtree of the holder per month. from is inclusive, to is exclusive and
+// both are optional.
+func GetSubtreeCashFlow(ctx context.Context, db sqlx.QueryerContext, householdID, rootID int, from, to *time.Time) ([]CashFlow, error) {
+	query := holderSubtreeCTE + `
+		SELECT date_trunc('month', t.timestamp) AS month,
+			COALESCE(SUM(t.amount) FILTER (WHERE fs.id IS NULL), 0) AS income,
+			COALESCE(SUM(t.amount) FILTER (WHERE ts.id IS NULL), 0) AS expenses,
+			COALESCE(SUM(t.amount) FILTER (
+				WHERE fs.id IS NOT NULL AND ts.id IS NOT NULL
+			), 0) AS internal
+		FROM transactions t
+		LEFT JOIN holder_subtree fs ON fs.id = t.from_holder_id
+		LEFT JOIN holder_subtree ts ON ts.id = t.to_holder_id
+		WHERE (fs.id IS NOT NULL OR ts.id IS NOT NULL)
+		AND ` + notSplitCondition
+	args := []any{rootID, householdID}
+	if from != nil {
+		args = append(args, *from)
+		query += fmt.Sprintf(" AND t.timestamp >= $%d", len(args))
+	}
+	if to != nil {
+		args = append(args, *to)
+		query += fmt.Sprintf(" AND t.timestamp < $%d", len(args))
+	}
+	query += " GROUP BY month ORDER BY month ASC"
+
+	var cashFlows []CashFlow
+	err := sqlx.SelectContext(ctx, db, &cashFlows, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select subtree cash flow: %w", err)
+	}
+	return cashFlows, nil
+}
+
+// GetSubtreeBalances returns the balance of the holder and each of its
+// descendants. The balance of the whole subtree is the sum of them, because
+// internal transfers cancel each other out.
+func GetSubtreeBalances(ctx context.Context, db sqlx.QueryerContext, householdID, rootID int) ([]HolderBalance, error) {
+	query := holderSubtreeCTE + `
+		SELECT h.id AS holder_id, h.name,
+			COALESCE((
+				SELECT SUM(CASE WHEN t.to_holder_id = h.id THEN t.amount ELSE -t.amount END)
+				FROM transactions t
+				WHERE (t.from_holder_id = h.id OR t.to_holder_id = h.id)
+				AND t.from_holder_id <> t.to_holder_id
+				AND ` + notSplitCondition + `
+			), 0) AS balance
+		FROM holders h
+		JOIN holder_subtree ON holder_subtree.id = h.id
+		ORDER BY h.id ASC`
+	var balances []HolderBalance
+	err := sqlx.SelectContext(ctx, db, &balances, query, rootID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select subtree balances: %w", err)
+	}
+	return balances, nil
+}
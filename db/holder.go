@@ -5,14 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 
 	"github.com/jmoiron/sqlx"
 )
 
-func GetHolderByIdentifier(ctx context.Context, db sqlx.QueryerContext, identifier HolderIdentifier) (*Holder, bool, error) {
+func GetHolder(ctx context.Context, db sqlx.QueryerContext, householdID, id int) (*Holder, bool, error) {
 	var holder Holder
-	const query = "SELECT * FROM holders WHERE type = $1 AND identifier = $2"
-	err := sqlx.GetContext(ctx, db, &holder, query, identifier.Type, identifier.Identifier)
+	const query = "SELECT * FROM holders WHERE id = $1 AND household_id = $2"
+	err := sqlx.GetContext(ctx, db, &holder, query, id, householdID)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, false, nil
 	}
@@ -22,13 +23,40 @@ func GetHolderByIdentifier(ctx context.Context, db sqlx.QueryerContext, identifi
 	return &holder, true, nil
 }
 
-func InsertHolder(ctx context.Context, db sqlx.ExtContext, createHolder CreateHolder) (*Holder, error) {
+// GetHolderByIdentifier returns the holder of the household with the
+// identifier. If no holder has it, the holder it is an alias of is returned.
+func GetHolderByIdentifier(ctx context.Context, db sqlx.QueryerContext, householdID int, identifier HolderIdentifier) (*Holder, bool, error) {
+	var holder Holder
+	const query = `
+		SELECT * FROM holders WHERE household_id = $3 AND id = COALESCE(
+			(SELECT id FROM holders
+				WHERE household_id = $3 AND type = $1 AND identifier = $2),
+			(SELECT holder_id FROM holder_aliases
+				WHERE household_id = $3 AND type = $1 AND identifier = $2)
+		)`
+	err := sqlx.GetContext(ctx, db, &holder, query, identifier.Type, identifier.Identifier, householdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select holder: %w", err)
+	}
+	return &holder, true, nil
+}
+
+func InsertHolder(ctx context.Context, db sqlx.ExtContext, householdID int, createHolder CreateHolder) (*Holder, error) {
+	if err := checkReference(ctx, db, "holders", householdID, createHolder.ParentHolderID); err != nil {
+		return nil, err
+	}
 	query := `
 		INSERT INTO holders
-			(type, identifier, name, parent_holder_id, data, favorite)
-	        VALUES (:type, :identifier, :name, :parent_holder_id, :data, :favorite)
+			(household_id, type, identifier, name, parent_holder_id, data, favorite)
+	        VALUES (:household_id, :type, :identifier, :name, :parent_holder_id, :data, :favorite)
 			RETURNING *`
-	rows, err := sqlx.NamedQueryContext(ctx, db, query, createHolder)
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, Holder{
+		CreateHolder: createHolder,
+		HouseholdID:  householdID,
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -46,12 +74,129 @@ func InsertHolder(ctx context.Context, db sqlx.ExtContext, createHolder CreateHo
 	return &holder, nil
 }
 
-func GetHolders(ctx context.Context, db sqlx.QueryerContext) ([]Holder, error) {
+// ListHolders returns up to limit holders of the household with an id
+// greater than afterID, ordered by id.
+func ListHolders(ctx context.Context, db sqlx.QueryerContext, householdID int, afterID int, limit int) ([]Holder, error) {
+	var holders []Holder
+	const query = `
+		SELECT * FROM holders
+		WHERE household_id = $1 AND id > $2
+		ORDER BY id ASC LIMIT $3`
+	err := sqlx.SelectContext(ctx, db, &holders, query, householdID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select holders: %w", err)
+	}
+	return holders, nil
+}
+
+func GetHolders(ctx context.Context, db sqlx.QueryerContext, householdID int) ([]Holder, error) {
 	var holders []Holder
-	const query = "SELECT * FROM holders ORDER BY favorite DESC, id ASC"
-	err := sqlx.SelectContext(ctx, db, &holders, query)
+	const query = "SELECT * FROM holders WHERE household_id = $1 ORDER BY favorite DESC, id ASC"
+	err := sqlx.SelectContext(ctx, db, &holders, query, householdID)
 	if err != nil {
 		return nil, fmt.Errorf("select holders: %w", err)
 	}
 	return holders, nil
 }
+
+// holderColumns selects all holder columns of the table alias as columns of
+// the nested struct field with the given prefix.
+func holderColumns(alias, prefix string) string {
+	columns := []string{
+		"id", "household_id", "type", "identifier", "name", "parent_holder_id", "data", "favorite",
+		"created_at",
+	}
+	selected := make([]string, len(columns))
+	for i, column := range columns {
+		selected[i] = fmt.Sprintf(`%s.%s AS "%s.%s"`, alias, column, prefix, column)
+	}
+	return strings.Join(selected, ", ")
+}
+
+// UpdateHolderIdentifier changes the type and identifier of the holder.
+func UpdateHolderIdentifier(ctx context.Context, db sqlx.ExecerContext, householdID, id int, identifier HolderIdentifier) error {
+	const query = "UPDATE holders SET type = $2, identifier = $3 WHERE id = $1 AND household_id = $4"
+	result, err := db.ExecContext(ctx, query, id, identifier.Type, identifier.Identifier, householdID)
+	if err != nil {
+		return fmt.Errorf("update holder: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// RenameHolder changes the display name of the holder.
+func RenameHolder(ctx context.Context, db sqlx.ExecerContext, householdID, id int, name string) error {
+	const query = "UPDATE holders SET name = $2 WHERE id = $1 AND household_id = $3"
+	result, err := db.ExecContext(ctx, query, id, name, householdID)
+	if err != nil {
+		return fmt.Errorf("update holder: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// ToggleHolderFavorite flips the favorite flag of the holder and returns the
+// new value.
+func ToggleHolderFavorite(ctx context.Context, db sqlx.QueryerContext, householdID, id int) (bool, error) {
+	var favorite bool
+	const query = `
+		UPDATE holders SET favorite = NOT favorite
+		WHERE id = $1 AND household_id = $2
+		RETURNING favorite`
+	err := sqlx.GetContext(ctx, db, &favorite, query, id, householdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, ErrNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("update holder: %w", err)
+	}
+	return favorite, nil
+}
+
+// UpdateHolder replaces all columns of the holder. It returns ErrHolderCycle
+// if the new parent is the holder itself or one of its descendants.
+func UpdateHolder(ctx context.Context, db sqlx.ExtContext, householdID, id int, update CreateHolder) (*Holder, error) {
+	if err := checkReference(ctx, db, "holders", householdID, update.ParentHolderID); err != nil {
+		return nil, err
+	}
+	if err := checkHolderCycle(ctx, db, householdID, id, update.ParentHolderID); err != nil {
+		return nil, err
+	}
+	query := `
+		UPDATE holders SET
+			type = :type,
+			identifier = :identifier,
+			name = :name,
+			parent_holder_id = :parent_holder_id,
+			data = :data,
+			favorite = :favorite
+		WHERE id = :id AND household_id = :household_id
+		RETURNING *`
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, Holder{
+		CreateHolder: update,
+		ID:           id,
+		HouseholdID:  householdID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update holder: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrNotFound
+	}
+	var holder Holder
+	err = rows.StructScan(&holder)
+	if err != nil {
+		return nil, fmt.Errorf("struct scan: %w", err)
+	}
+	return &holder, nil
+}
+
+// DeleteHolder deletes the holder together with all of its transactions.
+func DeleteHolder(ctx context.Context, db sqlx.ExecerContext, householdID, id int) error {
+	const query = "DELETE FROM holders WHERE id = $1 AND household_id = $2"
+	result, err := db.ExecContext(ctx, query, id, householdID)
+	if err != nil {
+		return fmt.Errorf("delete holder: %w", err)
+	}
+	return expectAffected(result)
+}
@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/Opsi/sparschwein/util"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// ErrInvalidReference is returned when a row references a holder or tag
+// that doesn't exist in the household.
+var ErrInvalidReference = errors.New("referenced row doesn't exist")
+
+// AddHouseholdFlag adds the flag selecting the household the command works
+// on and returns its value.
+func AddHouseholdFlag() *int {
+	return flag.Int(
+		"household",
+		util.LookupIntEnv("HOUSEHOLD", 1),
+		"id of the household to work on (default: 1)")
+}
+
+// inHousehold reports whether the row with the id of the table belongs to
+// the household. Only the tables holders, transactions and tags are
+// allowed.
+func inHousehold(ctx context.Context, db sqlx.QueryerContext, table string, householdID, id int) (bool, error) {
+	switch table {
+	case "holders", "transactions", "tags":
+	default:
+		return false, fmt.Errorf("table %s has no household", table)
+	}
+	var exists bool
+	query := "SELECT EXISTS (SELECT 1 FROM " + table + " WHERE id = $1 AND household_id = $2)"
+	err := sqlx.GetContext(ctx, db, &exists, query, id, householdID)
+	if err != nil {
+		return false, fmt.Errorf("select %s: %w", table, err)
+	}
+	return exists, nil
+}
+
+// checkReference returns ErrInvalidReference if the optional id doesn't
+// belong to a row of the table in the household.
+func checkReference(ctx context.Context, db sqlx.QueryerContext, table string, householdID int, id *int) error {
+	if id == nil {
+		return nil
+	}
+	ok, err := inHousehold(ctx, db, table, householdID, *id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("%w: %s %d", ErrInvalidReference, table, *id)
+	}
+	return nil
+}
+
+func InsertHousehold(ctx context.Context, db sqlx.QueryerContext, name string) (*Household, error) {
+	var household Household
+	const query = "INSERT INTO households (name) VALUES ($1) RETURNING *"
+	err := sqlx.GetContext(ctx, db, &household, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("insert household: %w", err)
+	}
+	return &household, nil
+}
+
+// LockHousehold waits until no other database transaction holds the lock of
+// the household and holds it until the current one ends. Imports take it,
+// so importing the same export twice at once doesn't create duplicates.
+func LockHousehold(ctx context.Context, db sqlx.ExecerContext, householdID int) error {
+	_, err := db.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", householdID)
+	if err != nil {
+		return fmt.Errorf("lock household: %w", err)
+	}
+	return nil
+}
+
+func GetHouseholds(ctx context.Context, db sqlx.QueryerContext) ([]Household, error) {
+	var households []Household
+	const query = "SELECT * FROM households ORDER BY id ASC"
+	err := sqlx.SelectContext(ctx, db, &households, query)
+	if err != nil {
+		return nil, fmt.Errorf("select households: %w", err)
+	}
+	return households, nil
+}
+
+// GetHouseholdsByName returns the households with one of the names. Names
+// are unique, so there is at most one household per name.
+func GetHouseholdsByName(ctx context.Context, db sqlx.QueryerContext, names []string) ([]Household, error) {
+	var households []Household
+	const query = "SELECT * FROM households WHERE name = ANY($1) ORDER BY id ASC"
+	err := sqlx.SelectContext(ctx, db, &households, query, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("select households: %w", err)
+	}
+	return households, nil
+}
+
+// GetUserHouseholds returns the households the user is a member of.
+func GetUserHouseholds(ctx context.Context, db sqlx.QueryerContext, userID int) ([]Household, error) {
+	var households []Household
+	const query = `
+		SELECT households.* FROM households
+		JOIN household_members ON household_members.household_id = households.id
+		WHERE household_members.user_id = $1
+		ORDER BY households.name ASC, households.id ASC`
+	err := sqlx.SelectContext(ctx, db, &households, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("select user households: %w", err)
+	}
+	return households, nil
+}
+
+// IsHouseholdMember reports whether the user may access the household.
+func IsHouseholdMember(ctx context.Context, db sqlx.QueryerContext, householdID, userID int) (bool, error) {
+	var member bool
+	const query = `
+		SELECT EXISTS (
+			SELECT 1 FROM household_members WHERE household_id = $1 AND user_id = $2
+		)`
+	err := sqlx.GetContext(ctx, db, &member, query, householdID, userID)
+	if err != nil {
+		return false, fmt.Errorf("select household member: %w", err)
+	}
+	return member, nil
+}
+
+func AddHouseholdMember(ctx context.Context, db sqlx.ExecerContext, householdID, userID int) error {
+	const query = `
+		INSERT INTO household_members (household_id, user_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`
+	_, err := db.ExecContext(ctx, query, householdID, userID)
+	if err != nil {
+		return fmt.Errorf("insert household member: %w", err)
+	}
+	return nil
+}
+
+// SetUserHouseholds makes the user a member of exactly the households. The
+// sessions and tokens of other households stop working.
+func SetUserHouseholds(ctx context.Context, db sqlx.ExecerContext, userID int, householdIDs []int) error {
+	const deleteMembers = `
+		DELETE FROM household_members
+		WHERE user_id = $1 AND NOT household_id = ANY($2)`
+	// a nil slice would become NULL and keep all memberships
+	if householdIDs == nil {
+		householdIDs = []int{}
+	}
+	_, err := db.ExecContext(ctx, deleteMembers, userID, pq.Array(householdIDs))
+	if err != nil {
+		return fmt.Errorf("delete household members: %w", err)
+	}
+	for _, householdID := range householdIDs {
+		if err := AddHouseholdMember(ctx, db, householdID, userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RemoveHouseholdMember takes the access to the household away from the
+// user. Its sessions and tokens for the household are deleted as well.
+func RemoveHouseholdMember(ctx context.Context, db sqlx.ExecerContext, householdID, userID int) error {
+	const query = "DELETE FROM household_members WHERE household_id = $1 AND user_id = $2"
+	result, err := db.ExecContext(ctx, query, householdID, userID)
+	if err != nil {
+		return fmt.Errorf("delete household member: %w", err)
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+	const deleteSessions = "DELETE FROM sessions WHERE household_id = $1 AND user_id = $2"
+	if _, err := db.ExecContext(ctx, deleteSessions, householdID, userID); err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+	const deleteTokens = "DELETE FROM api_tokens WHERE household_id = $1 AND user_id = $2"
+	if _, err := db.ExecContext(ctx, deleteTokens, householdID, userID); err != nil {
+		return fmt.Errorf("delete api tokens: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestForeignKeysStayInHousehold(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+
+	type household struct {
+		ID            int
+		Holder        *Holder
+		Other         *Holder
+		Tag           *Tag
+		TransactionID int
+	}
+	newHousehold := func(name string) household {
+		created, err := InsertHousehold(ctx, dbConn, name)
+		require.NoError(t, err)
+		h := household{ID: created.ID}
+		h.Holder, err = InsertHolder(ctx, dbConn, h.ID, CreateHolder{
+			HolderIdentifier: HolderIdentifier{Type: "test", Identifier: "holder"},
+		})
+		require.NoError(t, err)
+		h.Other, err = InsertHolder(ctx, dbConn, h.ID, CreateHolder{
+			HolderIdentifier: HolderIdentifier{Type: "test", Identifier: "other"},
+		})
+		require.NoError(t, err)
+		h.Tag, err = InsertTag(ctx, dbConn, h.ID, CreateTag{Name: "tag"})
+		require.NoError(t, err)
+		day := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+		transaction, err := InsertTransaction(ctx, dbConn, h.ID, CreateTransaction{
+			BaseTransaction: BaseTransaction{
+				AmountInCents: 100,
+				Timestamp:     day,
+				BookingDate:   day,
+				ValueDate:     day,
+			},
+			FromHolderID: h.Holder.ID,
+			ToHolderID:   h.Other.ID,
+		})
+		require.NoError(t, err)
+		h.TransactionID = transaction.ID
+		return h
+	}
+	alice := newHousehold("alice")
+	bob := newHousehold("bob")
+
+	tests := []struct {
+		name  string
+		query string
+		args  []any
+	}{
+		{
+			name:  "parent holder",
+			query: "UPDATE holders SET parent_holder_id = $1 WHERE id = $2",
+			args:  []any{bob.Holder.ID, alice.Holder.ID},
+		}, {
+			name:  "parent tag",
+			query: "UPDATE tags SET parent_tag_id = $1 WHERE id = $2",
+			args:  []any{bob.Tag.ID, alice.Tag.ID},
+		}, {
+			name:  "parent transaction",
+			query: "UPDATE transactions SET parent_transaction_id = $1 WHERE id = $2",
+			args:  []any{bob.TransactionID, alice.TransactionID},
+		}, {
+			name:  "holder tag",
+			query: "INSERT INTO holders_tags (household_id, holder_id, tag_id) VALUES ($1, $2, $3)",
+			args:  []any{alice.ID, alice.Holder.ID, bob.Tag.ID},
+		}, {
+			name:  "transaction tag",
+			query: "INSERT INTO transactions_tags (household_id, transaction_id, tag_id) VALUES ($1, $2, $3)",
+			args:  []any{alice.ID, alice.TransactionID, bob.Tag.ID},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dbConn.ExecContext(ctx, tt.query, tt.args...)
+			assert.ErrorContains(t, err, "foreign key")
+		})
+	}
+
+	// deleting a parent only clears the parent column
+	child, err := InsertHolder(ctx, dbConn, alice.ID, CreateHolder{
+		HolderIdentifier: HolderIdentifier{Type: "test", Identifier: "child"},
+		ParentHolderID:   &alice.Other.ID,
+	})
+	require.NoError(t, err)
+	require.NoError(t, AttachHolderTag(ctx, dbConn, alice.ID, alice.Other.ID, alice.Tag.ID))
+	require.NoError(t, DeleteHolder(ctx, dbConn, alice.ID, alice.Other.ID))
+	child, ok, err := GetHolder(ctx, dbConn, alice.ID, child.ID)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Nil(t, child.ParentHolderID)
+	assert.Equal(t, alice.ID, child.HouseholdID)
+}
+
+func TestLockHousehold(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	household, err := InsertHousehold(ctx, dbConn, "Family")
+	require.NoError(t, err)
+	other, err := InsertHousehold(ctx, dbConn, "Neighbours")
+	require.NoError(t, err)
+
+	first, err := dbConn.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	defer first.Rollback()
+	require.NoError(t, LockHousehold(ctx, first, household.ID))
+
+	second, err := dbConn.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	defer second.Rollback()
+	// other households aren't locked
+	require.NoError(t, LockHousehold(ctx, second, other.ID))
+	timeout, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, LockHousehold(timeout, second, household.ID))
+	require.NoError(t, second.Rollback())
+
+	// the lock is released with the transaction
+	require.NoError(t, first.Commit())
+	third, err := dbConn.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	defer third.Rollback()
+	assert.NoError(t, LockHousehold(ctx, third, household.ID))
+}
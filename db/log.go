@@ -0,0 +1,83 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"log/slog"
+	"time"
+
+	"github.com/Opsi/sparschwein/util"
+)
+
+// logConnector logs the queries of its connections at debug level with the
+// logger of their context, so they carry the ID of the request that sent
+// them.
+type logConnector struct {
+	driver.Connector
+}
+
+func (c logConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	pgConn, ok := conn.(postgresConn)
+	if !ok {
+		return conn, nil
+	}
+	return &logConn{pgConn}, nil
+}
+
+// postgresConn are the interfaces the connections of lib/pq implement.
+type postgresConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.QueryerContext
+	driver.ExecerContext
+	driver.Pinger
+	driver.SessionResetter
+	driver.Validator
+}
+
+type logConn struct {
+	postgresConn
+}
+
+func (c *logConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+	rows, err := c.postgresConn.QueryContext(ctx, query, args)
+	logQuery(ctx, query, start, err)
+	return rows, err
+}
+
+func (c *logConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+	result, err := c.postgresConn.ExecContext(ctx, query, args)
+	logQuery(ctx, query, start, err)
+	return result, err
+}
+
+func (c *logConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	start := time.Now()
+	tx, err := c.postgresConn.BeginTx(ctx, opts)
+	logQuery(ctx, "BEGIN", start, err)
+	return tx, err
+}
+
+// logQuery logs the query without its arguments, which may be amounts or
+// password hashes.
+func logQuery(ctx context.Context, query string, start time.Time, err error) {
+	logger := util.Logger(ctx)
+	if !logger.Enabled(ctx, slog.LevelDebug) {
+		return
+	}
+	attrs := []slog.Attr{
+		slog.String("query", query),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	logger.LogAttrs(ctx, slog.LevelDebug, "query", attrs...)
+}
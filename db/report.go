@@ -0,0 +1,128 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// favoritesCTE selects the ids of the favorite holders of the household $1
+// and all of their descendants as the common table expression favorites.
+// Money entering or leaving them is income or an expense of the household.
+const favoritesCTE = `
+	WITH RECURSIVE favorites (id) AS (
+		SELECT id FROM holders WHERE household_id = $1 AND favorite
+		UNION
+		SELECT holders.id FROM holders
+		JOIN favorites ON holders.parent_holder_id = favorites.id
+	)`
+
+// TagSpending sums up the expenses tagged with a top-level tag or one of its
+// descendants.
+type TagSpending struct {
+	// TagID is nil for expenses without tags.
+	TagID         *int `db:"tag_id"`
+	Name          string
+	AmountInCents int `db:"amount"`
+}
+
+// CounterpartyTotal sums up the money exchanged with a holder outside of
+// the favorites.
+type CounterpartyTotal struct {
+	HolderID        int `db:"holder_id"`
+	Name            string
+	IncomeInCents   int `db:"income"`
+	ExpensesInCents int `db:"expenses"`
+}
+
+// GetFavoritesCashFlow sums up the money entering, leaving and moving
+// between the favorite holders and their descendants per month. from is
+// inclusive and to is exclusive.
+func GetFavoritesCashFlow(ctx context.Context, db sqlx.QueryerContext, householdID int, from, to time.Time) ([]CashFlow, error) {
+	query := favoritesCTE + `
+		SELECT date_trunc('month', t.timestamp) AS month,
+			COALESCE(SUM(t.amount) FILTER (WHERE fs.id IS NULL), 0) AS income,
+			COALESCE(SUM(t.amount) FILTER (WHERE ts.id IS NULL), 0) AS expenses,
+			COALESCE(SUM(t.amount) FILTER (
+				WHERE fs.id IS NOT NULL AND ts.id IS NOT NULL
+			), 0) AS internal
+		FROM transactions t
+		LEFT JOIN favorites fs ON fs.id = t.from_holder_id
+		LEFT JOIN favorites ts ON ts.id = t.to_holder_id
+		WHERE (fs.id IS NOT NULL OR ts.id IS NOT NULL)
+		AND t.timestamp >= $2 AND t.timestamp < $3
+		AND ` + notSplitCondition + `
+		GROUP BY month ORDER BY month ASC`
+	var cashFlows []CashFlow
+	err := sqlx.SelectContext(ctx, db, &cashFlows, query, householdID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("select favorites cash flow: %w", err)
+	}
+	return cashFlows, nil
+}
+
+// GetSpendingByTag sums up the money leaving the favorites by top-level tag,
+// largest first. An expense with tags below several top-level tags counts
+// for each of them.
+func GetSpendingByTag(ctx context.Context, db sqlx.QueryerContext, householdID int, from, to time.Time) ([]TagSpending, error) {
+	query := favoritesCTE + `,
+	tag_roots (id, root_id) AS (
+		SELECT id, id FROM tags WHERE household_id = $1 AND parent_tag_id IS NULL
+		UNION
+		SELECT tags.id, tag_roots.root_id FROM tags
+		JOIN tag_roots ON tags.parent_tag_id = tag_roots.id
+	),
+	expenses AS (
+		SELECT t.id, t.amount FROM transactions t
+		WHERE t.from_holder_id IN (SELECT id FROM favorites)
+		AND t.to_holder_id NOT IN (SELECT id FROM favorites)
+		AND t.timestamp >= $2 AND t.timestamp < $3
+		AND ` + notSplitCondition + `
+	)
+	SELECT r.id AS tag_id, COALESCE(r.name, '') AS name, SUM(e.amount) AS amount
+	FROM expenses e
+	LEFT JOIN LATERAL (
+		SELECT DISTINCT tag_roots.root_id FROM transactions_tags
+		JOIN tag_roots ON tag_roots.id = transactions_tags.tag_id
+		WHERE transactions_tags.transaction_id = e.id
+	) roots ON TRUE
+	LEFT JOIN tags r ON r.id = roots.root_id
+	GROUP BY r.id, r.name
+	ORDER BY amount DESC, r.name ASC`
+	var spending []TagSpending
+	err := sqlx.SelectContext(ctx, db, &spending, query, householdID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("select spending by tag: %w", err)
+	}
+	return spending, nil
+}
+
+// GetTopCounterparties returns the limit holders outside of the favorites
+// that exchanged the most money with them, income and expenses together.
+func GetTopCounterparties(ctx context.Context, db sqlx.QueryerContext, householdID int, from, to time.Time, limit int) ([]CounterpartyTotal, error) {
+	query := favoritesCTE + `
+		SELECT c.id AS holder_id, COALESCE(NULLIF(c.name, ''), c.identifier, '') AS name,
+			COALESCE(SUM(t.amount) FILTER (WHERE fs.id IS NULL), 0) AS income,
+			COALESCE(SUM(t.amount) FILTER (WHERE ts.id IS NULL), 0) AS expenses
+		FROM transactions t
+		LEFT JOIN favorites fs ON fs.id = t.from_holder_id
+		LEFT JOIN favorites ts ON ts.id = t.to_holder_id
+		JOIN holders c ON c.id = CASE
+			WHEN fs.id IS NULL THEN t.from_holder_id
+			ELSE t.to_holder_id
+		END
+		WHERE (fs.id IS NULL) <> (ts.id IS NULL)
+		AND t.timestamp >= $2 AND t.timestamp < $3
+		AND ` + notSplitCondition + `
+		GROUP BY c.id, c.name, c.identifier
+		ORDER BY SUM(t.amount) DESC, c.id ASC
+		LIMIT $4`
+	var counterparties []CounterpartyTotal
+	err := sqlx.SelectContext(ctx, db, &counterparties, query, householdID, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select top counterparties: %w", err)
+	}
+	return counterparties, nil
+}
@@ -0,0 +1,56 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func GetRules(ctx context.Context, db sqlx.QueryerContext, householdID int) ([]Rule, error) {
+	var rules []Rule
+	const query = "SELECT * FROM rules WHERE household_id = $1 ORDER BY id ASC"
+	err := sqlx.SelectContext(ctx, db, &rules, query, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select rules: %w", err)
+	}
+	return rules, nil
+}
+
+// InsertRule inserts the rule into the household. Its tag must belong to it.
+func InsertRule(ctx context.Context, db sqlx.ExtContext, householdID int, createRule CreateRule) (*Rule, error) {
+	if err := checkReference(ctx, db, "tags", householdID, &createRule.TagID); err != nil {
+		return nil, err
+	}
+	query := `
+		INSERT INTO rules (household_id, name, tag_id, conditions, enabled)
+		VALUES (:household_id, :name, :tag_id, :conditions, :enabled)
+		RETURNING *`
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, Rule{
+		CreateRule:  createRule,
+		HouseholdID: householdID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("insert rule: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("no rule returned")
+	}
+	var rule Rule
+	err = rows.StructScan(&rule)
+	if err != nil {
+		return nil, fmt.Errorf("struct scan: %w", err)
+	}
+	return &rule, nil
+}
+
+func DeleteRule(ctx context.Context, db sqlx.ExecerContext, householdID, id int) error {
+	const query = "DELETE FROM rules WHERE id = $1 AND household_id = $2"
+	result, err := db.ExecContext(ctx, query, id, householdID)
+	if err != nil {
+		return fmt.Errorf("delete rule: %w", err)
+	}
+	return expectAffected(result)
+}
@@ -0,0 +1,27 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SchemaVersion is the version of cmd/dbseed/seed.sql this code expects.
+const SchemaVersion = 3
+
+// GetSchemaVersion returns the version the database was seeded with. It's 0
+// if the database was seeded before versions were recorded.
+func GetSchemaVersion(ctx context.Context, dbConn sqlx.QueryerContext) (int, error) {
+	var version int
+	err := sqlx.GetContext(ctx, dbConn, &version, "SELECT version FROM schema_version")
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return version, nil
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrSplitSum is returned when the parts of a split don't add up to the
+// amount of the split transaction.
+var ErrSplitSum = errors.New("split amounts don't sum up to the transaction amount")
+
+// ErrSplitAmount is returned when the amount of a split transaction or of
+// one of its parts would change without splitting it again.
+var ErrSplitAmount = errors.New("the amount of a split transaction can only be changed by splitting it again")
+
+// ErrSplitPart is returned when the holders or dates of a part of a split
+// would change, or a part would be deleted on its own. Parts follow their
+// split transaction.
+var ErrSplitPart = errors.New("the parts of a split transaction can only be changed by splitting it again")
+
+// notSplitCondition filters out transactions of the alias t that are split,
+// so reports count their parts instead.
+const notSplitCondition = `NOT EXISTS (
+	SELECT 1 FROM transactions split_part WHERE split_part.parent_transaction_id = t.id
+)`
+
+// SplitPart is one part of a split transaction.
+type SplitPart struct {
+	AmountInCents int
+	Note          string
+	TagIDs        []int
+}
+
+// GetTransactionSplits returns the parts of the split transaction.
+func GetTransactionSplits(ctx context.Context, db sqlx.QueryerContext, householdID, parentID int) ([]Transaction, error) {
+	var parts []Transaction
+	const query = `
+		SELECT * FROM transactions
+		WHERE parent_transaction_id = $1 AND household_id = $2
+		ORDER BY id ASC`
+	err := sqlx.SelectContext(ctx, db, &parts, query, parentID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select transaction splits: %w", err)
+	}
+	return parts, nil
+}
+
+// SplitTransaction replaces the parts of the transaction with the given
+// ones. The parts keep the holders and dates of the parent and their amounts
+// must add up to its amount. Without parts the split is removed.
+func SplitTransaction(ctx context.Context, db sqlx.ExtContext, householdID, parentID int, parts []SplitPart) ([]Transaction, error) {
+	parent, ok, err := GetTransaction(ctx, db, householdID, parentID)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction: %w", err)
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if parent.ParentTransactionID != nil {
+		return nil, fmt.Errorf("transaction %d is already a part of transaction %d",
+			parentID, *parent.ParentTransactionID)
+	}
+
+	if len(parts) == 1 {
+		return nil, fmt.Errorf("a split needs at least two parts")
+	}
+	sum := 0
+	for i, part := range parts {
+		if part.AmountInCents <= 0 {
+			return nil, fmt.Errorf("amount of part %d must be positive", i)
+		}
+		sum += part.AmountInCents
+	}
+	if len(parts) > 0 && sum != parent.AmountInCents {
+		return nil, fmt.Errorf("%w: %d instead of %d", ErrSplitSum, sum, parent.AmountInCents)
+	}
+
+	const deleteQuery = "DELETE FROM transactions WHERE parent_transaction_id = $1 AND household_id = $2"
+	if _, err := db.ExecContext(ctx, deleteQuery, parentID, householdID); err != nil {
+		return nil, fmt.Errorf("delete old parts: %w", err)
+	}
+
+	created := make([]Transaction, 0, len(parts))
+	for i, part := range parts {
+		create := Transaction{
+			CreateTransaction: CreateTransaction{
+				BaseTransaction: BaseTransaction{
+					AmountInCents:       part.AmountInCents,
+					Timestamp:           parent.Timestamp,
+					BookingDate:         parent.BookingDate,
+					ValueDate:           parent.ValueDate,
+					Note:                part.Note,
+					ParentTransactionID: &parent.ID,
+				},
+				FromHolderID: parent.FromHolderID,
+				ToHolderID:   parent.ToHolderID,
+			},
+			HouseholdID: householdID,
+		}
+		query := `
+			INSERT INTO transactions
+				(household_id, from_holder_id, to_holder_id, amount, timestamp, booking_date, value_date,
+				data, note, parent_transaction_id)
+			VALUES (:household_id, :from_holder_id, :to_holder_id, :amount, :timestamp, :booking_date, :value_date,
+				:data, :note, :parent_transaction_id)
+			RETURNING *`
+		rows, err := sqlx.NamedQueryContext(ctx, db, query, create)
+		if err != nil {
+			return nil, fmt.Errorf("insert part %d: %w", i, err)
+		}
+		var transaction Transaction
+		if !rows.Next() {
+			rows.Close()
+			return nil, fmt.Errorf("no part returned")
+		}
+		err = rows.StructScan(&transaction)
+		rows.Close()
+		if err != nil {
+			return nil, fmt.Errorf("struct scan: %w", err)
+		}
+
+		for _, tagID := range part.TagIDs {
+			if err := AttachTransactionTag(ctx, db, householdID, transaction.ID, tagID); err != nil {
+				return nil, fmt.Errorf("attach tag to part %d: %w", i, err)
+			}
+		}
+		created = append(created, transaction)
+	}
+	return created, nil
+}
+
+// checkSplitUpdate returns ErrSplitAmount if the transaction is split or a
+// part of a split and its amount would change, and ErrSplitPart if the
+// holders or dates of a part would change. It reports whether the
+// transaction is split.
+func checkSplitUpdate(ctx context.Context, db sqlx.QueryerContext, householdID, id int, update CreateTransaction) (bool, error) {
+	current, ok, err := GetTransaction(ctx, db, householdID, id)
+	if err != nil {
+		return false, err
+	}
+	if !ok {
+		return false, ErrNotFound
+	}
+	var isSplit bool
+	const query = `
+		SELECT EXISTS (
+			SELECT 1 FROM transactions WHERE parent_transaction_id = $1 AND household_id = $2
+		)`
+	if err := sqlx.GetContext(ctx, db, &isSplit, query, id, householdID); err != nil {
+		return false, fmt.Errorf("select split: %w", err)
+	}
+	isPart := current.ParentTransactionID != nil
+	if (isSplit || isPart) && update.AmountInCents != current.AmountInCents {
+		return false, ErrSplitAmount
+	}
+	if isPart && (update.FromHolderID != current.FromHolderID ||
+		update.ToHolderID != current.ToHolderID ||
+		!update.Timestamp.Equal(current.Timestamp) ||
+		!sameDay(update.BookingDate, current.BookingDate) ||
+		!sameDay(update.ValueDate, current.ValueDate)) {
+		return false, ErrSplitPart
+	}
+	return isSplit, nil
+}
+
+// sameDay compares calendar days, which come back from date columns in UTC.
+func sameDay(a, b time.Time) bool {
+	return a.Format(time.DateOnly) == b.Format(time.DateOnly)
+}
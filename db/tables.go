@@ -29,14 +29,32 @@ type CreateHolder struct {
 
 type Holder struct {
 	CreateHolder
-	ID        int
-	CreatedAt time.Time `db:"created_at"`
+	ID          int
+	HouseholdID int       `db:"household_id"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// HolderAlias is an additional identifier of a holder, e.g. another spelling
+// of a payee.
+type HolderAlias struct {
+	HolderIdentifier
+	HolderID    int       `db:"holder_id"`
+	HouseholdID int       `db:"household_id"`
+	CreatedAt   time.Time `db:"created_at"`
 }
 
 type BaseTransaction struct {
-	AmountInCents       int `db:"amount"`
-	Timestamp           time.Time
-	Data                types.NullJSONText
+	AmountInCents int `db:"amount"`
+	Timestamp     time.Time
+	// BookingDate is the calendar day the bank booked the transaction.
+	BookingDate time.Time `db:"booking_date"`
+	// ValueDate is the calendar day the money was credited or debited.
+	ValueDate time.Time `db:"value_date"`
+	Data      types.NullJSONText
+	// Note is a free text written by the user.
+	Note string
+	// ParentTransactionID is set for the parts of a split transaction.
+	// Reports count the parts instead of the parent.
 	ParentTransactionID *int `db:"parent_transaction_id"`
 }
 
@@ -48,13 +66,135 @@ type CreateTransaction struct {
 
 type Transaction struct {
 	CreateTransaction
-	ID        int
-	CreatedAt time.Time `db:"created_at"`
+	ID          int
+	HouseholdID int       `db:"household_id"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Direction of a transaction relative to a holder.
+type Direction string
+
+const (
+	// DirectionIn means the money went to the holder.
+	DirectionIn Direction = "in"
+	// DirectionOut means the money left the holder.
+	DirectionOut Direction = "out"
+	// DirectionInternal means the money moved between two holders of the
+	// same subtree.
+	DirectionInternal Direction = "internal"
+)
+
+// HolderTransaction is a transaction seen from the perspective of a single
+// holder. The stored amount is always positive, so the sign and the
+// counterparty are derived from whether the holder is the sender or the
+// receiver.
+type HolderTransaction struct {
+	Transaction
+	SignedAmountInCents int `db:"signed_amount"`
+	Direction           Direction
+	Counterparty        Holder `db:"counterparty"`
+}
+
+// ListedTransaction is a transaction together with both of its holders.
+type ListedTransaction struct {
+	Transaction
+	From Holder `db:"from"`
+	To   Holder `db:"to"`
+}
+
+type CreateTag struct {
+	Name        string
+	ParentTagID *int `db:"parent_tag_id"`
+}
+
+// CashFlow sums up the money entering and leaving a subtree of holders in a
+// month.
+type CashFlow struct {
+	// Month is the start of the month in the reporting time zone.
+	Month           time.Time
+	IncomeInCents   int `db:"income"`
+	ExpensesInCents int `db:"expenses"`
+	// InternalInCents is the money moved inside the subtree.
+	InternalInCents int `db:"internal"`
+}
+
+// HolderBalance is the sum of all stored transactions of a holder. It only
+// equals the real balance if the whole history of the account is imported.
+type HolderBalance struct {
+	HolderID       int `db:"holder_id"`
+	Name           string
+	BalanceInCents int `db:"balance"`
 }
 
 type Tag struct {
+	CreateTag
 	ID          int
-	Name        string
-	ParentTagID *int      `db:"parent_tag_id"`
+	HouseholdID int       `db:"household_id"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type CreateRule struct {
+	Name  string
+	TagID int `db:"tag_id"`
+	// Conditions is a JSON array of conditions that all have to match, see
+	// the rules package.
+	Conditions types.JSONText
+	Enabled    bool
+}
+
+type Rule struct {
+	CreateRule
+	ID          int
+	HouseholdID int       `db:"household_id"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Household groups the holders, transactions, tags and rules that its
+// members share, e.g. a family.
+type Household struct {
+	ID        int
+	Name      string
+	CreatedAt time.Time `db:"created_at"`
+}
+
+type CreateUser struct {
+	Name string
+	// PasswordHash is a bcrypt hash, see the auth package. It is empty for
+	// users that can only log in with OpenID Connect.
+	PasswordHash string `db:"password_hash"`
+	Admin        bool
+}
+
+type User struct {
+	CreateUser
+	ID int
+	// OIDCSubject identifies users logging in with OpenID Connect.
+	OIDCSubject *string   `db:"oidc_subject"`
 	CreatedAt   time.Time `db:"created_at"`
 }
+
+// Session is a login of a user in the browser.
+type Session struct {
+	// TokenHash is the SHA-256 hash of the session cookie.
+	TokenHash []byte `db:"token_hash"`
+	UserID    int    `db:"user_id"`
+	// HouseholdID is the household the user is looking at.
+	HouseholdID int `db:"household_id"`
+	// CSRFToken has to be sent with every request that changes data.
+	CSRFToken string    `db:"csrf_token"`
+	ExpiresAt time.Time `db:"expires_at"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// APIToken authenticates scripts against the JSON API.
+type APIToken struct {
+	ID     int
+	UserID int `db:"user_id"`
+	// HouseholdID is the only household the token can access.
+	HouseholdID int `db:"household_id"`
+	Name        string
+	// TokenHash is the SHA-256 hash of the token.
+	TokenHash  []byte     `db:"token_hash"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
@@ -0,0 +1,287 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrTagCycle is returned when a tag would become its own ancestor.
+var ErrTagCycle = errors.New("tag would become its own ancestor")
+
+// tagSubtreeCTE selects the ids of the tag $1 and all of its descendants as
+// the common table expression tag_subtree.
+const tagSubtreeCTE = `
+	WITH RECURSIVE tag_subtree (id) AS (
+		SELECT id FROM tags WHERE id = $1
+		UNION
+		SELECT tags.id FROM tags
+		JOIN tag_subtree ON tags.parent_tag_id = tag_subtree.id
+	)`
+
+// tagSubtreeSelect selects the ids of the tag with the given placeholder and
+// all of its descendants. It can be used as a subquery.
+func tagSubtreeSelect(placeholder string) string {
+	return strings.Replace(tagSubtreeCTE, "$1", placeholder, 1) + `
+		SELECT id FROM tag_subtree`
+}
+
+func GetTag(ctx context.Context, db sqlx.QueryerContext, householdID, id int) (*Tag, bool, error) {
+	var tag Tag
+	const query = "SELECT * FROM tags WHERE id = $1 AND household_id = $2"
+	err := sqlx.GetContext(ctx, db, &tag, query, id, householdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select tag: %w", err)
+	}
+	return &tag, true, nil
+}
+
+// ListTags returns up to limit tags of the household with an id greater than
+// afterID, ordered by id.
+func ListTags(ctx context.Context, db sqlx.QueryerContext, householdID int, afterID int, limit int) ([]Tag, error) {
+	var tags []Tag
+	const query = `
+		SELECT * FROM tags
+		WHERE household_id = $1 AND id > $2
+		ORDER BY id ASC LIMIT $3`
+	err := sqlx.SelectContext(ctx, db, &tags, query, householdID, afterID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("select tags: %w", err)
+	}
+	return tags, nil
+}
+
+func GetTags(ctx context.Context, db sqlx.QueryerContext, householdID int) ([]Tag, error) {
+	var tags []Tag
+	const query = "SELECT * FROM tags WHERE household_id = $1 ORDER BY name ASC, id ASC"
+	err := sqlx.SelectContext(ctx, db, &tags, query, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select tags: %w", err)
+	}
+	return tags, nil
+}
+
+func InsertTag(ctx context.Context, db sqlx.ExtContext, householdID int, createTag CreateTag) (*Tag, error) {
+	if err := checkReference(ctx, db, "tags", householdID, createTag.ParentTagID); err != nil {
+		return nil, err
+	}
+	query := `
+		INSERT INTO tags (household_id, name, parent_tag_id)
+		VALUES (:household_id, :name, :parent_tag_id)
+		RETURNING *`
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, Tag{
+		CreateTag:   createTag,
+		HouseholdID: householdID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("insert tag: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("no tag returned")
+	}
+	var tag Tag
+	err = rows.StructScan(&tag)
+	if err != nil {
+		return nil, fmt.Errorf("struct scan: %w", err)
+	}
+	return &tag, nil
+}
+
+func RenameTag(ctx context.Context, db sqlx.ExecerContext, householdID, id int, name string) error {
+	const query = "UPDATE tags SET name = $2 WHERE id = $1 AND household_id = $3"
+	result, err := db.ExecContext(ctx, query, id, name, householdID)
+	if err != nil {
+		return fmt.Errorf("update tag: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// MoveTag changes the parent of the tag. A nil parent makes it a root tag.
+// It returns ErrTagCycle if the new parent is the tag itself or one of its
+// descendants.
+func MoveTag(ctx context.Context, db sqlx.ExtContext, householdID, id int, parentTagID *int) error {
+	if err := checkReference(ctx, db, "tags", householdID, parentTagID); err != nil {
+		return err
+	}
+	if parentTagID != nil {
+		var isDescendant bool
+		query := tagSubtreeCTE + `
+			SELECT EXISTS (SELECT 1 FROM tag_subtree WHERE id = $2)`
+		err := sqlx.GetContext(ctx, db, &isDescendant, query, id, *parentTagID)
+		if err != nil {
+			return fmt.Errorf("select tag subtree: %w", err)
+		}
+		if isDescendant {
+			return ErrTagCycle
+		}
+	}
+
+	const query = "UPDATE tags SET parent_tag_id = $2 WHERE id = $1 AND household_id = $3"
+	result, err := db.ExecContext(ctx, query, id, parentTagID, householdID)
+	if err != nil {
+		return fmt.Errorf("update tag: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// DeleteTag deletes the tag. Its children are moved up to the parent of the
+// deleted tag, so the rest of the hierarchy stays intact.
+func DeleteTag(ctx context.Context, db sqlx.ExecerContext, householdID, id int) error {
+	const moveChildren = `
+		UPDATE tags SET parent_tag_id = (
+			SELECT parent_tag_id FROM tags WHERE id = $1
+		)
+		WHERE parent_tag_id = $1 AND household_id = $2`
+	_, err := db.ExecContext(ctx, moveChildren, id, householdID)
+	if err != nil {
+		return fmt.Errorf("move children: %w", err)
+	}
+
+	const query = "DELETE FROM tags WHERE id = $1 AND household_id = $2"
+	result, err := db.ExecContext(ctx, query, id, householdID)
+	if err != nil {
+		return fmt.Errorf("delete tag: %w", err)
+	}
+	return expectAffected(result)
+}
+
+// checkTagging returns ErrNotFound unless the row of the table and the tag
+// both belong to the household.
+func checkTagging(ctx context.Context, db sqlx.QueryerContext, table string, householdID, id, tagID int) error {
+	ok, err := inHousehold(ctx, db, table, householdID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	ok, err = inHousehold(ctx, db, "tags", householdID, tagID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func AttachHolderTag(ctx context.Context, db sqlx.ExtContext, householdID, holderID, tagID int) error {
+	if err := checkTagging(ctx, db, "holders", householdID, holderID, tagID); err != nil {
+		return err
+	}
+	const query = `
+		INSERT INTO holders_tags (household_id, holder_id, tag_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+	_, err := db.ExecContext(ctx, query, householdID, holderID, tagID)
+	if err != nil {
+		return fmt.Errorf("insert holder tag: %w", err)
+	}
+	return nil
+}
+
+func DetachHolderTag(ctx context.Context, db sqlx.ExecerContext, householdID, holderID, tagID int) error {
+	const query = `
+		DELETE FROM holders_tags
+		WHERE holder_id = $1 AND tag_id = $2 AND household_id = $3`
+	_, err := db.ExecContext(ctx, query, holderID, tagID, householdID)
+	if err != nil {
+		return fmt.Errorf("delete holder tag: %w", err)
+	}
+	return nil
+}
+
+func GetHolderTags(ctx context.Context, db sqlx.QueryerContext, householdID, holderID int) ([]Tag, error) {
+	var tags []Tag
+	const query = `
+		SELECT tags.* FROM tags
+		JOIN holders_tags ON holders_tags.tag_id = tags.id
+		WHERE holders_tags.holder_id = $1 AND tags.household_id = $2
+		ORDER BY tags.name ASC, tags.id ASC`
+	err := sqlx.SelectContext(ctx, db, &tags, query, holderID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select holder tags: %w", err)
+	}
+	return tags, nil
+}
+
+func AttachTransactionTag(ctx context.Context, db sqlx.ExtContext, householdID, transactionID, tagID int) error {
+	if err := checkTagging(ctx, db, "transactions", householdID, transactionID, tagID); err != nil {
+		return err
+	}
+	const query = `
+		INSERT INTO transactions_tags (household_id, transaction_id, tag_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING`
+	_, err := db.ExecContext(ctx, query, householdID, transactionID, tagID)
+	if err != nil {
+		return fmt.Errorf("insert transaction tag: %w", err)
+	}
+	return nil
+}
+
+func DetachTransactionTag(ctx context.Context, db sqlx.ExecerContext, householdID, transactionID, tagID int) error {
+	const query = `
+		DELETE FROM transactions_tags
+		WHERE transaction_id = $1 AND tag_id = $2 AND household_id = $3`
+	_, err := db.ExecContext(ctx, query, transactionID, tagID, householdID)
+	if err != nil {
+		return fmt.Errorf("delete transaction tag: %w", err)
+	}
+	return nil
+}
+
+func GetTransactionTags(ctx context.Context, db sqlx.QueryerContext, householdID, transactionID int) ([]Tag, error) {
+	var tags []Tag
+	const query = `
+		SELECT tags.* FROM tags
+		JOIN transactions_tags ON transactions_tags.tag_id = tags.id
+		WHERE transactions_tags.transaction_id = $1 AND tags.household_id = $2
+		ORDER BY tags.name ASC, tags.id ASC`
+	err := sqlx.SelectContext(ctx, db, &tags, query, transactionID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select transaction tags: %w", err)
+	}
+	return tags, nil
+}
+
+// GetTransactionsByTag returns the transactions of the household tagged with
+// the tag or any of its descendants, newest first.
+func GetTransactionsByTag(ctx context.Context, db sqlx.QueryerContext, householdID, tagID int) ([]Transaction, error) {
+	var transactions []Transaction
+	query := tagSubtreeCTE + `
+		SELECT t.* FROM transactions t
+		WHERE t.id IN (
+			SELECT transaction_id FROM transactions_tags
+			JOIN tag_subtree ON tag_subtree.id = transactions_tags.tag_id
+		)
+		AND t.household_id = $2
+		AND ` + notSplitCondition + `
+		ORDER BY t.timestamp DESC, t.id DESC`
+	err := sqlx.SelectContext(ctx, db, &transactions, query, tagID, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select transactions by tag: %w", err)
+	}
+	return transactions, nil
+}
+
+// expectAffected returns ErrNotFound if the statement didn't change any row.
+func expectAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
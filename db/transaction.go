@@ -2,13 +2,30 @@ package db
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/Opsi/sparschwein/util"
 	"github.com/jmoiron/sqlx"
 )
 
-func DoesTransactionExist(ctx context.Context, db sqlx.QueryerContext, transaction CreateTransaction) (bool, error) {
+func GetTransaction(ctx context.Context, db sqlx.QueryerContext, householdID, id int) (*Transaction, bool, error) {
+	var transaction Transaction
+	const query = "SELECT * FROM transactions WHERE id = $1 AND household_id = $2"
+	err := sqlx.GetContext(ctx, db, &transaction, query, id, householdID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select transaction: %w", err)
+	}
+	return &transaction, true, nil
+}
+
+func DoesTransactionExist(ctx context.Context, db sqlx.QueryerContext, householdID int, transaction CreateTransaction) (bool, error) {
 	// check if the transaction exists
 	var selected Transaction
 	query := `
@@ -16,9 +33,12 @@ func DoesTransactionExist(ctx context.Context, db sqlx.QueryerContext, transacti
 		WHERE from_holder_id = $1
 		AND to_holder_id = $2
 		AND amount = $3
-		AND timestamp = $4`
+		AND timestamp = $4
+		AND household_id = $5
+		AND parent_transaction_id IS NULL`
 	rows, err := db.QueryxContext(ctx, query,
-		transaction.FromHolderID, transaction.ToHolderID, transaction.AmountInCents, transaction.Timestamp)
+		transaction.FromHolderID, transaction.ToHolderID, transaction.AmountInCents, transaction.Timestamp,
+		householdID)
 	if err != nil {
 		return false, fmt.Errorf("select transactions: %w", err)
 	}
@@ -42,23 +62,31 @@ func DoesTransactionExist(ctx context.Context, db sqlx.QueryerContext, transacti
 	return false, nil
 }
 
-func InsertTransaction(ctx context.Context, dbConn sqlx.ExtContext, create CreateTransaction) (*Transaction, error) {
+// InsertTransaction inserts the transaction into the household. Both holders
+// must belong to it. It returns ErrDuplicate if the household already has
+// the same transaction.
+func InsertTransaction(ctx context.Context, dbConn sqlx.ExtContext, householdID int, create CreateTransaction) (*Transaction, error) {
 	// check if the transaction exists
-	exists, err := DoesTransactionExist(ctx, dbConn, create)
+	exists, err := DoesTransactionExist(ctx, dbConn, householdID, create)
 	if err != nil {
 		return nil, fmt.Errorf("does transaction exist: %w", err)
 	}
 	if exists {
-		return nil, fmt.Errorf("transaction already exists")
+		return nil, ErrDuplicate
 	}
 
 	// insert the transaction
 	query := `
 		INSERT INTO transactions
-			(from_holder_id, to_holder_id, amount, timestamp, data)
-	        VALUES (:from_holder_id, :to_holder_id, :amount, :timestamp, :data)
+			(household_id, from_holder_id, to_holder_id, amount, timestamp, booking_date, value_date,
+			data, note, parent_transaction_id)
+	        VALUES (:household_id, :from_holder_id, :to_holder_id, :amount, :timestamp, :booking_date, :value_date,
+			:data, :note, :parent_transaction_id)
 			RETURNING *`
-	rows, err := sqlx.NamedQueryContext(ctx, dbConn, query, create)
+	rows, err := sqlx.NamedQueryContext(ctx, dbConn, query, Transaction{
+		CreateTransaction: create,
+		HouseholdID:       householdID,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("insert transaction: %w", err)
 	}
@@ -75,3 +103,323 @@ func InsertTransaction(ctx context.Context, dbConn sqlx.ExtContext, create Creat
 	}
 	return &transaction, nil
 }
+
+// HolderTransactionFilter restricts the transactions returned by
+// GetHolderTransactions. Zero values don't filter.
+type HolderTransactionFilter struct {
+	// From is the inclusive lower bound of the timestamp.
+	From *time.Time
+	// To is the exclusive upper bound of the timestamp.
+	To *time.Time
+	// Direction only keeps incoming or outgoing transactions.
+	Direction Direction
+}
+
+// GetHolderTransactions returns the transactions of the given holder with
+// the amount signed from its perspective, newest first.
+func GetHolderTransactions(ctx context.Context, db sqlx.QueryerContext, householdID, holderID int, filter HolderTransactionFilter) ([]HolderTransaction, error) {
+	query := `
+		SELECT t.*,
+			CASE WHEN t.to_holder_id = $1 THEN t.amount ELSE -t.amount END AS signed_amount,
+			CASE WHEN t.to_holder_id = $1 THEN 'in' ELSE 'out' END AS direction,
+			` + holderColumns("c", "counterparty") + `
+		FROM transactions t
+		JOIN holders c ON c.id = CASE
+			WHEN t.to_holder_id = $1 THEN t.from_holder_id
+			ELSE t.to_holder_id
+		END
+		WHERE (t.from_holder_id = $1 OR t.to_holder_id = $1)
+		AND t.household_id = $2
+		AND ` + notSplitCondition
+	args := []any{holderID, householdID}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		query += fmt.Sprintf(" AND t.timestamp >= $%d", len(args))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		query += fmt.Sprintf(" AND t.timestamp < $%d", len(args))
+	}
+	switch filter.Direction {
+	case "":
+	case DirectionIn:
+		query += " AND t.to_holder_id = $1"
+	case DirectionOut:
+		query += " AND t.from_holder_id = $1"
+	default:
+		return nil, fmt.Errorf("unknown direction %q", filter.Direction)
+	}
+	query += " ORDER BY t.timestamp DESC, t.id DESC"
+
+	var transactions []HolderTransaction
+	err := sqlx.SelectContext(ctx, db, &transactions, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select holder transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+// GetTransactions returns all transactions of the household, oldest first.
+func GetTransactions(ctx context.Context, db sqlx.QueryerContext, householdID int) ([]Transaction, error) {
+	var transactions []Transaction
+	const query = `
+		SELECT * FROM transactions
+		WHERE household_id = $1
+		ORDER BY timestamp ASC, id ASC`
+	err := sqlx.SelectContext(ctx, db, &transactions, query, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("select transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+// TransactionSort is the order of ListTransactions.
+type TransactionSort string
+
+const (
+	SortByDate   TransactionSort = "date"
+	SortByAmount TransactionSort = "amount"
+)
+
+// TransactionCursor points to the last transaction of a page.
+type TransactionCursor struct {
+	Timestamp     time.Time
+	AmountInCents int
+	ID            int
+}
+
+// Cursor returns the cursor to continue a listing after the transaction.
+func (t Transaction) Cursor() TransactionCursor {
+	return TransactionCursor{
+		Timestamp:     t.Timestamp,
+		AmountInCents: t.AmountInCents,
+		ID:            t.ID,
+	}
+}
+
+// TransactionFilter restricts the transactions returned by ListTransactions.
+// Zero values don't filter.
+type TransactionFilter struct {
+	// HolderID only keeps transactions from or to the holder.
+	HolderID *int
+	// Direction only keeps transactions to (in) or from (out) the holder of
+	// HolderID.
+	Direction Direction
+	// From is the inclusive lower bound of the timestamp.
+	From *time.Time
+	// To is the exclusive upper bound of the timestamp.
+	To *time.Time
+	// TagID only keeps transactions tagged with the tag or its descendants.
+	TagID *int
+	// MinAmountInCents and MaxAmountInCents are inclusive bounds of the
+	// (always positive) amount.
+	MinAmountInCents *int
+	MaxAmountInCents *int
+	// Text is searched in the note, the purpose in the data and the names of
+	// both holders, ignoring case.
+	Text string
+	// Sort defaults to SortByDate. Ties are ordered by id.
+	Sort TransactionSort
+	// Ascending lists the oldest or smallest transactions first.
+	Ascending bool
+	// After continues the listing after the transaction of the cursor. The
+	// cursor must come from a listing with the same sort order.
+	After *TransactionCursor
+	// Limit is the maximum number of transactions returned.
+	Limit int
+}
+
+// Validate checks the combination of the options.
+func (f TransactionFilter) Validate() error {
+	switch f.Direction {
+	case "":
+	case DirectionIn, DirectionOut:
+		if f.HolderID == nil {
+			return fmt.Errorf("direction needs a holder")
+		}
+	default:
+		return fmt.Errorf("unknown direction %q", f.Direction)
+	}
+	switch f.Sort {
+	case "", SortByDate, SortByAmount:
+	default:
+		return fmt.Errorf("unknown sort %q", f.Sort)
+	}
+	return nil
+}
+
+// ListTransactions returns a page of transactions of the household matching
+// the filter, newest first unless sorted differently. Split transactions are
+// replaced by their parts.
+func ListTransactions(ctx context.Context, db sqlx.QueryerContext, householdID int, filter TransactionFilter) ([]ListedTransaction, error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	query := `
+		SELECT t.*, ` + holderColumns("fh", "from") + `, ` + holderColumns("th", "to") + `
+		FROM transactions t
+		JOIN holders fh ON fh.id = t.from_holder_id
+		JOIN holders th ON th.id = t.to_holder_id
+		WHERE t.household_id = $1
+		AND ` + notSplitCondition
+	args := []any{householdID}
+	addCondition := func(condition string, arg any) {
+		args = append(args, arg)
+		query += " AND " + strings.ReplaceAll(condition, "?", fmt.Sprintf("$%d", len(args)))
+	}
+	if filter.HolderID != nil {
+		switch filter.Direction {
+		case "":
+			addCondition("(t.from_holder_id = ? OR t.to_holder_id = ?)", *filter.HolderID)
+		case DirectionIn:
+			addCondition("t.to_holder_id = ?", *filter.HolderID)
+		case DirectionOut:
+			addCondition("t.from_holder_id = ?", *filter.HolderID)
+		}
+	}
+	if filter.From != nil {
+		addCondition("t.timestamp >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		addCondition("t.timestamp < ?", *filter.To)
+	}
+	if filter.TagID != nil {
+		addCondition(`t.id IN (
+			SELECT transaction_id FROM transactions_tags
+			WHERE tag_id IN (`+tagSubtreeSelect("?")+`)
+		)`, *filter.TagID)
+	}
+	if filter.MinAmountInCents != nil {
+		addCondition("t.amount >= ?", *filter.MinAmountInCents)
+	}
+	if filter.MaxAmountInCents != nil {
+		addCondition("t.amount <= ?", *filter.MaxAmountInCents)
+	}
+	if filter.Text != "" {
+		addCondition(`(t.note ILIKE ?
+			OR COALESCE(t.data->>'Purpose', t.data->>'purpose') ILIKE ?
+			OR fh.name ILIKE ? OR th.name ILIKE ?)`, likePattern(filter.Text))
+	}
+
+	sortColumn := "t.timestamp"
+	if filter.Sort == SortByAmount {
+		sortColumn = "t.amount"
+	}
+	order, comparison := "DESC", "<"
+	if filter.Ascending {
+		order, comparison = "ASC", ">"
+	}
+	if filter.After != nil {
+		var sortValue any = filter.After.Timestamp
+		if sortColumn == "t.amount" {
+			sortValue = filter.After.AmountInCents
+		}
+		args = append(args, sortValue, filter.After.ID)
+		query += fmt.Sprintf(" AND (%s, t.id) %s ($%d, $%d)",
+			sortColumn, comparison, len(args)-1, len(args))
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s, t.id %s", sortColumn, order, order)
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	var transactions []ListedTransaction
+	err := sqlx.SelectContext(ctx, db, &transactions, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("select transactions: %w", err)
+	}
+	return transactions, nil
+}
+
+// likePattern escapes the text for ILIKE and matches it anywhere.
+func likePattern(text string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(text)
+	return "%" + escaped + "%"
+}
+
+// UpdateTransaction replaces all user editable columns of the transaction.
+// The holders must belong to the household of the transaction. The parts of
+// a split transaction get its new holders and dates. It returns
+// ErrSplitAmount if the amount of a split or of a part changes and
+// ErrSplitPart if the holders or dates of a part change, see
+// SplitTransaction.
+func UpdateTransaction(ctx context.Context, db sqlx.ExtContext, householdID, id int, update CreateTransaction) (*Transaction, error) {
+	isSplit, err := checkSplitUpdate(ctx, db, householdID, id, update)
+	if err != nil {
+		return nil, err
+	}
+	query := `
+		UPDATE transactions SET
+			from_holder_id = :from_holder_id,
+			to_holder_id = :to_holder_id,
+			amount = :amount,
+			timestamp = :timestamp,
+			booking_date = :booking_date,
+			value_date = :value_date,
+			data = :data,
+			note = :note
+		WHERE id = :id AND household_id = :household_id
+		RETURNING *`
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, Transaction{
+		CreateTransaction: update,
+		ID:                id,
+		HouseholdID:       householdID,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("update transaction: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, ErrNotFound
+	}
+	var transaction Transaction
+	err = rows.StructScan(&transaction)
+	if err != nil {
+		return nil, fmt.Errorf("struct scan: %w", err)
+	}
+	rows.Close()
+	if !isSplit {
+		return &transaction, nil
+	}
+
+	const partsQuery = `
+		UPDATE transactions SET
+			from_holder_id = $3,
+			to_holder_id = $4,
+			timestamp = $5,
+			booking_date = $6,
+			value_date = $7
+		WHERE parent_transaction_id = $1 AND household_id = $2`
+	_, err = db.ExecContext(ctx, partsQuery, id, householdID, transaction.FromHolderID, transaction.ToHolderID,
+		transaction.Timestamp, transaction.BookingDate, transaction.ValueDate)
+	if err != nil {
+		return nil, fmt.Errorf("update parts: %w", err)
+	}
+	return &transaction, nil
+}
+
+// DeleteTransaction deletes the transaction together with its parts if it
+// is split. It returns ErrSplitPart for a part, which can only be removed by
+// splitting the transaction again.
+func DeleteTransaction(ctx context.Context, db sqlx.ExtContext, householdID, id int) error {
+	transaction, ok, err := GetTransaction(ctx, db, householdID, id)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	if transaction.ParentTransactionID != nil {
+		return ErrSplitPart
+	}
+	const query = `
+		DELETE FROM transactions
+		WHERE (id = $1 OR parent_transaction_id = $1) AND household_id = $2`
+	result, err := db.ExecContext(ctx, query, id, householdID)
+	if err != nil {
+		return fmt.Errorf("delete transaction: %w", err)
+	}
+	return expectAffected(result)
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func GetUser(ctx context.Context, db sqlx.QueryerContext, id int) (*User, bool, error) {
+	var user User
+	const query = "SELECT * FROM users WHERE id = $1"
+	err := sqlx.GetContext(ctx, db, &user, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select user: %w", err)
+	}
+	return &user, true, nil
+}
+
+func GetUserByName(ctx context.Context, db sqlx.QueryerContext, name string) (*User, bool, error) {
+	var user User
+	const query = "SELECT * FROM users WHERE name = $1"
+	err := sqlx.GetContext(ctx, db, &user, query, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select user: %w", err)
+	}
+	return &user, true, nil
+}
+
+// GetUserByOIDCSubject returns the user the issuer knows by the subject.
+func GetUserByOIDCSubject(ctx context.Context, db sqlx.QueryerContext, subject string) (*User, bool, error) {
+	var user User
+	const query = "SELECT * FROM users WHERE oidc_subject = $1"
+	err := sqlx.GetContext(ctx, db, &user, query, subject)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select user: %w", err)
+	}
+	return &user, true, nil
+}
+
+func GetUsers(ctx context.Context, db sqlx.QueryerContext) ([]User, error) {
+	var users []User
+	const query = "SELECT * FROM users ORDER BY id ASC"
+	err := sqlx.SelectContext(ctx, db, &users, query)
+	if err != nil {
+		return nil, fmt.Errorf("select users: %w", err)
+	}
+	return users, nil
+}
+
+func InsertUser(ctx context.Context, db sqlx.ExtContext, createUser CreateUser) (*User, error) {
+	query := `
+		INSERT INTO users (name, password_hash, admin)
+		VALUES (:name, :password_hash, :admin)
+		RETURNING *`
+	rows, err := sqlx.NamedQueryContext(ctx, db, query, createUser)
+	if err != nil {
+		return nil, fmt.Errorf("insert user: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, fmt.Errorf("no user returned")
+	}
+	var user User
+	err = rows.StructScan(&user)
+	if err != nil {
+		return nil, fmt.Errorf("struct scan: %w", err)
+	}
+	return &user, nil
+}
+
+// SetUserPassword replaces the password hash and ends all sessions of the
+// user.
+func SetUserPassword(ctx context.Context, db sqlx.ExecerContext, id int, passwordHash string) error {
+	const query = "UPDATE users SET password_hash = $2 WHERE id = $1"
+	result, err := db.ExecContext(ctx, query, id, passwordHash)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	if err := expectAffected(result); err != nil {
+		return err
+	}
+	const deleteSessions = "DELETE FROM sessions WHERE user_id = $1"
+	_, err = db.ExecContext(ctx, deleteSessions, id)
+	if err != nil {
+		return fmt.Errorf("delete sessions: %w", err)
+	}
+	return nil
+}
+
+// SetUserOIDCSubject links the user to the subject of the issuer.
+func SetUserOIDCSubject(ctx context.Context, db sqlx.ExecerContext, id int, subject string) error {
+	const query = "UPDATE users SET oidc_subject = $2 WHERE id = $1"
+	result, err := db.ExecContext(ctx, query, id, subject)
+	if err != nil {
+		return fmt.Errorf("update user: %w", err)
+	}
+	return expectAffected(result)
+}
+
+func DeleteUser(ctx context.Context, db sqlx.ExecerContext, id int) error {
+	const query = "DELETE FROM users WHERE id = $1"
+	result, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("delete user: %w", err)
+	}
+	return expectAffected(result)
+}
+
+func InsertSession(ctx context.Context, db sqlx.ExtContext, session Session) error {
+	query := `
+		INSERT INTO sessions (token_hash, user_id, household_id, csrf_token, expires_at)
+		VALUES (:token_hash, :user_id, :household_id, :csrf_token, :expires_at)`
+	_, err := sqlx.NamedExecContext(ctx, db, query, session)
+	if err != nil {
+		return fmt.Errorf("insert session: %w", err)
+	}
+	return nil
+}
+
+// GetSession returns the session with the hash if it hasn't expired yet.
+func GetSession(ctx context.Context, db sqlx.QueryerContext, tokenHash []byte) (*Session, bool, error) {
+	var session Session
+	const query = "SELECT * FROM sessions WHERE token_hash = $1 AND expires_at > NOW()"
+	err := sqlx.GetContext(ctx, db, &session, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("select session: %w", err)
+	}
+	return &session, true, nil
+}
+
+// SetSessionHousehold switches the household the session is looking at.
+func SetSessionHousehold(ctx context.Context, db sqlx.ExecerContext, tokenHash []byte, householdID int) error {
+	const query = "UPDATE sessions SET household_id = $2 WHERE token_hash = $1"
+	result, err := db.ExecContext(ctx, query, tokenHash, householdID)
+	if err != nil {
+		return fmt.Errorf("update session: %w", err)
+	}
+	return expectAffected(result)
+}
+
+func DeleteSession(ctx context.Context, db sqlx.ExecerContext, tokenHash []byte) error {
+	const query = "DELETE FROM sessions WHERE token_hash = $1"
+	_, err := db.ExecContext(ctx, query, tokenHash)
+	if err != nil {
+		return fmt.Errorf("delete session: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpiredSessions removes the sessions that can't be used anymore.
+func DeleteExpiredSessions(ctx context.Context, db sqlx.ExecerContext) error {
+	const query = "DELETE FROM sessions WHERE expires_at <= NOW()"
+	_, err := db.ExecContext(ctx, query)
+	if err != nil {
+		return fmt.Errorf("delete expired sessions: %w", err)
+	}
+	return nil
+}
+
+// InsertAPIToken stores a token of the user that can access the household.
+func InsertAPIToken(ctx context.Context, db sqlx.QueryerContext, userID, householdID int, name string, tokenHash []byte) (*APIToken, error) {
+	var token APIToken
+	const query = `
+		INSERT INTO api_tokens (user_id, household_id, name, token_hash)
+		VALUES ($1, $2, $3, $4)
+		RETURNING *`
+	err := sqlx.GetContext(ctx, db, &token, query, userID, householdID, name, tokenHash)
+	if err != nil {
+		return nil, fmt.Errorf("insert api token: %w", err)
+	}
+	return &token, nil
+}
+
+func GetAPITokens(ctx context.Context, db sqlx.QueryerContext) ([]APIToken, error) {
+	var tokens []APIToken
+	const query = "SELECT * FROM api_tokens ORDER BY id ASC"
+	err := sqlx.SelectContext(ctx, db, &tokens, query)
+	if err != nil {
+		return nil, fmt.Errorf("select api tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+// UseAPIToken returns the token with the hash and records that it was used.
+func UseAPIToken(ctx context.Context, db sqlx.QueryerContext, tokenHash []byte) (*APIToken, bool, error) {
+	var token APIToken
+	const query = `
+		UPDATE api_tokens SET last_used_at = NOW()
+		WHERE token_hash = $1
+		RETURNING *`
+	err := sqlx.GetContext(ctx, db, &token, query, tokenHash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("update api token: %w", err)
+	}
+	return &token, true, nil
+}
+
+func DeleteAPIToken(ctx context.Context, db sqlx.ExecerContext, id int) error {
+	const query = "DELETE FROM api_tokens WHERE id = $1"
+	result, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("delete api token: %w", err)
+	}
+	return expectAffected(result)
+}
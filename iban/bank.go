@@ -0,0 +1,86 @@
+package iban
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// blzFile are the main entries of the Bankleitzahlendatei of the Deutsche
+// Bundesbank in its fixed width format. The Bundesbank publishes a new file
+// every quarter; cmd/blz converts it, see the README. The file in the
+// repository is still an excerpt with the most common banks until it has
+// been run.
+//
+//go:embed blz.txt
+var blzFile []byte
+
+var (
+	banksOnce sync.Once
+	banks     map[string]Bank
+)
+
+// Bank is an entry of the Bankleitzahlendatei.
+type Bank struct {
+	BLZ  string
+	Name string
+	City string
+	BIC  string
+}
+
+func (b Bank) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("blz", b.BLZ),
+		slog.String("name", b.Name),
+		slog.String("bic", b.BIC),
+	)
+}
+
+// LookupBank returns the bank of a normalized german IBAN.
+func LookupBank(iban string) (Bank, bool) {
+	if len(iban) != countryLengths["DE"] || !strings.HasPrefix(iban, "DE") {
+		return Bank{}, false
+	}
+	banksOnce.Do(func() {
+		banks = parseBLZFile(blzFile)
+	})
+	bank, ok := banks[iban[4:12]]
+	return bank, ok
+}
+
+// parseBLZFile parses the ISO 8859-1 encoded fixed width lines. Only the
+// main entry of every BLZ is kept, branches share its BIC.
+func parseBLZFile(data []byte) map[string]Bank {
+	parsed := make(map[string]Bank)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) < 150 {
+			continue
+		}
+		// 1 marks the main entry, 2 a branch
+		if line[8] != '1' {
+			continue
+		}
+		bank := Bank{
+			BLZ:  latin1Field(line[0:8]),
+			Name: latin1Field(line[9:67]),
+			City: latin1Field(line[72:107]),
+			BIC:  latin1Field(line[139:150]),
+		}
+		parsed[bank.BLZ] = bank
+	}
+	return parsed
+}
+
+// latin1Field decodes an ISO 8859-1 encoded field and trims the padding.
+func latin1Field(latin1 []byte) string {
+	var decoded strings.Builder
+	for _, b := range latin1 {
+		decoded.WriteRune(rune(b))
+	}
+	return strings.TrimSpace(decoded.String())
+}
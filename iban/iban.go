@@ -0,0 +1,165 @@
+package iban
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrUnknownCountry is returned for country codes without IBANs.
+	ErrUnknownCountry = errors.New("unknown country")
+	// ErrInvalidLength is returned if the length doesn't match the country.
+	ErrInvalidLength = errors.New("invalid length")
+	// ErrInvalidCharacters is returned for anything but letters and digits.
+	ErrInvalidCharacters = errors.New("invalid characters")
+	// ErrInvalidChecksum is returned if the mod-97 check fails.
+	ErrInvalidChecksum = errors.New("invalid checksum")
+)
+
+// countryLengths are the IBAN lengths per country as registered with SWIFT.
+var countryLengths = map[string]int{
+	"AD": 24, "AE": 23, "AL": 28, "AT": 20, "AZ": 28, "BA": 20, "BE": 16,
+	"BG": 22, "BH": 22, "BR": 29, "BY": 28, "CH": 21, "CR": 22, "CY": 28,
+	"CZ": 24, "DE": 22, "DK": 18, "DO": 28, "EE": 20, "EG": 29, "ES": 24,
+	"FI": 18, "FO": 18, "FR": 27, "GB": 22, "GE": 22, "GI": 23, "GL": 18,
+	"GR": 27, "GT": 28, "HR": 21, "HU": 28, "IE": 22, "IL": 23, "IQ": 23,
+	"IS": 26, "IT": 27, "JO": 30, "KW": 30, "KZ": 20, "LB": 28, "LC": 32,
+	"LI": 21, "LT": 20, "LU": 20, "LV": 21, "MC": 27, "MD": 24, "ME": 22,
+	"MK": 19, "MR": 27, "MT": 31, "MU": 30, "NL": 18, "NO": 15, "PK": 24,
+	"PL": 28, "PS": 29, "PT": 25, "QA": 29, "RO": 24, "RS": 22, "SA": 24,
+	"SC": 31, "SE": 24, "SI": 19, "SK": 24, "SM": 27, "ST": 25, "SV": 28,
+	"TL": 23, "TN": 24, "TR": 26, "UA": 29, "VA": 22, "VG": 24, "XK": 20,
+}
+
+// prefixRegex finds the country code and check digits that start IBANs in
+// free text.
+var prefixRegex = regexp.MustCompile(`\b[A-Z]{2}\d{2}`)
+
+// Normalize removes all whitespace and converts the IBAN to upper case.
+func Normalize(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// Validate checks the country, the length and the checksum of the
+// normalized IBAN.
+func Validate(iban string) error {
+	if len(iban) < 4 {
+		return ErrInvalidLength
+	}
+	length, ok := countryLengths[iban[:2]]
+	if !ok {
+		return fmt.Errorf("%w %q", ErrUnknownCountry, iban[:2])
+	}
+	if len(iban) != length {
+		return fmt.Errorf("%w: %d instead of %d characters", ErrInvalidLength, len(iban), length)
+	}
+	remainder := mod97(iban[4:] + iban[:4])
+	if remainder < 0 {
+		return ErrInvalidCharacters
+	}
+	if remainder != 1 {
+		return ErrInvalidChecksum
+	}
+	return nil
+}
+
+// ValidCreditorID reports whether the normalized SEPA creditor identifier
+// passes the mod-97 check. The check digits cover the country code and the
+// national identifier, the business code in between is ignored.
+func ValidCreditorID(creditorID string) bool {
+	if len(creditorID) < 8 {
+		return false
+	}
+	return mod97(creditorID[7:]+creditorID[:4]) == 1
+}
+
+// Format groups the normalized IBAN in blocks of four characters for
+// display, e.g. "DE89 3704 0044 0532 0130 00".
+func Format(iban string) string {
+	var formatted strings.Builder
+	for i, r := range iban {
+		if i > 0 && i%4 == 0 {
+			formatted.WriteByte(' ')
+		}
+		formatted.WriteRune(r)
+	}
+	return formatted.String()
+}
+
+// Find returns all valid IBANs in the text. They may be grouped in blocks
+// of four characters and followed by other words, e.g. "IBAN: DE89 3704 0044
+// 0532 0130 00 BIC: COBADEFFXXX".
+func Find(text string) []string {
+	var ibans []string
+	end := 0
+	for _, match := range prefixRegex.FindAllStringIndex(text, -1) {
+		if match[0] < end {
+			continue
+		}
+		candidate, ok := candidate(text[match[0]:])
+		if !ok {
+			continue
+		}
+		iban := Normalize(candidate)
+		if Validate(iban) == nil {
+			ibans = append(ibans, iban)
+			end = match[0] + len(candidate)
+		}
+	}
+	return ibans
+}
+
+// candidate returns as many letters and digits from the start of the text
+// as IBANs of its country have, allowing single spaces between them. It
+// fails if the text is too short or the characters go on without a space.
+func candidate(text string) (string, bool) {
+	length, ok := countryLengths[text[:2]]
+	if !ok {
+		return "", false
+	}
+	characters := 0
+	i := 0
+	for ; i < len(text) && characters < length; i++ {
+		switch {
+		case isAlphanumeric(text[i]):
+			characters++
+		case text[i] == ' ' && i+1 < len(text) && isAlphanumeric(text[i+1]):
+		default:
+			return "", false
+		}
+	}
+	if characters < length || i < len(text) && isAlphanumeric(text[i]) {
+		return "", false
+	}
+	return text[:i], true
+}
+
+func isAlphanumeric(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// mod97 converts letters to numbers (A = 10, ..., Z = 35) and returns the
+// remainder of the resulting number divided by 97. It returns -1 for
+// characters that are neither letters nor digits.
+func mod97(s string) int {
+	var digits strings.Builder
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r >= 'A' && r <= 'Z':
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		default:
+			return -1
+		}
+	}
+	n, ok := new(big.Int).SetString(digits.String(), 10)
+	if !ok {
+		return -1
+	}
+	return int(new(big.Int).Mod(n, big.NewInt(97)).Int64())
+}
@@ -0,0 +1,109 @@
+package iban
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidCreditorID(t *testing.T) {
+	assert.True(t, ValidCreditorID("DE98ZZZ09999999999"))
+	assert.True(t, ValidCreditorID("DE98AAA09999999999"))
+	assert.False(t, ValidCreditorID("DE97ZZZ09999999999"))
+}
+
+func TestFind(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want []string
+	}{
+		{
+			name: "grouped",
+			text: "Miete Oktober IBAN DE89 3704 0044 0532 0130 00 Ref DE12345678901234567890",
+			want: []string{"DE89370400440532013000"},
+		},
+		{
+			name: "followed by a word",
+			text: "MIETE DE89370400440532013000 OKTOBER",
+			want: []string{"DE89370400440532013000"},
+		},
+		{
+			name: "followed by a BIC",
+			text: "IBAN: DE89370400440532013000 BIC: COBADEFFXXX",
+			want: []string{"DE89370400440532013000"},
+		},
+		{
+			name: "grouped and followed by a word",
+			text: "DE89 3704 0044 0532 0130 00 OKTOBER",
+			want: []string{"DE89370400440532013000"},
+		},
+		{
+			name: "several",
+			text: "VON NO9386011117947 AN DE89370400440532013000",
+			want: []string{"NO9386011117947", "DE89370400440532013000"},
+		},
+		{
+			name: "too long",
+			text: "DE893704004405320130001",
+		},
+		{
+			name: "too short",
+			text: "DE89 3704 0044 0532 0130 0",
+		},
+		{
+			name: "no iban",
+			text: "no iban in here",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, Find(tt.text))
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		iban string
+		want error
+	}{
+		{iban: "DE89370400440532013000", want: nil},
+		{iban: "NO9386011117947", want: nil},
+		{iban: "DE8937040044053201300", want: ErrInvalidLength},
+		{iban: "XX89370400440532013000", want: ErrUnknownCountry},
+		{iban: "DE89370400440532013001", want: ErrInvalidChecksum},
+		{iban: "DE89370400440532013-00", want: ErrInvalidCharacters},
+	}
+	for _, tt := range tests {
+		t.Run(tt.iban, func(t *testing.T) {
+			err := Validate(tt.iban)
+			if tt.want == nil {
+				assert.NoError(t, err)
+				return
+			}
+			assert.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func TestFormat(t *testing.T) {
+	assert.Equal(t, "DE89 3704 0044 0532 0130 00", Format("DE89370400440532013000"))
+	assert.Equal(t, "NO93 8601 1117 947", Format("NO9386011117947"))
+}
+
+func TestLookupBank(t *testing.T) {
+	bank, ok := LookupBank("DE89370400440532013000")
+	assert.True(t, ok)
+	assert.Equal(t, Bank{
+		BLZ:  "37040044",
+		Name: "Commerzbank",
+		City: "Köln",
+		BIC:  "COBADEFFXXX",
+	}, bank)
+
+	_, ok = LookupBank("DE89999999990532013000")
+	assert.False(t, ok)
+	_, ok = LookupBank("GB82WEST12345698765432")
+	assert.False(t, ok)
+}
@@ -0,0 +1,60 @@
+// Package testdb gives tests a postgres database of their own.
+package testdb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Env names the environment variable with the connection string of a
+// postgres database the tests may use, e.g.
+// "host=localhost user=postgres dbname=sparschwein_test sslmode=disable".
+// The tests create their tables in a schema of their own and drop it
+// afterwards.
+const Env = "SPARSCHWEIN_TEST_DATABASE"
+
+// Open seeds a new schema and returns a connection using it. The test is
+// skipped if no database is configured.
+func Open(t *testing.T) *sqlx.DB {
+	t.Helper()
+	dataSourceName := os.Getenv(Env)
+	if dataSourceName == "" {
+		t.Skipf("%s isn't set", Env)
+	}
+
+	adminConn, err := sqlx.Connect("postgres", dataSourceName)
+	require.NoError(t, err)
+	t.Cleanup(func() { adminConn.Close() })
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	_, err = adminConn.Exec("CREATE SCHEMA " + schema)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, err := adminConn.Exec("DROP SCHEMA " + schema + " CASCADE")
+		assert.NoError(t, err)
+	})
+
+	dbConn, err := sqlx.Connect("postgres", dataSourceName+" search_path="+schema)
+	require.NoError(t, err)
+	t.Cleanup(func() { dbConn.Close() })
+	seed, err := os.ReadFile(seedPath())
+	require.NoError(t, err)
+	_, err = dbConn.Exec(string(seed))
+	require.NoError(t, err)
+	return dbConn
+}
+
+// seedPath returns the path of the seed script, independent of the package
+// the test runs in.
+func seedPath() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "cmd", "dbseed", "seed.sql")
+}
@@ -0,0 +1,274 @@
+// Package metrics keeps counters, histograms and gauges and writes them in
+// the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds of latency histograms in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// metric is a family of samples with the same name.
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds the metrics served at /metrics.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+// WriteTo writes all metrics in the order they were registered.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	buffered := bufio.NewWriter(counter)
+	for _, m := range metrics {
+		m.write(buffered)
+	}
+	err := buffered.Flush()
+	return counter.n, err
+}
+
+// ServeHTTP serves the metrics to Prometheus.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w)
+}
+
+// labeled holds one value per combination of label values.
+type labeled[V any] struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+
+	mu     sync.Mutex
+	values map[string]V
+	keys   map[string][]string
+}
+
+func newLabeled[V any](name, help, kind string, labels []string) labeled[V] {
+	return labeled[V]{
+		name:   name,
+		help:   help,
+		kind:   kind,
+		labels: labels,
+		values: map[string]V{},
+		keys:   map[string][]string{},
+	}
+}
+
+// update calls f with the value of the label values while holding the lock.
+func (l *labeled[V]) update(labelValues []string, f func(*V)) {
+	if len(labelValues) != len(l.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", l.name, len(l.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	value, ok := l.values[key]
+	if !ok {
+		l.keys[key] = append([]string(nil), labelValues...)
+	}
+	f(&value)
+	l.values[key] = value
+}
+
+// each calls f for all label values, sorted, while holding the lock.
+func (l *labeled[V]) each(f func(labelValues []string, value V)) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	keys := make([]string, 0, len(l.values))
+	for key := range l.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		f(l.keys[key], l.values[key])
+	}
+}
+
+func (l *labeled[V]) writeHeader(w *bufio.Writer) {
+	writeHeader(w, l.name, l.help, l.kind)
+}
+
+// CounterVec counts events by label values.
+type CounterVec struct {
+	labeled[float64]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newLabeled[float64](name, help, "counter", labels)}
+	r.register(c)
+	return c
+}
+
+// Add adds a non-negative value to the counter of the label values.
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	c.update(labelValues, func(total *float64) { *total += value })
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.writeHeader(w)
+	c.each(func(labelValues []string, value float64) {
+		writeSample(w, c.name, c.labels, labelValues, "", "", value)
+	})
+}
+
+// HistogramVec counts observations in buckets by label values.
+type HistogramVec struct {
+	labeled[histogram]
+	buckets []float64
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		labeled: newLabeled[histogram](name, help, "histogram", labels),
+		buckets: append([]float64(nil), buckets...),
+	}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe adds a value to the histogram of the label values.
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.update(labelValues, func(hist *histogram) {
+		if hist.counts == nil {
+			hist.counts = make([]uint64, len(h.buckets))
+		}
+		for i, bound := range h.buckets {
+			if value <= bound {
+				hist.counts[i]++
+			}
+		}
+		hist.count++
+		hist.sum += value
+	})
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.writeHeader(w)
+	h.each(func(labelValues []string, hist histogram) {
+		for i, bound := range h.buckets {
+			writeSample(w, h.name+"_bucket", h.labels, labelValues, "le", formatFloat(bound), float64(hist.counts[i]))
+		}
+		writeSample(w, h.name+"_bucket", h.labels, labelValues, "le", "+Inf", float64(hist.count))
+		writeSample(w, h.name+"_sum", h.labels, labelValues, "", "", hist.sum)
+		writeSample(w, h.name+"_count", h.labels, labelValues, "", "", float64(hist.count))
+	})
+}
+
+// funcMetric reads its value when the metrics are written.
+type funcMetric struct {
+	name  string
+	help  string
+	kind  string
+	value func() float64
+}
+
+// NewGaugeFunc adds a gauge whose value is read from f.
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "gauge", value: f})
+}
+
+// NewCounterFunc adds a counter whose value is read from f, e.g. from the
+// statistics of a library.
+func (r *Registry) NewCounterFunc(name, help string, f func() float64) {
+	r.register(&funcMetric{name: name, help: help, kind: "counter", value: f})
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, m.kind)
+	writeSample(w, m.name, nil, nil, "", "", m.value())
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	help = strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// writeSample writes a line with the labels and an optional extra label,
+// like the upper bound of a bucket.
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, value float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, label, labelValues[i])
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			writeLabel(w, extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(value))
+	w.WriteByte('\n')
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeLabel(w *bufio.Writer, label, value string) {
+	w.WriteString(label)
+	w.WriteString(`="`)
+	labelEscaper.WriteString(w, value)
+	w.WriteByte('"')
+}
+
+func formatFloat(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	requests := registry.NewCounterVec("http_requests_total", "Requests by route.", "route", "status")
+	latency := registry.NewHistogramVec("http_request_duration_seconds", "Latency by route.", []float64{0.5, 0.1}, "route")
+	registry.NewGaugeFunc("open_connections", "Open connections.", func() float64 { return 3 })
+
+	requests.Add(1, "/b", "200")
+	requests.Add(1, `/a"\`, "404")
+	requests.Add(2, "/b", "200")
+	latency.Observe(0.05, "/b")
+	latency.Observe(0.3, "/b")
+	latency.Observe(2, "/b")
+
+	var out strings.Builder
+	_, err := registry.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, `# HELP http_requests_total Requests by route.
+# TYPE http_requests_total counter
+http_requests_total{route="/a\"\\",status="404"} 1
+http_requests_total{route="/b",status="200"} 3
+# HELP http_request_duration_seconds Latency by route.
+# TYPE http_request_duration_seconds histogram
+http_request_duration_seconds_bucket{route="/b",le="0.1"} 1
+http_request_duration_seconds_bucket{route="/b",le="0.5"} 2
+http_request_duration_seconds_bucket{route="/b",le="+Inf"} 3
+http_request_duration_seconds_sum{route="/b"} 2.35
+http_request_duration_seconds_count{route="/b"} 3
+# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 3
+`, out.String())
+}
+
+func TestWrongLabelCount(t *testing.T) {
+	counter := NewRegistry().NewCounterVec("total", "Total.", "format")
+	assert.Panics(t, func() { counter.Add(1) })
+}
+
+func TestServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounterFunc("waits_total", "Waits.", func() float64 { return 7 })
+
+	w := httptest.NewRecorder()
+	registry.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "waits_total 7\n")
+}
@@ -0,0 +1,64 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/jmoiron/sqlx"
+)
+
+// TransactionHit is a rule hit on a transaction that is already stored.
+type TransactionHit struct {
+	Hit
+	TransactionID int
+}
+
+// ApplyToExisting matches the rules against all stored transactions of the
+// household and returns the hits. If tag is true, the tags of the hits are
+// attached to the transactions. Tags that are already attached are left
+// alone.
+func ApplyToExisting(ctx context.Context, dbConn sqlx.ExtContext, householdID int, rules []Rule, tag bool) ([]TransactionHit, error) {
+	holders, err := db.GetHolders(ctx, dbConn, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("get holders: %w", err)
+	}
+	holderNames := make(map[int]string, len(holders))
+	for _, holder := range holders {
+		holderNames[holder.ID] = holder.Name
+	}
+
+	transactions, err := db.GetTransactions(ctx, dbConn, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("get transactions: %w", err)
+	}
+
+	var transactionHits []TransactionHit
+	for _, transaction := range transactions {
+		// parts of split transactions are tagged by hand
+		if transaction.ParentTransactionID != nil {
+			continue
+		}
+		subject, err := NewSubject(
+			transaction.BaseTransaction,
+			holderNames[transaction.FromHolderID],
+			holderNames[transaction.ToHolderID])
+		if err != nil {
+			return nil, fmt.Errorf("subject of transaction %d: %w", transaction.ID, err)
+		}
+		for _, hit := range Apply(rules, subject) {
+			transactionHits = append(transactionHits, TransactionHit{
+				Hit:           hit,
+				TransactionID: transaction.ID,
+			})
+			if !tag {
+				continue
+			}
+			err := db.AttachTransactionTag(ctx, dbConn, householdID, transaction.ID, hit.TagID)
+			if err != nil {
+				return nil, fmt.Errorf("attach tag: %w", err)
+			}
+		}
+	}
+	return transactionHits, nil
+}
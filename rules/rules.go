@@ -0,0 +1,259 @@
+package rules
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+)
+
+// Operator compares the value of a field with the value of a condition.
+type Operator string
+
+const (
+	// Equals matches if the field equals the value, ignoring case.
+	Equals Operator = "equals"
+	// Contains matches if the field contains the value, ignoring case.
+	Contains Operator = "contains"
+	// Prefix matches if the field starts with the value, ignoring case.
+	Prefix Operator = "prefix"
+	// Matches matches if the regular expression matches the field, ignoring
+	// case.
+	Matches Operator = "matches"
+	// Greater, GreaterOrEqual, Less and LessOrEqual compare the amount in
+	// euros, e.g. "1000" or "12,50".
+	Greater        Operator = "gt"
+	GreaterOrEqual Operator = "gte"
+	Less           Operator = "lt"
+	LessOrEqual    Operator = "lte"
+)
+
+// The special fields of a subject. Every other field is looked up in the
+// top level of the transaction data, ignoring case, e.g. "Purpose" or
+// "CreditorID" for DKB transactions.
+const (
+	// FieldFrom is the name of the holder the money comes from.
+	FieldFrom = "from"
+	// FieldTo is the name of the holder the money goes to.
+	FieldTo = "to"
+	// FieldAmount is the (always positive) amount of the transaction.
+	FieldAmount = "amount"
+)
+
+// Condition is a single check of a rule as it is stored in the database.
+type Condition struct {
+	Field    string
+	Operator Operator
+	Value    string
+}
+
+// Rule tags the transactions matching all of its conditions.
+type Rule struct {
+	ID         int
+	Name       string
+	TagID      int
+	conditions []compiledCondition
+}
+
+// Hit records that a rule matched a transaction.
+type Hit struct {
+	RuleID   int
+	RuleName string
+	TagID    int
+}
+
+func (h Hit) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Int("ruleID", h.RuleID),
+		slog.String("ruleName", h.RuleName),
+		slog.Int("tagID", h.TagID),
+	)
+}
+
+type compiledCondition struct {
+	Condition
+	regex         *regexp.Regexp
+	amountInCents int
+}
+
+// Compile parses the conditions of the rule.
+func Compile(dbRule db.Rule) (*Rule, error) {
+	var conditions []Condition
+	if err := json.Unmarshal(dbRule.Conditions, &conditions); err != nil {
+		return nil, fmt.Errorf("unmarshal conditions: %w", err)
+	}
+	if len(conditions) == 0 {
+		return nil, fmt.Errorf("rule has no conditions")
+	}
+
+	rule := &Rule{
+		ID:         dbRule.ID,
+		Name:       dbRule.Name,
+		TagID:      dbRule.TagID,
+		conditions: make([]compiledCondition, 0, len(conditions)),
+	}
+	for i, condition := range conditions {
+		compiled, err := compileCondition(condition)
+		if err != nil {
+			return nil, fmt.Errorf("condition %d: %w", i, err)
+		}
+		rule.conditions = append(rule.conditions, compiled)
+	}
+	return rule, nil
+}
+
+// CompileEnabled compiles all enabled rules.
+func CompileEnabled(dbRules []db.Rule) ([]Rule, error) {
+	rules := make([]Rule, 0, len(dbRules))
+	for _, dbRule := range dbRules {
+		if !dbRule.Enabled {
+			continue
+		}
+		rule, err := Compile(dbRule)
+		if err != nil {
+			return nil, fmt.Errorf("compile rule %d: %w", dbRule.ID, err)
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, nil
+}
+
+func compileCondition(condition Condition) (compiledCondition, error) {
+	compiled := compiledCondition{Condition: condition}
+	if condition.Field == "" {
+		return compiled, fmt.Errorf("field is empty")
+	}
+	switch condition.Operator {
+	case Equals, Contains, Prefix:
+		if condition.Field == FieldAmount {
+			return compiled, fmt.Errorf("operator %q can't be used on the amount", condition.Operator)
+		}
+	case Matches:
+		regex, err := regexp.Compile("(?i)" + condition.Value)
+		if err != nil {
+			return compiled, fmt.Errorf("compile regex: %w", err)
+		}
+		compiled.regex = regex
+	case Greater, GreaterOrEqual, Less, LessOrEqual:
+		if condition.Field != FieldAmount {
+			return compiled, fmt.Errorf("operator %q can only be used on the amount", condition.Operator)
+		}
+		amountInCents, err := util.ParseEuros(condition.Value)
+		if err != nil {
+			return compiled, fmt.Errorf("parse amount: %w", err)
+		}
+		if amountInCents < 0 {
+			return compiled, fmt.Errorf("amount is negative")
+		}
+		compiled.amountInCents = amountInCents
+	default:
+		return compiled, fmt.Errorf("unknown operator %q", condition.Operator)
+	}
+	return compiled, nil
+}
+
+// Subject is a transaction prepared for matching.
+type Subject struct {
+	FromName      string
+	ToName        string
+	AmountInCents int
+	data          map[string]any
+}
+
+// NewSubject prepares the transaction between the two holders for matching.
+func NewSubject(transaction db.BaseTransaction, fromName, toName string) (Subject, error) {
+	subject := Subject{
+		FromName:      fromName,
+		ToName:        toName,
+		AmountInCents: transaction.AmountInCents,
+	}
+	if !transaction.Data.Valid || len(transaction.Data.JSONText) == 0 {
+		return subject, nil
+	}
+	if err := json.Unmarshal(transaction.Data.JSONText, &subject.data); err != nil {
+		return subject, fmt.Errorf("unmarshal data: %w", err)
+	}
+	return subject, nil
+}
+
+func (s Subject) field(name string) (string, bool) {
+	switch name {
+	case FieldFrom:
+		return s.FromName, true
+	case FieldTo:
+		return s.ToName, true
+	}
+	for key, value := range s.data {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		switch value := value.(type) {
+		case string:
+			return value, true
+		case nil:
+			return "", false
+		default:
+			return fmt.Sprint(value), true
+		}
+	}
+	return "", false
+}
+
+// Matches reports whether all conditions of the rule match the subject.
+func (r Rule) Matches(subject Subject) bool {
+	for _, condition := range r.conditions {
+		if !condition.matches(subject) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c compiledCondition) matches(subject Subject) bool {
+	switch c.Operator {
+	case Greater:
+		return subject.AmountInCents > c.amountInCents
+	case GreaterOrEqual:
+		return subject.AmountInCents >= c.amountInCents
+	case Less:
+		return subject.AmountInCents < c.amountInCents
+	case LessOrEqual:
+		return subject.AmountInCents <= c.amountInCents
+	}
+
+	value, ok := subject.field(c.Field)
+	if !ok {
+		return false
+	}
+	switch c.Operator {
+	case Equals:
+		return strings.EqualFold(value, c.Value)
+	case Contains:
+		return strings.Contains(strings.ToLower(value), strings.ToLower(c.Value))
+	case Prefix:
+		return strings.HasPrefix(strings.ToLower(value), strings.ToLower(c.Value))
+	case Matches:
+		return c.regex.MatchString(value)
+	}
+	return false
+}
+
+// Apply returns a hit for every rule matching the subject.
+func Apply(rules []Rule, subject Subject) []Hit {
+	var hits []Hit
+	for _, rule := range rules {
+		if !rule.Matches(subject) {
+			continue
+		}
+		hits = append(hits, Hit{
+			RuleID:   rule.ID,
+			RuleName: rule.Name,
+			TagID:    rule.TagID,
+		})
+	}
+	return hits
+}
@@ -0,0 +1,103 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRuleMatches(t *testing.T) {
+	transaction := db.BaseTransaction{
+		AmountInCents: 120000,
+		Data: types.NullJSONText{
+			JSONText: types.JSONText(`{
+				"Payee": "REWE Markt GmbH",
+				"Purpose": "Miete Oktober",
+				"CreditorID": "DE98ZZZ09999999999"
+			}`),
+			Valid: true,
+		},
+	}
+	subject, err := NewSubject(transaction, "Girokonto", "Rewe")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		conditions string
+		want       bool
+	}{
+		{
+			name:       "regex on data field",
+			conditions: `[{"Field": "payee", "Operator": "matches", "Value": "REWE|EDEKA|Lidl"}]`,
+			want:       true,
+		}, {
+			name:       "regex ignores case",
+			conditions: `[{"Field": "to", "Operator": "matches", "Value": "^REWE$"}]`,
+			want:       true,
+		}, {
+			name:       "creditor id prefix",
+			conditions: `[{"Field": "CreditorID", "Operator": "prefix", "Value": "DE98ZZZ"}]`,
+			want:       true,
+		}, {
+			name: "amount and purpose",
+			conditions: `[
+				{"Field": "amount", "Operator": "gt", "Value": "1000"},
+				{"Field": "Purpose", "Operator": "contains", "Value": "miete"}
+			]`,
+			want: true,
+		}, {
+			name: "amount too small",
+			conditions: `[
+				{"Field": "amount", "Operator": "gt", "Value": "1200,00"},
+				{"Field": "Purpose", "Operator": "contains", "Value": "miete"}
+			]`,
+			want: false,
+		}, {
+			name:       "missing field",
+			conditions: `[{"Field": "MandateReference", "Operator": "equals", "Value": ""}]`,
+			want:       false,
+		}, {
+			name:       "from holder",
+			conditions: `[{"Field": "from", "Operator": "equals", "Value": "girokonto"}]`,
+			want:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := Compile(db.Rule{
+				CreateRule: db.CreateRule{
+					Name:       tt.name,
+					TagID:      1,
+					Conditions: types.JSONText(tt.conditions),
+					Enabled:    true,
+				},
+			})
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rule.Matches(subject))
+		})
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		conditions string
+	}{
+		{name: "no conditions", conditions: `[]`},
+		{name: "unknown operator", conditions: `[{"Field": "to", "Operator": "like", "Value": "x"}]`},
+		{name: "invalid regex", conditions: `[{"Field": "to", "Operator": "matches", "Value": "("}]`},
+		{name: "compare text", conditions: `[{"Field": "to", "Operator": "gt", "Value": "1"}]`},
+		{name: "invalid amount", conditions: `[{"Field": "amount", "Operator": "lt", "Value": "much"}]`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile(db.Rule{
+				CreateRule: db.CreateRule{Conditions: types.JSONText(tt.conditions)},
+			})
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// apiPathPrefix is where the current version of the API is mounted.
+const apiPathPrefix = "/api/v1"
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// apiRouter serves the versioned JSON API. Dates are days in loc.
+func apiRouter(dbConn *sqlx.DB, loc *time.Location) http.Handler {
+	r := chi.NewRouter()
+	api := &api{
+		dbConn: dbConn,
+		loc:    loc,
+	}
+
+	r.Get("/holders", api.listHolders)
+	r.Post("/holders", api.createHolder)
+	r.Get("/holders/{id}", api.getHolder)
+	r.Patch("/holders/{id}", api.updateHolder)
+	r.Delete("/holders/{id}", api.deleteHolder)
+	r.Put("/holders/{id}/tags/{tagID}", api.attachHolderTag)
+	r.Delete("/holders/{id}/tags/{tagID}", api.detachHolderTag)
+
+	r.Get("/transactions", api.listTransactions)
+	r.Post("/transactions", api.createTransaction)
+	r.Get("/transactions/{id}", api.getTransaction)
+	r.Patch("/transactions/{id}", api.updateTransaction)
+	r.Delete("/transactions/{id}", api.deleteTransaction)
+	r.Put("/transactions/{id}/tags/{tagID}", api.attachTransactionTag)
+	r.Delete("/transactions/{id}/tags/{tagID}", api.detachTransactionTag)
+
+	r.Get("/tags", api.listTags)
+	r.Post("/tags", api.createTag)
+	r.Get("/tags/{id}", api.getTag)
+	r.Patch("/tags/{id}", api.updateTag)
+	r.Delete("/tags/{id}", api.deleteTag)
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "no such endpoint")
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, "method_not_allowed", "method not allowed")
+	})
+	return r
+}
+
+type api struct {
+	dbConn *sqlx.DB
+	loc    *time.Location
+}
+
+// apiError is the body of every error response.
+type apiError struct {
+	Error apiErrorDetail `json:"error"`
+}
+
+type apiErrorDetail struct {
+	// Code is a stable machine readable identifier of the error.
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// page is the body of every list response. NextCursor is empty on the last
+// page.
+type page[T any] struct {
+	Items      []T    `json:"items"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+// optional is a field of a PATCH body. Set distinguishes a missing field
+// from an explicit null.
+type optional[T any] struct {
+	Set   bool
+	Value T
+}
+
+func (o *optional[T]) UnmarshalJSON(data []byte) error {
+	o.Set = true
+	return json.Unmarshal(data, &o.Value)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		slog.Warn("error writing json response", slog.String("error", err.Error()))
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, code string, message string) {
+	writeJSON(w, status, apiError{
+		Error: apiErrorDetail{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
+
+// writeDBError maps errors of the db package to a status code.
+func writeDBError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, db.ErrNotFound):
+		writeAPIError(w, http.StatusNotFound, "not_found", err.Error())
+	case errors.Is(err, db.ErrHolderCycle), errors.Is(err, db.ErrTagCycle):
+		writeAPIError(w, http.StatusConflict, "cycle", err.Error())
+	case errors.Is(err, db.ErrSplitAmount), errors.Is(err, db.ErrSplitPart):
+		writeAPIError(w, http.StatusConflict, "split", err.Error())
+	case errors.Is(err, db.ErrDuplicate), db.IsUniqueViolation(err):
+		writeAPIError(w, http.StatusConflict, "conflict", "already exists")
+	case errors.Is(err, db.ErrInvalidReference), db.IsForeignKeyViolation(err):
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid_reference", "referenced row doesn't exist")
+	default:
+		util.Logger(r.Context()).Error("api database error", slog.String("error", err.Error()))
+		writeAPIError(w, http.StatusInternalServerError, "internal", "internal server error")
+	}
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, body any) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(body); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_body", err.Error())
+		return false
+	}
+	return true
+}
+
+// urlID parses the path parameter as id and writes an error if it isn't one.
+func urlID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, name))
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_id", fmt.Sprintf("invalid %s", name))
+		return 0, false
+	}
+	return id, true
+}
+
+// pageSize reads the limit query parameter.
+func pageSize(r *http.Request) (int, error) {
+	limit := r.URL.Query().Get("limit")
+	if limit == "" {
+		return defaultPageSize, nil
+	}
+	size, err := strconv.Atoi(limit)
+	if err != nil || size < 1 || size > maxPageSize {
+		return 0, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	return size, nil
+}
+
+// encodeCursor makes the position opaque, so clients don't depend on it.
+func encodeCursor(position any) string {
+	data, err := json.Marshal(position)
+	if err != nil {
+		// positions are plain structs and ints, so this can't happen
+		panic(fmt.Sprintf("marshal cursor: %s", err))
+	}
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(cursor string, position any) error {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return fmt.Errorf("invalid cursor")
+	}
+	if err := json.Unmarshal(data, position); err != nil {
+		return fmt.Errorf("invalid cursor")
+	}
+	return nil
+}
+
+// idCursor reads the cursor of lists ordered by id. Without a cursor the
+// list starts at the beginning.
+func idCursor(r *http.Request) (int, error) {
+	cursor := r.URL.Query().Get("cursor")
+	if cursor == "" {
+		return 0, nil
+	}
+	var afterID int
+	if err := decodeCursor(cursor, &afterID); err != nil {
+		return 0, err
+	}
+	return afterID, nil
+}
@@ -0,0 +1,240 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/jmoiron/sqlx/types"
+)
+
+type apiHolder struct {
+	ID             int                `json:"id"`
+	Type           string             `json:"type"`
+	Identifier     string             `json:"identifier"`
+	Name           string             `json:"name"`
+	ParentHolderID *int               `json:"parentHolderId"`
+	Data           types.NullJSONText `json:"data"`
+	Favorite       bool               `json:"favorite"`
+	CreatedAt      time.Time          `json:"createdAt"`
+}
+
+func toAPIHolder(holder db.Holder) apiHolder {
+	return apiHolder{
+		ID:             holder.ID,
+		Type:           holder.Type,
+		Identifier:     holder.Identifier,
+		Name:           holder.Name,
+		ParentHolderID: holder.ParentHolderID,
+		Data:           holder.Data,
+		Favorite:       holder.Favorite,
+		CreatedAt:      holder.CreatedAt,
+	}
+}
+
+type apiCreateHolder struct {
+	Type           string          `json:"type"`
+	Identifier     string          `json:"identifier"`
+	Name           string          `json:"name"`
+	ParentHolderID *int            `json:"parentHolderId"`
+	Data           json.RawMessage `json:"data"`
+	Favorite       bool            `json:"favorite"`
+}
+
+type apiUpdateHolder struct {
+	Type           optional[string]          `json:"type"`
+	Identifier     optional[string]          `json:"identifier"`
+	Name           optional[string]          `json:"name"`
+	ParentHolderID optional[*int]            `json:"parentHolderId"`
+	Data           optional[json.RawMessage] `json:"data"`
+	Favorite       optional[bool]            `json:"favorite"`
+}
+
+// nullJSON converts a raw JSON value of a request to a nullable column.
+func nullJSON(raw json.RawMessage) types.NullJSONText {
+	if len(raw) == 0 || string(raw) == "null" {
+		return types.NullJSONText{}
+	}
+	return types.NullJSONText{
+		JSONText: types.JSONText(raw),
+		Valid:    true,
+	}
+}
+
+func (a *api) listHolders(w http.ResponseWriter, r *http.Request) {
+	limit, err := pageSize(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_limit", err.Error())
+		return
+	}
+	afterID, err := idCursor(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+	holders, err := db.ListHolders(r.Context(), a.dbConn, currentHousehold(r.Context()), afterID, limit)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	response := page[apiHolder]{Items: make([]apiHolder, 0, len(holders))}
+	for _, holder := range holders {
+		response.Items = append(response.Items, toAPIHolder(holder))
+	}
+	if len(holders) == limit {
+		response.NextCursor = encodeCursor(holders[len(holders)-1].ID)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) getHolder(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	holder, ok, err := db.GetHolder(r.Context(), a.dbConn, currentHousehold(r.Context()), id)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if !ok {
+		writeDBError(w, r, db.ErrNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIHolder(*holder))
+}
+
+func (a *api) createHolder(w http.ResponseWriter, r *http.Request) {
+	var body apiCreateHolder
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Type == "" || body.Identifier == "" || body.Name == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "missing_field", "type, identifier and name are required")
+		return
+	}
+	holder, err := db.InsertHolder(r.Context(), a.dbConn, currentHousehold(r.Context()), db.CreateHolder{
+		HolderIdentifier: db.HolderIdentifier{
+			Type:       body.Type,
+			Identifier: body.Identifier,
+		},
+		Name:           body.Name,
+		ParentHolderID: body.ParentHolderID,
+		Data:           nullJSON(body.Data),
+		Favorite:       body.Favorite,
+	})
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIHolder(*holder))
+}
+
+func (a *api) updateHolder(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body apiUpdateHolder
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	ctx := r.Context()
+	householdID := currentHousehold(ctx)
+	tx, err := a.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	holder, ok, err := db.GetHolder(ctx, tx, householdID, id)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if !ok {
+		writeDBError(w, r, db.ErrNotFound)
+		return
+	}
+	update := holder.CreateHolder
+	if body.Type.Set {
+		update.Type = body.Type.Value
+	}
+	if body.Identifier.Set {
+		update.Identifier = body.Identifier.Value
+	}
+	if body.Name.Set {
+		update.Name = body.Name.Value
+	}
+	if body.ParentHolderID.Set {
+		update.ParentHolderID = body.ParentHolderID.Value
+	}
+	if body.Data.Set {
+		update.Data = nullJSON(body.Data.Value)
+	}
+	if body.Favorite.Set {
+		update.Favorite = body.Favorite.Value
+	}
+	if update.Type == "" || update.Identifier == "" || update.Name == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "missing_field", "type, identifier and name can't be empty")
+		return
+	}
+
+	updated, err := db.UpdateHolder(ctx, tx, householdID, id, update)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIHolder(*updated))
+}
+
+func (a *api) deleteHolder(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := db.DeleteHolder(r.Context(), a.dbConn, currentHousehold(r.Context()), id); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) attachHolderTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	tagID, ok := urlID(w, r, "tagID")
+	if !ok {
+		return
+	}
+	if err := db.AttachHolderTag(r.Context(), a.dbConn, currentHousehold(r.Context()), id, tagID); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) detachHolderTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	tagID, ok := urlID(w, r, "tagID")
+	if !ok {
+		return
+	}
+	if err := db.DetachHolderTag(r.Context(), a.dbConn, currentHousehold(r.Context()), id, tagID); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
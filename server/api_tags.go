@@ -0,0 +1,173 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+)
+
+type apiTag struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	ParentTagID *int      `json:"parentTagId"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func toAPITag(tag db.Tag) apiTag {
+	return apiTag{
+		ID:          tag.ID,
+		Name:        tag.Name,
+		ParentTagID: tag.ParentTagID,
+		CreatedAt:   tag.CreatedAt,
+	}
+}
+
+type apiCreateTag struct {
+	Name        string `json:"name"`
+	ParentTagID *int   `json:"parentTagId"`
+}
+
+type apiUpdateTag struct {
+	Name        optional[string] `json:"name"`
+	ParentTagID optional[*int]   `json:"parentTagId"`
+}
+
+func (a *api) listTags(w http.ResponseWriter, r *http.Request) {
+	limit, err := pageSize(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_limit", err.Error())
+		return
+	}
+	afterID, err := idCursor(r)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_cursor", err.Error())
+		return
+	}
+	tags, err := db.ListTags(r.Context(), a.dbConn, currentHousehold(r.Context()), afterID, limit)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	response := page[apiTag]{Items: make([]apiTag, 0, len(tags))}
+	for _, tag := range tags {
+		response.Items = append(response.Items, toAPITag(tag))
+	}
+	if len(tags) == limit {
+		response.NextCursor = encodeCursor(tags[len(tags)-1].ID)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) getTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	tag, ok, err := db.GetTag(r.Context(), a.dbConn, currentHousehold(r.Context()), id)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if !ok {
+		writeDBError(w, r, db.ErrNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPITag(*tag))
+}
+
+func (a *api) createTag(w http.ResponseWriter, r *http.Request) {
+	var body apiCreateTag
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Name == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "missing_field", "name is required")
+		return
+	}
+	tag, err := db.InsertTag(r.Context(), a.dbConn, currentHousehold(r.Context()), db.CreateTag{
+		Name:        body.Name,
+		ParentTagID: body.ParentTagID,
+	})
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPITag(*tag))
+}
+
+func (a *api) updateTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body apiUpdateTag
+	if !readJSON(w, r, &body) {
+		return
+	}
+	if body.Name.Set && body.Name.Value == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "missing_field", "name can't be empty")
+		return
+	}
+
+	ctx := r.Context()
+	householdID := currentHousehold(ctx)
+	tx, err := a.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if body.Name.Set {
+		if err := db.RenameTag(ctx, tx, householdID, id, body.Name.Value); err != nil {
+			writeDBError(w, r, err)
+			return
+		}
+	}
+	if body.ParentTagID.Set {
+		if err := db.MoveTag(ctx, tx, householdID, id, body.ParentTagID.Value); err != nil {
+			writeDBError(w, r, err)
+			return
+		}
+	}
+	tag, ok, err := db.GetTag(ctx, tx, householdID, id)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if !ok {
+		writeDBError(w, r, db.ErrNotFound)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPITag(*tag))
+}
+
+func (a *api) deleteTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := a.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	if err := db.DeleteTag(ctx, tx, currentHousehold(ctx), id); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
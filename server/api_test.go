@@ -0,0 +1,227 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func decodeJSON[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	var body T
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body), w.Body.String())
+	return body
+}
+
+func TestTransactionAPIErrors(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	f := newHouseholdFixture(t, ctx, dbConn, "alice")
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+	path := fmt.Sprintf("/transactions/%d", f.TransactionID)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+		code   string
+	}{
+		{name: "invalid id", method: http.MethodGet, path: "/transactions/abc", status: http.StatusBadRequest, code: "invalid_id"},
+		{name: "unknown", method: http.MethodGet, path: "/transactions/999999", status: http.StatusNotFound, code: "not_found"},
+		{name: "patch unknown", method: http.MethodPatch, path: "/transactions/999999", body: `{"note": "x"}`, status: http.StatusNotFound, code: "not_found"},
+		{name: "unknown field", method: http.MethodPatch, path: path, body: `{"amount": 1}`, status: http.StatusBadRequest, code: "invalid_body"},
+		{name: "no json", method: http.MethodPatch, path: path, body: `note=x`, status: http.StatusBadRequest, code: "invalid_body"},
+		{name: "zero amount", method: http.MethodPatch, path: path, body: `{"amountInCents": 0}`, status: http.StatusUnprocessableEntity, code: "invalid_field"},
+		{name: "invalid date", method: http.MethodPatch, path: path, body: `{"valueDate": "01.05.2023"}`, status: http.StatusUnprocessableEntity, code: "invalid_field"},
+		{name: "same holders", method: http.MethodPatch, path: path, body: fmt.Sprintf(`{"toHolderId": %d}`, f.Holder.ID), status: http.StatusUnprocessableEntity, code: "invalid_field"},
+		{name: "unknown holder", method: http.MethodPatch, path: path, body: `{"toHolderId": 999999}`, status: http.StatusUnprocessableEntity, code: "invalid_reference"},
+		{
+			name:   "duplicate",
+			method: http.MethodPost,
+			path:   "/transactions",
+			body: fmt.Sprintf(`{"fromHolderId": %d, "toHolderId": %d, "amountInCents": 1234, "bookingDate": "2023-05-01", "valueDate": "2023-05-01", "data": {"Purpose": "alice purpose"}}`,
+				f.Holder.ID, f.Other.ID),
+			status: http.StatusConflict,
+			code:   "conflict",
+		},
+		{name: "invalid limit", method: http.MethodGet, path: "/transactions?limit=0", status: http.StatusBadRequest, code: "invalid_query"},
+		{name: "invalid cursor", method: http.MethodGet, path: "/transactions?cursor=nope", status: http.StatusBadRequest, code: "invalid_query"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.apiRequest(t, handler, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			body := decodeJSON[apiError](t, w)
+			assert.Equal(t, tt.code, body.Error.Code)
+			assert.NotEmpty(t, body.Error.Message)
+		})
+	}
+
+	// nothing was changed by the rejected requests
+	transaction, found, err := db.GetTransaction(ctx, dbConn, f.HouseholdID, f.TransactionID)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, 1234, transaction.AmountInCents)
+	assert.Equal(t, f.Other.ID, transaction.ToHolderID)
+}
+
+func TestTransactionAPIPatch(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	f := newHouseholdFixture(t, ctx, dbConn, "alice")
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+	path := fmt.Sprintf("/transactions/%d", f.TransactionID)
+
+	// only the fields in the body change
+	w := f.apiRequest(t, handler, http.MethodPatch, path, `{"note": "Groceries"}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	patched := decodeJSON[apiTransaction](t, w)
+	assert.Equal(t, "Groceries", patched.Note)
+	assert.Equal(t, 1234, patched.AmountInCents)
+	assert.Equal(t, "2023-05-01", patched.ValueDate)
+	assert.JSONEq(t, `{"Purpose": "alice purpose"}`, string(patched.Data.JSONText))
+
+	w = f.apiRequest(t, handler, http.MethodPatch, path, `{"valueDate": "2023-05-02", "amountInCents": 999}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	patched = decodeJSON[apiTransaction](t, w)
+	assert.Equal(t, "Groceries", patched.Note)
+	assert.Equal(t, 999, patched.AmountInCents)
+	assert.Equal(t, "2023-05-02", patched.ValueDate)
+	assert.Equal(t, "2023-05-01", patched.BookingDate)
+
+	// an empty value is a change too
+	w = f.apiRequest(t, handler, http.MethodPatch, path, `{"note": ""}`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Empty(t, decodeJSON[apiTransaction](t, w).Note)
+
+	w = f.apiRequest(t, handler, http.MethodGet, path, "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	fetched := decodeJSON[apiTransaction](t, w)
+	assert.Equal(t, 999, fetched.AmountInCents)
+	assert.Empty(t, fetched.Note)
+}
+
+func TestTransactionAPIPatchSplit(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	f := newHouseholdFixture(t, ctx, dbConn, "alice")
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+	parts, err := db.SplitTransaction(ctx, dbConn, f.HouseholdID, f.TransactionID, []db.SplitPart{
+		{AmountInCents: 1000},
+		{AmountInCents: 234},
+	})
+	require.NoError(t, err)
+	parentPath := fmt.Sprintf("/transactions/%d", f.TransactionID)
+	partPath := fmt.Sprintf("/transactions/%d", parts[0].ID)
+
+	swapHolders := fmt.Sprintf(`{"fromHolderId": %d, "toHolderId": %d}`, f.Other.ID, f.Holder.ID)
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{name: "parent amount", method: http.MethodPatch, path: parentPath, body: `{"amountInCents": 2000}`, status: http.StatusConflict},
+		{name: "part amount", method: http.MethodPatch, path: partPath, body: `{"amountInCents": 500}`, status: http.StatusConflict},
+		{name: "part holders", method: http.MethodPatch, path: partPath, body: swapHolders, status: http.StatusConflict},
+		{name: "part date", method: http.MethodPatch, path: partPath, body: `{"valueDate": "2023-05-02"}`, status: http.StatusConflict},
+		{name: "delete part", method: http.MethodDelete, path: partPath, status: http.StatusConflict},
+		{name: "parent note", method: http.MethodPatch, path: parentPath, body: `{"note": "Shopping", "amountInCents": 1234}`, status: http.StatusOK},
+		{name: "part note", method: http.MethodPatch, path: partPath, body: `{"note": "Wine", "valueDate": "2023-05-01"}`, status: http.StatusOK},
+		{name: "parent holders", method: http.MethodPatch, path: parentPath, body: swapHolders, status: http.StatusOK},
+		{name: "parent date", method: http.MethodPatch, path: parentPath, body: `{"valueDate": "2023-05-03"}`, status: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := f.apiRequest(t, handler, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.status, w.Code, w.Body.String())
+			if tt.status == http.StatusConflict {
+				assert.Equal(t, "split", decodeJSON[apiError](t, w).Error.Code)
+			}
+		})
+	}
+
+	split, err := db.GetTransactionSplits(ctx, dbConn, f.HouseholdID, f.TransactionID)
+	require.NoError(t, err)
+	require.Len(t, split, 2)
+	assert.Equal(t, 1000, split[0].AmountInCents)
+	assert.Equal(t, 234, split[1].AmountInCents)
+	// the parts follow the holders and dates of the split transaction
+	for _, part := range split {
+		assert.Equal(t, f.Other.ID, part.FromHolderID)
+		assert.Equal(t, f.Holder.ID, part.ToHolderID)
+		assert.Equal(t, "2023-05-03", part.ValueDate.Format(time.DateOnly))
+	}
+
+	// deleting the split transaction deletes the parts
+	w := f.apiRequest(t, handler, http.MethodDelete, parentPath, "")
+	assert.Equal(t, http.StatusNoContent, w.Code, w.Body.String())
+	w = f.apiRequest(t, handler, http.MethodGet, partPath, "")
+	assert.Equal(t, http.StatusNotFound, w.Code, w.Body.String())
+}
+
+func TestTransactionAPICursor(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	f := newHouseholdFixture(t, ctx, dbConn, "alice")
+	other := newHouseholdFixture(t, ctx, dbConn, "bob")
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+
+	want := []int{f.TransactionID}
+	day := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	// two transactions share the timestamp of the fixture, so the pages have
+	// to be split between equal timestamps
+	for _, timestamp := range []time.Time{day, day, day.AddDate(0, 1, 0), day.AddDate(0, -1, 0)} {
+		transaction, err := db.InsertTransaction(ctx, dbConn, f.HouseholdID, db.CreateTransaction{
+			BaseTransaction: db.BaseTransaction{
+				AmountInCents: 100,
+				Timestamp:     timestamp,
+				BookingDate:   timestamp,
+				ValueDate:     timestamp,
+			},
+			FromHolderID: f.Holder.ID,
+			ToHolderID:   f.Other.ID,
+		})
+		require.NoError(t, err)
+		want = append(want, transaction.ID)
+	}
+
+	var got []int
+	var timestamps []time.Time
+	query := url.Values{"limit": {"2"}}
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, len(want), "the cursor doesn't end")
+		w := f.apiRequest(t, handler, http.MethodGet, "/transactions?"+query.Encode(), "")
+		require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+		response := decodeJSON[page[apiTransaction]](t, w)
+		assert.LessOrEqual(t, len(response.Items), 2)
+		for _, transaction := range response.Items {
+			got = append(got, transaction.ID)
+			timestamps = append(timestamps, transaction.Timestamp)
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+	assert.ElementsMatch(t, want, got)
+	assert.NotContains(t, got, other.TransactionID)
+	for i := 1; i < len(timestamps); i++ {
+		assert.False(t, timestamps[i].After(timestamps[i-1]), "newest first")
+	}
+}
@@ -0,0 +1,279 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/jmoiron/sqlx/types"
+)
+
+type apiTransaction struct {
+	ID                  int                `json:"id"`
+	FromHolderID        int                `json:"fromHolderId"`
+	ToHolderID          int                `json:"toHolderId"`
+	AmountInCents       int                `json:"amountInCents"`
+	Timestamp           time.Time          `json:"timestamp"`
+	BookingDate         string             `json:"bookingDate"`
+	ValueDate           string             `json:"valueDate"`
+	Data                types.NullJSONText `json:"data"`
+	Note                string             `json:"note"`
+	ParentTransactionID *int               `json:"parentTransactionId"`
+	CreatedAt           time.Time          `json:"createdAt"`
+}
+
+func toAPITransaction(transaction db.Transaction) apiTransaction {
+	return apiTransaction{
+		ID:                  transaction.ID,
+		FromHolderID:        transaction.FromHolderID,
+		ToHolderID:          transaction.ToHolderID,
+		AmountInCents:       transaction.AmountInCents,
+		Timestamp:           transaction.Timestamp,
+		BookingDate:         transaction.BookingDate.Format(time.DateOnly),
+		ValueDate:           transaction.ValueDate.Format(time.DateOnly),
+		Data:                transaction.Data,
+		Note:                transaction.Note,
+		ParentTransactionID: transaction.ParentTransactionID,
+		CreatedAt:           transaction.CreatedAt,
+	}
+}
+
+// apiCreateTransaction is the body of a new transaction. Without a timestamp
+// the transaction happened at the start of its value date.
+type apiCreateTransaction struct {
+	FromHolderID  int             `json:"fromHolderId"`
+	ToHolderID    int             `json:"toHolderId"`
+	AmountInCents int             `json:"amountInCents"`
+	Timestamp     *time.Time      `json:"timestamp"`
+	BookingDate   string          `json:"bookingDate"`
+	ValueDate     string          `json:"valueDate"`
+	Data          json.RawMessage `json:"data"`
+	Note          string          `json:"note"`
+}
+
+type apiUpdateTransaction struct {
+	FromHolderID  optional[int]             `json:"fromHolderId"`
+	ToHolderID    optional[int]             `json:"toHolderId"`
+	AmountInCents optional[int]             `json:"amountInCents"`
+	Timestamp     optional[time.Time]       `json:"timestamp"`
+	BookingDate   optional[string]          `json:"bookingDate"`
+	ValueDate     optional[string]          `json:"valueDate"`
+	Data          optional[json.RawMessage] `json:"data"`
+	Note          optional[string]          `json:"note"`
+}
+
+// validateTransaction checks the rules the database doesn't enforce.
+func validateTransaction(transaction db.CreateTransaction) error {
+	if transaction.AmountInCents <= 0 {
+		return fmt.Errorf("amountInCents must be positive")
+	}
+	if transaction.FromHolderID == transaction.ToHolderID {
+		return fmt.Errorf("fromHolderId and toHolderId must differ")
+	}
+	return nil
+}
+
+func (a *api) listTransactions(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseTransactionFilter(r, a.loc)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_query", err.Error())
+		return
+	}
+	transactions, err := db.ListTransactions(r.Context(), a.dbConn, currentHousehold(r.Context()), filter)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	response := page[apiTransaction]{Items: make([]apiTransaction, 0, len(transactions))}
+	for _, transaction := range transactions {
+		response.Items = append(response.Items, toAPITransaction(transaction.Transaction))
+	}
+	if len(transactions) == filter.Limit {
+		response.NextCursor = encodeCursor(transactions[len(transactions)-1].Cursor())
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *api) getTransaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	transaction, ok, err := db.GetTransaction(r.Context(), a.dbConn, currentHousehold(r.Context()), id)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if !ok {
+		writeDBError(w, r, db.ErrNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPITransaction(*transaction))
+}
+
+func (a *api) createTransaction(w http.ResponseWriter, r *http.Request) {
+	var body apiCreateTransaction
+	if !readJSON(w, r, &body) {
+		return
+	}
+	bookingDate, err := parseDate("bookingDate", body.BookingDate, a.loc)
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid_field", err.Error())
+		return
+	}
+	valueDate, err := parseDate("valueDate", body.ValueDate, a.loc)
+	if err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid_field", err.Error())
+		return
+	}
+	timestamp := valueDate
+	if body.Timestamp != nil {
+		timestamp = *body.Timestamp
+	}
+	create := db.CreateTransaction{
+		BaseTransaction: db.BaseTransaction{
+			AmountInCents: body.AmountInCents,
+			Timestamp:     timestamp,
+			BookingDate:   bookingDate,
+			ValueDate:     valueDate,
+			Data:          nullJSON(body.Data),
+			Note:          body.Note,
+		},
+		FromHolderID: body.FromHolderID,
+		ToHolderID:   body.ToHolderID,
+	}
+	if err := validateTransaction(create); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid_field", err.Error())
+		return
+	}
+	transaction, err := db.InsertTransaction(r.Context(), a.dbConn, currentHousehold(r.Context()), create)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPITransaction(*transaction))
+}
+
+func (a *api) updateTransaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	var body apiUpdateTransaction
+	if !readJSON(w, r, &body) {
+		return
+	}
+
+	ctx := r.Context()
+	householdID := currentHousehold(ctx)
+	tx, err := a.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	defer tx.Rollback()
+
+	transaction, ok, err := db.GetTransaction(ctx, tx, householdID, id)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if !ok {
+		writeDBError(w, r, db.ErrNotFound)
+		return
+	}
+	update := transaction.CreateTransaction
+	if body.FromHolderID.Set {
+		update.FromHolderID = body.FromHolderID.Value
+	}
+	if body.ToHolderID.Set {
+		update.ToHolderID = body.ToHolderID.Value
+	}
+	if body.AmountInCents.Set {
+		update.AmountInCents = body.AmountInCents.Value
+	}
+	if body.Timestamp.Set {
+		update.Timestamp = body.Timestamp.Value
+	}
+	if body.BookingDate.Set {
+		update.BookingDate, err = parseDate("bookingDate", body.BookingDate.Value, a.loc)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, "invalid_field", err.Error())
+			return
+		}
+	}
+	if body.ValueDate.Set {
+		update.ValueDate, err = parseDate("valueDate", body.ValueDate.Value, a.loc)
+		if err != nil {
+			writeAPIError(w, http.StatusUnprocessableEntity, "invalid_field", err.Error())
+			return
+		}
+	}
+	if body.Data.Set {
+		update.Data = nullJSON(body.Data.Value)
+	}
+	if body.Note.Set {
+		update.Note = body.Note.Value
+	}
+	if err := validateTransaction(update); err != nil {
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid_field", err.Error())
+		return
+	}
+
+	updated, err := db.UpdateTransaction(ctx, tx, householdID, id, update)
+	if err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPITransaction(*updated))
+}
+
+func (a *api) deleteTransaction(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	if err := db.DeleteTransaction(r.Context(), a.dbConn, currentHousehold(r.Context()), id); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) attachTransactionTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	tagID, ok := urlID(w, r, "tagID")
+	if !ok {
+		return
+	}
+	if err := db.AttachTransactionTag(r.Context(), a.dbConn, currentHousehold(r.Context()), id, tagID); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *api) detachTransactionTag(w http.ResponseWriter, r *http.Request) {
+	id, ok := urlID(w, r, "id")
+	if !ok {
+		return
+	}
+	tagID, ok := urlID(w, r, "tagID")
+	if !ok {
+		return
+	}
+	if err := db.DetachTransactionTag(r.Context(), a.dbConn, currentHousehold(r.Context()), id, tagID); err != nil {
+		writeDBError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
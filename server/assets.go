@@ -0,0 +1,145 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"embed"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+)
+
+//go:generate go run ../cmd/vendor -dir static/vendor
+
+// devAssetsDir is read instead of the embedded files in development mode.
+// It's relative to the root of the repository.
+const devAssetsDir = "server"
+
+// embeddedAssets are the templates and static files built into the binary.
+//
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// vendoredAssets are the third-party files committed to the static
+// directory by their subresource integrity hash, which the templates check
+// too. cmd/vendor only runs to update them.
+var vendoredAssets = map[string]string{
+	"vendor/htmx.min.js": "sha384-FhXw7b6AlE/jyjlZH5iHa/tTe9EpJ1Y55RjcgPbjeWMskSxZt1v9qkxLJWNJaGni",
+}
+
+// devAssets replaces embeddedAssets in development mode, so changed
+// templates and static files show up without a restart.
+var devAssets fs.FS
+
+// embeddedVersions caches the versions of the embedded static files by name.
+var embeddedVersions sync.Map
+
+// embeddedTemplates are parsed once, when the server starts.
+var embeddedTemplates = sync.OnceValues(func() (*template.Template, error) {
+	return parseTemplates(embeddedAssets)
+})
+
+// useDevAssets makes the server read the templates and static files from
+// disk on every request.
+func useDevAssets() {
+	devAssets = os.DirFS(devAssetsDir)
+}
+
+func assets() fs.FS {
+	if devAssets != nil {
+		return devAssets
+	}
+	return embeddedAssets
+}
+
+func readTemplates() (*template.Template, error) {
+	if devAssets != nil {
+		return parseTemplates(devAssets)
+	}
+	return embeddedTemplates()
+}
+
+func parseTemplates(assets fs.FS) (*template.Template, error) {
+	tmpl, err := template.New("").Funcs(templateFuncs).ParseFS(assets, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("parse templates: %w", err)
+	}
+	return tmpl, nil
+}
+
+// checkVendoredAssets fails if a vendored file was changed or deleted, e.g.
+// while working on the static files with -dev. Browsers would refuse it.
+func checkVendoredAssets() error {
+	for name, integrity := range vendoredAssets {
+		content, err := fs.ReadFile(assets(), "static/"+name)
+		if err != nil {
+			return fmt.Errorf("static file %s is missing, restore it with go generate ./server: %w", name, err)
+		}
+		if actual := subresourceIntegrity(content); actual != integrity {
+			return fmt.Errorf("static file %s has the integrity %s instead of %s, restore it with go generate ./server",
+				name, actual, integrity)
+		}
+	}
+	return nil
+}
+
+// subresourceIntegrity returns the hash browsers check for the integrity
+// attribute of a script.
+func subresourceIntegrity(content []byte) string {
+	sum := sha512.Sum384(content)
+	return "sha384-" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// staticVersion returns a hash of the content of a static file. Its URL
+// changes with the content, so browsers may cache it forever.
+func staticVersion(name string) (string, error) {
+	if devAssets == nil {
+		if version, ok := embeddedVersions.Load(name); ok {
+			return version.(string), nil
+		}
+	}
+	content, err := fs.ReadFile(assets(), "static/"+name)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	version := hex.EncodeToString(sum[:8])
+	if devAssets == nil {
+		embeddedVersions.Store(name, version)
+	}
+	return version, nil
+}
+
+// staticURL returns the versioned URL of a static file. Missing files get an
+// unversioned URL, which isn't cached.
+func staticURL(name string) string {
+	version, err := staticVersion(name)
+	if err != nil {
+		return "/static/" + name
+	}
+	return "/static/" + name + "?v=" + version
+}
+
+// serveStatic serves the files of the static directory below /static/.
+// Requests for the current version of a file may be cached for a year,
+// everything else has to be revalidated.
+func serveStatic(w http.ResponseWriter, r *http.Request) {
+	static, err := fs.Sub(assets(), "static")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("static files: %s", err), http.StatusInternalServerError)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/static/")
+	if version, err := staticVersion(name); err == nil && r.URL.Query().Get("v") == version {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		w.Header().Set("Cache-Control", "no-cache")
+	}
+	http.StripPrefix("/static/", http.FileServer(http.FS(static))).ServeHTTP(w, r)
+}
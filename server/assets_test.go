@@ -0,0 +1,115 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEmbeddedTemplates(t *testing.T) {
+	tmpl, err := embeddedTemplates()
+	require.NoError(t, err)
+	for _, name := range []string{"index.html", "login.html", "transactions.html", "upload.html", "tagEditor"} {
+		assert.NotNil(t, tmpl.Lookup(name), name)
+	}
+
+	again, err := readTemplates()
+	require.NoError(t, err)
+	assert.Same(t, tmpl, again, "embedded templates are only parsed once")
+}
+
+func TestServeStatic(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		status      int
+		contentType string
+	}{
+		{name: "stylesheet", path: "/static/styles.css", status: http.StatusOK, contentType: "text/css; charset=utf-8"},
+		{name: "script", path: "/static/csrf.js", status: http.StatusOK, contentType: "text/javascript; charset=utf-8"},
+		{name: "missing", path: "/static/missing.js", status: http.StatusNotFound},
+		{name: "template", path: "/static/templates/login.html", status: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			serveStatic(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, tt.status, w.Code)
+			if tt.contentType != "" {
+				assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			}
+		})
+	}
+}
+
+func TestStaticURL(t *testing.T) {
+	url := staticURL("styles.css")
+	require.True(t, strings.HasPrefix(url, "/static/styles.css?v="), url)
+	assert.Equal(t, url, staticURL("styles.css"))
+	assert.Equal(t, "/static/missing.js", staticURL("missing.js"))
+
+	tests := []struct {
+		name         string
+		path         string
+		cacheControl string
+	}{
+		{name: "current version", path: url, cacheControl: "public, max-age=31536000, immutable"},
+		{name: "old version", path: "/static/styles.css?v=0123456789abcdef", cacheControl: "no-cache"},
+		{name: "unversioned", path: "/static/styles.css", cacheControl: "no-cache"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			contentSecurityPolicy(http.HandlerFunc(serveStatic)).ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.cacheControl, w.Header().Get("Cache-Control"))
+			assert.Equal(t, csp, w.Header().Get("Content-Security-Policy"))
+		})
+	}
+}
+
+func TestCheckVendoredAssets(t *testing.T) {
+	// the embedded files pass
+	require.NoError(t, checkVendoredAssets())
+
+	devAssets = fstest.MapFS{}
+	t.Cleanup(func() { devAssets = nil })
+	assert.ErrorContains(t, checkVendoredAssets(), "go generate ./server")
+
+	// a changed file doesn't pass the integrity check of the browser either
+	devAssets = fstest.MapFS{"static/vendor/htmx.min.js": {Data: []byte("htmx")}}
+	assert.ErrorContains(t, checkVendoredAssets(), "integrity")
+
+	pinned := vendoredAssets
+	t.Cleanup(func() { vendoredAssets = pinned })
+	vendoredAssets = map[string]string{"vendor/htmx.min.js": subresourceIntegrity([]byte("htmx"))}
+	assert.NoError(t, checkVendoredAssets())
+}
+
+func TestSubresourceIntegrity(t *testing.T) {
+	// the hash of an empty file as computed by openssl dgst -sha384 -binary | base64
+	assert.Equal(t, "sha384-OLBgp1GsljhM2TJ+sbHjaiH9txEUvgdDTAzHv2P24donTt6/529l+9Ua0vFImLlb",
+		subresourceIntegrity(nil))
+}
+
+func TestDevAssets(t *testing.T) {
+	// the tests run in the server directory
+	devAssets = os.DirFS(".")
+	t.Cleanup(func() { devAssets = nil })
+
+	first, err := readTemplates()
+	require.NoError(t, err)
+	second, err := readTemplates()
+	require.NoError(t, err)
+	assert.NotSame(t, first, second, "templates are parsed on every request")
+
+	w := httptest.NewRecorder()
+	serveStatic(w, httptest.NewRequest(http.MethodGet, "/static/styles.css", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,457 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Opsi/sparschwein/auth"
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	sessionCookie = "sparschwein_session"
+	// csrfCookie holds the CSRF token of the session, so static/csrf.js can
+	// send it with every htmx request. Before the login it holds the token
+	// of the login form.
+	csrfCookie      = "sparschwein_csrf"
+	csrfHeader      = "X-CSRF-Token"
+	csrfFormField   = "csrf_token"
+	sessionDuration = 30 * 24 * time.Hour
+)
+
+type contextKey int
+
+const (
+	userContextKey contextKey = iota
+	householdContextKey
+)
+
+// currentUser returns the user that was authenticated by the middleware.
+func currentUser(ctx context.Context) *db.User {
+	user, _ := ctx.Value(userContextKey).(*db.User)
+	return user
+}
+
+// currentHousehold returns the id of the household the request may access.
+// All data a handler reads or changes has to belong to it.
+func currentHousehold(ctx context.Context) int {
+	householdID, _ := ctx.Value(householdContextKey).(int)
+	return householdID
+}
+
+// withUser returns a context with the authenticated user and the household
+// the request may access. Its logger names both.
+func withUser(ctx context.Context, user *db.User, householdID int) context.Context {
+	logger := util.Logger(ctx).With(slog.Int("userID", user.ID), slog.Int("householdID", householdID))
+	ctx = util.WithLogger(ctx, logger)
+	ctx = context.WithValue(ctx, userContextKey, user)
+	return context.WithValue(ctx, householdContextKey, householdID)
+}
+
+// householdMenu is the data of the householdMenu template.
+type householdMenu struct {
+	Current    int
+	Households []db.Household
+}
+
+// loginPage is the data of the login.html template.
+type loginPage struct {
+	CSRFToken string
+	Next      string
+	Error     string
+	// OIDCName is the name of the issuer users can log in with instead.
+	OIDCName string
+}
+
+type authenticator struct {
+	dbConn *sqlx.DB
+	// oidc is nil if users can only log in with passwords.
+	oidc *auth.OIDCProvider
+}
+
+func authRoutes(r chi.Router, a *authenticator) {
+	r.Get("/login", a.serveLogin)
+	r.Post("/login", a.login)
+	if a.oidc != nil {
+		r.Get("/login/oidc", a.startOIDCLogin)
+		r.Get("/login/oidc/callback", a.oidcCallback)
+	}
+}
+
+// requireSession lets requests with a valid session cookie pass. Requests
+// that change data additionally need the CSRF token of the session.
+func (a *authenticator) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, ok := a.session(w, r)
+		if !ok {
+			return
+		}
+		if !isSafeMethod(r.Method) {
+			token := r.Header.Get(csrfHeader)
+			if token == "" {
+				token = r.PostFormValue(csrfFormField)
+			}
+			if !equalTokens(token, session.CSRFToken) {
+				http.Error(w, "invalid csrf token", http.StatusForbidden)
+				return
+			}
+		}
+		user, found, err := db.GetUser(r.Context(), a.dbConn, session.UserID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get user: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			redirectToLogin(w, r)
+			return
+		}
+		householdID, ok := a.sessionHousehold(w, r, session)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user, householdID)))
+	})
+}
+
+// sessionHousehold returns the household the session is looking at. If the
+// user isn't a member anymore, the session switches to another household of
+// the user.
+func (a *authenticator) sessionHousehold(w http.ResponseWriter, r *http.Request, session *db.Session) (int, bool) {
+	ctx := r.Context()
+	member, err := db.IsHouseholdMember(ctx, a.dbConn, session.HouseholdID, session.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("check household member: %s", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	if member {
+		return session.HouseholdID, true
+	}
+	households, err := db.GetUserHouseholds(ctx, a.dbConn, session.UserID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get households: %s", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	if len(households) == 0 {
+		http.Error(w, "not a member of any household", http.StatusForbidden)
+		return 0, false
+	}
+	err = db.SetSessionHousehold(ctx, a.dbConn, session.TokenHash, households[0].ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("set session household: %s", err), http.StatusInternalServerError)
+		return 0, false
+	}
+	return households[0].ID, true
+}
+
+// session returns the session of the cookie or redirects to the login.
+func (a *authenticator) session(w http.ResponseWriter, r *http.Request) (*db.Session, bool) {
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		redirectToLogin(w, r)
+		return nil, false
+	}
+	session, found, err := db.GetSession(r.Context(), a.dbConn, auth.HashToken(cookie.Value))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get session: %s", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		redirectToLogin(w, r)
+		return nil, false
+	}
+	return session, true
+}
+
+// requireToken lets API requests with a valid bearer token pass.
+func (a *authenticator) requireToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "missing bearer token")
+			return
+		}
+		apiToken, found, err := db.UseAPIToken(r.Context(), a.dbConn, auth.HashToken(token))
+		if err != nil {
+			writeDBError(w, r, err)
+			return
+		}
+		if !found {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "invalid bearer token")
+			return
+		}
+		user, found, err := db.GetUser(r.Context(), a.dbConn, apiToken.UserID)
+		if err != nil {
+			writeDBError(w, r, err)
+			return
+		}
+		if !found {
+			writeAPIError(w, http.StatusUnauthorized, "unauthorized", "invalid bearer token")
+			return
+		}
+		member, err := db.IsHouseholdMember(r.Context(), a.dbConn, apiToken.HouseholdID, user.ID)
+		if err != nil {
+			writeDBError(w, r, err)
+			return
+		}
+		if !member {
+			writeAPIError(w, http.StatusForbidden, "forbidden", "not a member of the household of the token")
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withUser(r.Context(), user, apiToken.HouseholdID)))
+	})
+}
+
+func (a *authenticator) serveLogin(w http.ResponseWriter, r *http.Request) {
+	a.renderLogin(w, r, http.StatusOK, loginPage{
+		Next: safeRedirect(r.URL.Query().Get("next")),
+	})
+}
+
+// renderLogin shows the login form with a new CSRF token.
+func (a *authenticator) renderLogin(w http.ResponseWriter, r *http.Request, status int, page loginPage) {
+	token, err := auth.NewToken()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("new token: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     "/login",
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	page.CSRFToken = token
+	if a.oidc != nil {
+		page.OIDCName = a.oidc.DisplayName()
+	}
+	w.WriteHeader(status)
+	renderFragment(w, "login.html", page)
+}
+
+func (a *authenticator) login(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	next := safeRedirect(r.PostFormValue("next"))
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || !equalTokens(r.PostFormValue(csrfFormField), cookie.Value) {
+		http.Error(w, "invalid csrf token", http.StatusForbidden)
+		return
+	}
+
+	name, password := r.PostFormValue("name"), r.PostFormValue("password")
+	user, found, err := db.GetUserByName(ctx, a.dbConn, name)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get user: %s", err), http.StatusInternalServerError)
+		return
+	}
+	var valid bool
+	if found {
+		valid = auth.CheckPassword(user.PasswordHash, password)
+	} else {
+		valid = auth.CheckUnknownUser(password)
+	}
+	if !valid {
+		util.Logger(r.Context()).Info("failed login", slog.String("name", name))
+		a.renderLogin(w, r, http.StatusUnauthorized, loginPage{
+			Next:  next,
+			Error: "Unknown name or wrong password.",
+		})
+		return
+	}
+	a.finishLogin(w, r, user, next)
+}
+
+// finishLogin starts a session of the authenticated user in its first
+// household and redirects to next.
+func (a *authenticator) finishLogin(w http.ResponseWriter, r *http.Request, user *db.User, next string) {
+	households, err := db.GetUserHouseholds(r.Context(), a.dbConn, user.ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get households: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if len(households) == 0 {
+		util.Logger(r.Context()).Info("login without household", slog.String("name", user.Name))
+		a.renderLogin(w, r, http.StatusForbidden, loginPage{
+			Next:  next,
+			Error: "Your account isn't a member of any household yet.",
+		})
+		return
+	}
+
+	if err := a.startSession(w, r, user.ID, households[0].ID); err != nil {
+		http.Error(w, fmt.Sprintf("start session: %s", err), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, next, http.StatusSeeOther)
+}
+
+// startSession stores a new session looking at the household and sets its
+// cookies.
+func (a *authenticator) startSession(w http.ResponseWriter, r *http.Request, userID, householdID int) error {
+	ctx := r.Context()
+	if err := db.DeleteExpiredSessions(ctx, a.dbConn); err != nil {
+		return err
+	}
+	token, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	csrfToken, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(sessionDuration)
+	err = db.InsertSession(ctx, a.dbConn, db.Session{
+		TokenHash:   auth.HashToken(token),
+		UserID:      userID,
+		HouseholdID: householdID,
+		CSRFToken:   csrfToken,
+		ExpiresAt:   expires,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the token of the login form isn't needed anymore
+	http.SetCookie(w, &http.Cookie{
+		Name:   csrfCookie,
+		Path:   "/login",
+		MaxAge: -1,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    csrfToken,
+		Path:     "/",
+		Expires:  expires,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+func (a *authenticator) logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(sessionCookie); err == nil {
+		err := db.DeleteSession(r.Context(), a.dbConn, auth.HashToken(cookie.Value))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("delete session: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+	for _, name := range []string{sessionCookie, csrfCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:   name,
+			Path:   "/",
+			MaxAge: -1,
+		})
+	}
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+		return
+	}
+	http.Redirect(w, r, "/login", http.StatusSeeOther)
+}
+
+// redirectToLogin sends the browser to the login page and back to the
+// current page afterwards. htmx requests redirect the whole page.
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/login")
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	target := "/login"
+	if r.Method == http.MethodGet && r.URL.Path != "/" {
+		target += "?next=" + url.QueryEscape(r.URL.RequestURI())
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// safeRedirect only allows redirects to paths of this server.
+func safeRedirect(target string) string {
+	if !strings.HasPrefix(target, "/") || strings.HasPrefix(target, "//") || strings.HasPrefix(target, "/\\") {
+		return "/"
+	}
+	return target
+}
+
+func isSafeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func equalTokens(a, b string) bool {
+	return a != "" && subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// serveHouseholdMenu renders the households of the user, so they can switch
+// between them.
+func (a *authenticator) serveHouseholdMenu(w http.ResponseWriter, r *http.Request) {
+	households, err := db.GetUserHouseholds(r.Context(), a.dbConn, currentUser(r.Context()).ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get households: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderFragment(w, "householdMenu", householdMenu{
+		Current:    currentHousehold(r.Context()),
+		Households: households,
+	})
+}
+
+// switchHousehold lets the session look at another household of the user
+// and reloads the start page, because the current page may show data of the
+// old household.
+func (a *authenticator) switchHousehold(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	householdID, err := strconv.Atoi(r.FormValue("household"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parse household id: %s", err), http.StatusBadRequest)
+		return
+	}
+	member, err := db.IsHouseholdMember(ctx, a.dbConn, householdID, currentUser(ctx).ID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("check household member: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if !member {
+		http.Error(w, "household not found", http.StatusNotFound)
+		return
+	}
+	cookie, err := r.Cookie(sessionCookie)
+	if err != nil {
+		redirectToLogin(w, r)
+		return
+	}
+	err = db.SetSessionHousehold(ctx, a.dbConn, auth.HashToken(cookie.Value), householdID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("set session household: %s", err), http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get("HX-Request") != "" {
+		w.Header().Set("HX-Redirect", "/")
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSafeRedirect(t *testing.T) {
+	tests := []struct {
+		target string
+		want   string
+	}{
+		{target: "", want: "/"},
+		{target: "/transactions?holder=3", want: "/transactions?holder=3"},
+		{target: "https://example.com", want: "/"},
+		{target: "//example.com", want: "/"},
+		{target: "/\\example.com", want: "/"},
+		{target: "transactions", want: "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			assert.Equal(t, tt.want, safeRedirect(tt.target))
+		})
+	}
+}
+
+func TestEqualTokens(t *testing.T) {
+	assert.True(t, equalTokens("abc", "abc"))
+	assert.False(t, equalTokens("abc", "abd"))
+	assert.False(t, equalTokens("", ""))
+}
+
+func TestRequireSessionWithoutCookie(t *testing.T) {
+	a := &authenticator{}
+	handler := a.requireSession(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be called")
+	}))
+
+	tests := []struct {
+		name     string
+		method   string
+		target   string
+		htmx     bool
+		status   int
+		location string
+		redirect string
+	}{
+		{
+			name:     "page",
+			method:   http.MethodGet,
+			target:   "/transactions?holder=3",
+			status:   http.StatusSeeOther,
+			location: "/login?next=%2Ftransactions%3Fholder%3D3",
+		},
+		{
+			name:     "index",
+			method:   http.MethodGet,
+			target:   "/",
+			status:   http.StatusSeeOther,
+			location: "/login",
+		},
+		{
+			name:     "htmx",
+			method:   http.MethodPost,
+			target:   "/htmx/holder/1/favorite",
+			htmx:     true,
+			status:   http.StatusUnauthorized,
+			redirect: "/login",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.target, nil)
+			if tt.htmx {
+				r.Header.Set("HX-Request", "true")
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.location, w.Header().Get("Location"))
+			assert.Equal(t, tt.redirect, w.Header().Get("HX-Redirect"))
+		})
+	}
+}
+
+func TestRequireTokenWithoutHeader(t *testing.T) {
+	a := &authenticator{}
+	handler := a.requireToken(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler must not be called")
+	}))
+
+	for _, header := range []string{"", "Basic dXNlcjpwYXNz", "Bearer "} {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/holders", nil)
+		if header != "" {
+			r.Header.Set("Authorization", header)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(t, http.StatusUnauthorized, w.Code, header)
+		assert.JSONEq(t, `{"error": {"code": "unauthorized", "message": "missing bearer token"}}`, w.Body.String())
+	}
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+)
+
+// svgChart is the data of the svgChart template. The geometry is computed
+// in Go, the template only writes the elements. Colors come from the classes
+// in styles.css, because the CSP doesn't allow inline styles.
+type svgChart struct {
+	Width  float64
+	Height float64
+	// Label describes the chart for screen readers.
+	Label  string
+	Lines  []svgLine
+	Rects  []svgRect
+	Labels []svgText
+}
+
+type svgLine struct {
+	X1, Y1, X2, Y2 float64
+	Class          string
+}
+
+type svgRect struct {
+	X, Y, Width, Height float64
+	Class               string
+	// Title is shown when hovering the rectangle.
+	Title string
+}
+
+type svgText struct {
+	X, Y  float64
+	Text  string
+	Class string
+}
+
+const (
+	cashFlowChartWidth  = 720
+	cashFlowChartHeight = 260
+	// the axis labels are left of the plot, the months below it
+	cashFlowPlotLeft   = 80
+	cashFlowPlotTop    = 10
+	cashFlowPlotBottom = 230
+	cashFlowTicks      = 4
+
+	spendingChartWidth = 720
+	spendingRowHeight  = 28
+	spendingBarLeft    = 180
+	spendingBarRight   = 600
+)
+
+// newCashFlowChart draws the income and expenses of each month from the
+// first to the last month as pairs of bars. Months without transactions get
+// empty bars.
+func newCashFlowChart(months []time.Time, cashFlows []db.CashFlow) svgChart {
+	chart := svgChart{
+		Width:  cashFlowChartWidth,
+		Height: cashFlowChartHeight,
+		Label:  "Income and expenses per month",
+	}
+	byMonth := make(map[string]db.CashFlow, len(cashFlows))
+	maxAmount := 0
+	for _, cashFlow := range cashFlows {
+		byMonth[cashFlow.Month.Format("2006-01")] = cashFlow
+		maxAmount = max(maxAmount, cashFlow.IncomeInCents, cashFlow.ExpensesInCents)
+	}
+
+	step := tickStep(maxAmount, cashFlowTicks)
+	axisMax := step * cashFlowTicks
+	plotHeight := float64(cashFlowPlotBottom - cashFlowPlotTop)
+	y := func(cents int) float64 {
+		return cashFlowPlotBottom - plotHeight*float64(cents)/float64(axisMax)
+	}
+	for tick := 0; tick <= cashFlowTicks; tick++ {
+		tickY := y(tick * step)
+		chart.Lines = append(chart.Lines, svgLine{
+			X1: cashFlowPlotLeft, Y1: tickY, X2: cashFlowChartWidth, Y2: tickY,
+			Class: "chart-grid",
+		})
+		chart.Labels = append(chart.Labels, svgText{
+			X: cashFlowPlotLeft - 8, Y: tickY + 4,
+			Text:  formatEuros(tick * step),
+			Class: "chart-axis-label",
+		})
+	}
+	if len(months) == 0 {
+		return chart
+	}
+
+	groupWidth := float64(cashFlowChartWidth-cashFlowPlotLeft) / float64(len(months))
+	barWidth := groupWidth * 0.35
+	// label every month as long as the labels fit, otherwise only some
+	labelEvery := int(math.Ceil(56 / groupWidth))
+	for i, month := range months {
+		cashFlow := byMonth[month.Format("2006-01")]
+		left := cashFlowPlotLeft + float64(i)*groupWidth + groupWidth*0.15
+		name := month.Format("Jan 2006")
+		chart.Rects = append(chart.Rects,
+			svgRect{
+				X: left, Y: y(cashFlow.IncomeInCents),
+				Width: barWidth, Height: cashFlowPlotBottom - y(cashFlow.IncomeInCents),
+				Class: "chart-income",
+				Title: name + " income: " + util.FormatCents(cashFlow.IncomeInCents) + " €",
+			},
+			svgRect{
+				X: left + barWidth, Y: y(cashFlow.ExpensesInCents),
+				Width: barWidth, Height: cashFlowPlotBottom - y(cashFlow.ExpensesInCents),
+				Class: "chart-expenses",
+				Title: name + " expenses: " + util.FormatCents(cashFlow.ExpensesInCents) + " €",
+			})
+		if i%labelEvery == 0 {
+			chart.Labels = append(chart.Labels, svgText{
+				X: left + barWidth, Y: cashFlowChartHeight - 10,
+				Text:  month.Format("Jan 06"),
+				Class: "chart-month-label",
+			})
+		}
+	}
+	return chart
+}
+
+// newSpendingChart draws a horizontal bar for each top-level tag, scaled to
+// the largest one.
+func newSpendingChart(spending []db.TagSpending) svgChart {
+	chart := svgChart{
+		Width:  spendingChartWidth,
+		Height: float64(len(spending) * spendingRowHeight),
+		Label:  "Expenses by tag",
+	}
+	maxAmount := 0
+	for _, tag := range spending {
+		maxAmount = max(maxAmount, tag.AmountInCents)
+	}
+	for i, tag := range spending {
+		name := tag.Name
+		class := "chart-expenses"
+		if tag.TagID == nil {
+			name = "Untagged"
+			class = "chart-untagged"
+		}
+		top := float64(i * spendingRowHeight)
+		width := 0.0
+		if maxAmount > 0 {
+			width = (spendingBarRight - spendingBarLeft) * float64(tag.AmountInCents) / float64(maxAmount)
+		}
+		amount := util.FormatCents(tag.AmountInCents) + " €"
+		chart.Labels = append(chart.Labels,
+			svgText{X: spendingBarLeft - 8, Y: top + 18, Text: name, Class: "chart-axis-label"},
+			svgText{X: spendingBarLeft + width + 8, Y: top + 18, Text: amount, Class: "chart-value-label"})
+		chart.Rects = append(chart.Rects, svgRect{
+			X: spendingBarLeft, Y: top + 4,
+			Width: width, Height: spendingRowHeight - 8,
+			Class: class,
+			Title: name + ": " + amount,
+		})
+	}
+	return chart
+}
+
+// tickStep returns a round step in cents, e.g. 50 or 200 euros, so that
+// ticks of the step cover the amount.
+func tickStep(maxCents int, ticks int) int {
+	raw := float64(maxCents) / float64(ticks)
+	if raw <= 100 {
+		return 100
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(raw)))
+	for _, factor := range []float64{1, 2, 5, 10} {
+		if step := factor * magnitude; step >= raw {
+			return int(step)
+		}
+	}
+	return int(10 * magnitude)
+}
+
+// formatEuros formats whole euros without the cents.
+func formatEuros(cents int) string {
+	return strings.TrimSuffix(util.FormatCents(cents), ",00") + " €"
+}
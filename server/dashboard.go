@@ -0,0 +1,131 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// dashboardMonths is the period shown by default, up to the current
+	// month.
+	dashboardMonths = 12
+	// maxDashboardMonths caps the period, so a request can't make the
+	// server build charts with thousands of months.
+	maxDashboardMonths = 10 * 12
+	// topCounterparties is the number of counterparties listed.
+	topCounterparties = 10
+	monthLayout       = "2006-01"
+)
+
+// dashboardPeriod are the months from From to To, both inclusive.
+type dashboardPeriod struct {
+	From time.Time
+	To   time.Time
+}
+
+// end is the first moment after the period.
+func (p dashboardPeriod) end() time.Time {
+	return p.To.AddDate(0, 1, 0)
+}
+
+// months returns the first day of every month of the period.
+func (p dashboardPeriod) months() []time.Time {
+	var months []time.Time
+	for month := p.From; !month.After(p.To); month = month.AddDate(0, 1, 0) {
+		months = append(months, month)
+	}
+	return months
+}
+
+// dashboard is the data of the dashboard.html page and its dashboardCharts
+// fragment.
+type dashboard struct {
+	From            string
+	To              string
+	Error           string
+	CashFlow        svgChart
+	Spending        svgChart
+	IncomeInCents   int
+	ExpensesInCents int
+	Counterparties  []db.CounterpartyTotal
+}
+
+// parseDashboardPeriod reads the months from and to like 2006-01. Missing
+// months default to the last dashboardMonths months up to now. The period
+// may span at most maxDashboardMonths months.
+func parseDashboardPeriod(r *http.Request, now time.Time, loc *time.Location) (dashboardPeriod, error) {
+	now = now.In(loc)
+	current := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, loc)
+	period := dashboardPeriod{
+		From: current.AddDate(0, 1-dashboardMonths, 0),
+		To:   current,
+	}
+	query := r.URL.Query()
+	if value := query.Get("from"); value != "" {
+		from, err := time.ParseInLocation(monthLayout, value, loc)
+		if err != nil {
+			return period, fmt.Errorf("from must be a month like 2006-01")
+		}
+		period.From = from
+	}
+	if value := query.Get("to"); value != "" {
+		to, err := time.ParseInLocation(monthLayout, value, loc)
+		if err != nil {
+			return period, fmt.Errorf("to must be a month like 2006-01")
+		}
+		period.To = to
+	}
+	if period.From.After(period.To) {
+		return period, fmt.Errorf("from must not be after to")
+	}
+	if period.From.AddDate(0, maxDashboardMonths, 0).Before(period.end()) {
+		return period, fmt.Errorf("the period must not be longer than %d years", maxDashboardMonths/12)
+	}
+	return period, nil
+}
+
+// serveDashboard renders the whole page for /dashboard and only the charts
+// for the htmx requests of the period form.
+func serveDashboard(dbConn *sqlx.DB, loc *time.Location, fragment string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		period, err := parseDashboardPeriod(r, time.Now(), loc)
+		page := dashboard{
+			From: period.From.Format(monthLayout),
+			To:   period.To.Format(monthLayout),
+		}
+		if err != nil {
+			page.Error = err.Error()
+			renderFragment(w, fragment, page)
+			return
+		}
+
+		ctx, householdID := r.Context(), currentHousehold(r.Context())
+		cashFlows, err := db.GetFavoritesCashFlow(ctx, dbConn, householdID, period.From, period.end())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get cash flow: %s", err), http.StatusInternalServerError)
+			return
+		}
+		spending, err := db.GetSpendingByTag(ctx, dbConn, householdID, period.From, period.end())
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get spending: %s", err), http.StatusInternalServerError)
+			return
+		}
+		page.Counterparties, err = db.GetTopCounterparties(ctx, dbConn, householdID, period.From, period.end(), topCounterparties)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get counterparties: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		for _, cashFlow := range cashFlows {
+			page.IncomeInCents += cashFlow.IncomeInCents
+			page.ExpensesInCents += cashFlow.ExpensesInCents
+		}
+		page.CashFlow = newCashFlowChart(period.months(), cashFlows)
+		page.Spending = newSpendingChart(spending)
+		renderFragment(w, fragment, page)
+	}
+}
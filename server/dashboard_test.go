@@ -0,0 +1,249 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDashboardPeriod(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+	// already March in Berlin
+	now := time.Date(2023, 2, 28, 23, 30, 0, 0, time.UTC)
+	month := func(year int, month time.Month) time.Time {
+		return time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	}
+
+	tests := []struct {
+		name    string
+		query   string
+		want    dashboardPeriod
+		wantErr string
+	}{
+		{
+			name: "last twelve months",
+			want: dashboardPeriod{From: month(2022, time.April), To: month(2023, time.March)},
+		},
+		{
+			name:  "from and to",
+			query: "from=2022-01&to=2022-06",
+			want:  dashboardPeriod{From: month(2022, time.January), To: month(2022, time.June)},
+		},
+		{
+			name:  "single month",
+			query: "from=2022-01&to=2022-01",
+			want:  dashboardPeriod{From: month(2022, time.January), To: month(2022, time.January)},
+		},
+		{name: "invalid from", query: "from=2022-13", wantErr: "from must be a month"},
+		{name: "invalid to", query: "to=01.2022", wantErr: "to must be a month"},
+		{name: "reversed", query: "from=2022-06&to=2022-01", wantErr: "from must not be after to"},
+		{
+			name:  "ten years",
+			query: "from=2013-01&to=2022-12",
+			want:  dashboardPeriod{From: month(2013, time.January), To: month(2022, time.December)},
+		},
+		{name: "too long", query: "from=2013-01&to=2023-01", wantErr: "must not be longer than 10 years"},
+		{name: "too long from", query: "from=0001-01", wantErr: "must not be longer than 10 years"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/dashboard?"+tt.query, nil)
+			period, err := parseDashboardPeriod(r, now, loc)
+			if tt.wantErr != "" {
+				assert.ErrorContains(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.want.From.Equal(period.From), period.From)
+			assert.True(t, tt.want.To.Equal(period.To), period.To)
+		})
+	}
+
+	period := dashboardPeriod{From: month(2022, time.November), To: month(2023, time.January)}
+	assert.Len(t, period.months(), 3)
+	assert.True(t, month(2023, time.February).Equal(period.end()))
+}
+
+func TestDashboardShowsPeriodErrors(t *testing.T) {
+	// invalid periods are rejected before the database is used
+	handler := serveDashboard(nil, time.UTC, "dashboardCharts")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard?from=1900-01&to=2023-01", nil))
+	// htmx doesn't swap error responses
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `class="edit-error"`)
+	assert.Contains(t, w.Body.String(), "must not be longer than 10 years")
+}
+
+func TestTickStep(t *testing.T) {
+	tests := []struct {
+		maxCents int
+		want     int
+	}{
+		{maxCents: 0, want: 100},
+		{maxCents: 350, want: 100},
+		{maxCents: 1000, want: 500},
+		{maxCents: 123456, want: 50000},
+		{maxCents: 400000, want: 100000},
+		{maxCents: 400001, want: 200000},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, tickStep(tt.maxCents, 4), tt.maxCents)
+	}
+}
+
+func TestNewCashFlowChart(t *testing.T) {
+	months := []time.Time{
+		time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 2, 1, 0, 0, 0, 0, time.UTC),
+		time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC),
+	}
+	chart := newCashFlowChart(months, []db.CashFlow{
+		{Month: months[0], IncomeInCents: 400000, ExpensesInCents: 100000},
+		{Month: months[2], IncomeInCents: 200000, ExpensesInCents: 300000},
+	})
+
+	require.Len(t, chart.Rects, 6)
+	january, february, march := chart.Rects[0:2], chart.Rects[2:4], chart.Rects[4:6]
+	plotHeight := float64(cashFlowPlotBottom - cashFlowPlotTop)
+	assert.Equal(t, "chart-income", january[0].Class)
+	assert.Equal(t, "chart-expenses", january[1].Class)
+	assert.InDelta(t, plotHeight, january[0].Height, 0.001)
+	assert.InDelta(t, plotHeight/4, january[1].Height, 0.001)
+	assert.Zero(t, february[0].Height)
+	assert.Zero(t, february[1].Height)
+	assert.InDelta(t, plotHeight*3/4, march[1].Height, 0.001)
+	assert.Equal(t, "Mar 2023 expenses: 3.000,00 €", march[1].Title)
+	for _, rect := range chart.Rects {
+		assert.InDelta(t, cashFlowPlotBottom, rect.Y+rect.Height, 0.001)
+	}
+
+	var labels []string
+	for _, label := range chart.Labels {
+		labels = append(labels, label.Text)
+	}
+	assert.Equal(t, []string{"0 €", "1.000 €", "2.000 €", "3.000 €", "4.000 €", "Jan 23", "Feb 23", "Mar 23"}, labels)
+	assert.Len(t, chart.Lines, cashFlowTicks+1)
+}
+
+func TestNewSpendingChart(t *testing.T) {
+	groceries := 1
+	chart := newSpendingChart([]db.TagSpending{
+		{TagID: &groceries, Name: "Groceries", AmountInCents: 20000},
+		{Name: "", AmountInCents: 5000},
+	})
+	require.Len(t, chart.Rects, 2)
+	assert.Equal(t, float64(2*spendingRowHeight), chart.Height)
+	assert.InDelta(t, spendingBarRight-spendingBarLeft, chart.Rects[0].Width, 0.001)
+	assert.InDelta(t, (spendingBarRight-spendingBarLeft)/4, chart.Rects[1].Width, 0.001)
+	assert.Equal(t, "chart-untagged", chart.Rects[1].Class)
+	assert.Equal(t, "Untagged: 50,00 €", chart.Rects[1].Title)
+
+	assert.Empty(t, newSpendingChart(nil).Rects)
+}
+
+func TestDashboardTemplate(t *testing.T) {
+	tmpl, err := readTemplates()
+	require.NoError(t, err)
+	month := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	fun := 1
+	var out strings.Builder
+	err = tmpl.ExecuteTemplate(&out, "dashboardCharts", dashboard{
+		CashFlow: newCashFlowChart([]time.Time{month}, []db.CashFlow{{Month: month, IncomeInCents: 100}}),
+		Spending: newSpendingChart([]db.TagSpending{{TagID: &fun, Name: "<Fun>", AmountInCents: 100}}),
+		Counterparties: []db.CounterpartyTotal{
+			{Name: "Employer", IncomeInCents: 100},
+		},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `<svg class="chart" viewBox="0 0 720 260"`)
+	assert.Contains(t, out.String(), `<rect x="176.0" y="175.0" width="224.0"`)
+	assert.Contains(t, out.String(), `<title>Jan 2023 income: 1,00 €</title>`)
+	assert.Contains(t, out.String(), "&lt;Fun&gt;")
+	assert.Contains(t, out.String(), "Employer")
+	assert.NotContains(t, out.String(), "style=", "the CSP blocks inline styles")
+}
+
+func TestDashboardReports(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	alice := newHouseholdFixture(t, ctx, dbConn, "alice")
+	bob := newHouseholdFixture(t, ctx, dbConn, "bob")
+	for _, fixture := range []householdFixture{alice, bob} {
+		_, err := db.ToggleHolderFavorite(ctx, dbConn, fixture.HouseholdID, fixture.Holder.ID)
+		require.NoError(t, err)
+	}
+
+	// the fixture paid 12,34 € to the shop on 2023-05-01
+	savings, err := db.InsertHolder(ctx, dbConn, alice.HouseholdID, db.CreateHolder{
+		HolderIdentifier: db.HolderIdentifier{Type: "name", Identifier: "alice savings"},
+		Name:             "alice savings",
+		ParentHolderID:   &alice.Holder.ID,
+	})
+	require.NoError(t, err)
+	employer, err := db.InsertHolder(ctx, dbConn, alice.HouseholdID, db.CreateHolder{
+		HolderIdentifier: db.HolderIdentifier{Type: "name", Identifier: "employer"},
+		Name:             "Employer",
+	})
+	require.NoError(t, err)
+	supermarket, err := db.InsertTag(ctx, dbConn, alice.HouseholdID, db.CreateTag{Name: "Supermarket", ParentTagID: &alice.Tag.ID})
+	require.NoError(t, err)
+	require.NoError(t, db.AttachTransactionTag(ctx, dbConn, alice.HouseholdID, alice.TransactionID, supermarket.ID))
+	insert := func(from, to int, amount int, day time.Time) {
+		_, err := db.InsertTransaction(ctx, dbConn, alice.HouseholdID, db.CreateTransaction{
+			BaseTransaction: db.BaseTransaction{AmountInCents: amount, Timestamp: day, BookingDate: day, ValueDate: day},
+			FromHolderID:    from,
+			ToHolderID:      to,
+		})
+		require.NoError(t, err)
+	}
+	may, june := time.Date(2023, 5, 15, 12, 0, 0, 0, time.UTC), time.Date(2023, 6, 15, 12, 0, 0, 0, time.UTC)
+	insert(employer.ID, alice.Holder.ID, 300000, may)
+	insert(alice.Holder.ID, savings.ID, 50000, may)
+	insert(savings.ID, alice.Other.ID, 1000, june)
+	insert(employer.ID, alice.Holder.ID, 300000, june)
+
+	from, to := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+	cashFlows, err := db.GetFavoritesCashFlow(ctx, dbConn, alice.HouseholdID, from, to)
+	require.NoError(t, err)
+	require.Len(t, cashFlows, 2)
+	assert.Equal(t, 300000, cashFlows[0].IncomeInCents)
+	assert.Equal(t, 1234, cashFlows[0].ExpensesInCents)
+	assert.Equal(t, 50000, cashFlows[0].InternalInCents)
+	assert.Equal(t, 1000, cashFlows[1].ExpensesInCents)
+
+	spending, err := db.GetSpendingByTag(ctx, dbConn, alice.HouseholdID, from, to)
+	require.NoError(t, err)
+	require.Len(t, spending, 2)
+	assert.Equal(t, &alice.Tag.ID, spending[0].TagID)
+	assert.Equal(t, "Groceries", spending[0].Name)
+	assert.Equal(t, 1234, spending[0].AmountInCents)
+	assert.Nil(t, spending[1].TagID)
+	assert.Equal(t, 1000, spending[1].AmountInCents)
+
+	counterparties, err := db.GetTopCounterparties(ctx, dbConn, alice.HouseholdID, from, to, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []db.CounterpartyTotal{{HolderID: employer.ID, Name: "Employer", IncomeInCents: 600000}}, counterparties)
+
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+	w := alice.pageRequest(t, handler, http.MethodGet, "/htmx/dashboard?from=2023-05&to=2023-06", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Contains(t, w.Body.String(), "Employer")
+	assert.Contains(t, w.Body.String(), "6.000,00 €")
+	assert.NotContains(t, w.Body.String(), "bob shop")
+
+	w = bob.pageRequest(t, handler, http.MethodGet, "/htmx/dashboard?from=2023-05&to=2023-06", nil)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.NotContains(t, w.Body.String(), "Employer")
+	assert.Contains(t, w.Body.String(), "bob shop")
+}
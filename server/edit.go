@@ -0,0 +1,284 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// tagEditor is the data of the tagEditor template. URL is the base of the
+// endpoints that attach and detach the tags.
+type tagEditor struct {
+	URL       string
+	Tags      []db.Tag
+	Available []db.Tag
+}
+
+// newTagEditor offers all tags that aren't attached yet.
+func newTagEditor(url string, attached []db.Tag, all []db.Tag) tagEditor {
+	isAttached := make(map[int]bool, len(attached))
+	for _, tag := range attached {
+		isAttached[tag.ID] = true
+	}
+	editor := tagEditor{
+		URL:  url,
+		Tags: attached,
+	}
+	for _, tag := range all {
+		if !isAttached[tag.ID] {
+			editor.Available = append(editor.Available, tag)
+		}
+	}
+	return editor
+}
+
+// holderNameForm is the data of the holderNameForm template.
+type holderNameForm struct {
+	Holder db.Holder
+	Error  string
+}
+
+// taggable connects the tag editor to holders or transactions.
+type taggable struct {
+	path   string
+	get    func(ctx context.Context, db sqlx.QueryerContext, householdID, id int) ([]db.Tag, error)
+	attach func(ctx context.Context, db sqlx.ExtContext, householdID, id, tagID int) error
+	detach func(ctx context.Context, db sqlx.ExecerContext, householdID, id, tagID int) error
+}
+
+var (
+	holderTags = taggable{
+		path:   "holder",
+		get:    db.GetHolderTags,
+		attach: db.AttachHolderTag,
+		detach: db.DetachHolderTag,
+	}
+	transactionTags = taggable{
+		path:   "transaction",
+		get:    db.GetTransactionTags,
+		attach: db.AttachTransactionTag,
+		detach: db.DetachTransactionTag,
+	}
+)
+
+func editRoutes(r chi.Router, dbConn *sqlx.DB) {
+	r.Post("/holder/{id}/favorite", func(w http.ResponseWriter, r *http.Request) {
+		holderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse holder id: %s", err), http.StatusBadRequest)
+			return
+		}
+		favorite, err := db.ToggleHolderFavorite(r.Context(), dbConn, currentHousehold(r.Context()), holderID)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "holder not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("toggle favorite: %s", err), http.StatusInternalServerError)
+			return
+		}
+		holder := db.Holder{ID: holderID}
+		holder.Favorite = favorite
+		renderFragment(w, "favoriteStar", holder)
+	})
+
+	r.Get("/holder/{id}/name", func(w http.ResponseWriter, r *http.Request) {
+		holder, ok := urlHolder(w, r, dbConn)
+		if !ok {
+			return
+		}
+		renderFragment(w, "holderName", holder)
+	})
+
+	r.Get("/holder/{id}/name/edit", func(w http.ResponseWriter, r *http.Request) {
+		holder, ok := urlHolder(w, r, dbConn)
+		if !ok {
+			return
+		}
+		renderFragment(w, "holderNameForm", holderNameForm{Holder: *holder})
+	})
+
+	r.Post("/holder/{id}/name", func(w http.ResponseWriter, r *http.Request) {
+		holder, ok := urlHolder(w, r, dbConn)
+		if !ok {
+			return
+		}
+		name := strings.TrimSpace(r.FormValue("name"))
+		if name == "" {
+			renderFragment(w, "holderNameForm", holderNameForm{
+				Holder: *holder,
+				Error:  "The name can't be empty.",
+			})
+			return
+		}
+		if err := db.RenameHolder(r.Context(), dbConn, holder.HouseholdID, holder.ID, name); err != nil {
+			http.Error(w, fmt.Sprintf("rename holder: %s", err), http.StatusInternalServerError)
+			return
+		}
+		holder.Name = name
+		renderFragment(w, "holderName", holder)
+	})
+
+	r.Post("/holder/{id}/parent", func(w http.ResponseWriter, r *http.Request) {
+		holderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse holder id: %s", err), http.StatusBadRequest)
+			return
+		}
+		var parentID *int
+		if parent := r.FormValue("parent"); parent != "" {
+			id, err := strconv.Atoi(parent)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("parse parent id: %s", err), http.StatusBadRequest)
+				return
+			}
+			parentID = &id
+		}
+
+		var message string
+		err = db.SetHolderParent(r.Context(), dbConn, currentHousehold(r.Context()), holderID, parentID)
+		switch {
+		case errors.Is(err, db.ErrHolderCycle):
+			message = "The parent can't be the holder itself or one of its descendants."
+		case errors.Is(err, db.ErrInvalidReference):
+			message = "The parent doesn't exist."
+		case errors.Is(err, db.ErrNotFound):
+			http.Error(w, "holder not found", http.StatusNotFound)
+			return
+		case err != nil:
+			http.Error(w, fmt.Sprintf("set parent: %s", err), http.StatusInternalServerError)
+			return
+		}
+
+		detail, found, err := loadHolderDetail(r, dbConn, holderID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("load holder: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "holder not found", http.StatusNotFound)
+			return
+		}
+		detail.Error = message
+		renderFragment(w, "holderInfo.html", detail)
+	})
+
+	tagRoutes(r, dbConn, holderTags)
+	tagRoutes(r, dbConn, transactionTags)
+}
+
+// tagRoutes lets the tag editor list, attach and detach tags. Each returns
+// the updated editor.
+func tagRoutes(r chi.Router, dbConn *sqlx.DB, target taggable) {
+	base := "/" + target.path + "/{id}/tags"
+	r.Get(base, func(w http.ResponseWriter, r *http.Request) {
+		renderTagEditor(w, r, dbConn, target)
+	})
+	r.Post(base, func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse %s id: %s", target.path, err), http.StatusBadRequest)
+			return
+		}
+		tagID, err := strconv.Atoi(r.FormValue("tag"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse tag id: %s", err), http.StatusBadRequest)
+			return
+		}
+		err = target.attach(r.Context(), dbConn, currentHousehold(r.Context()), id, tagID)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, target.path+" or tag not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("attach tag: %s", err), http.StatusInternalServerError)
+			return
+		}
+		renderTagEditor(w, r, dbConn, target)
+	})
+	r.Delete(base+"/{tagID}", func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse %s id: %s", target.path, err), http.StatusBadRequest)
+			return
+		}
+		tagID, err := strconv.Atoi(chi.URLParam(r, "tagID"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse tag id: %s", err), http.StatusBadRequest)
+			return
+		}
+		err = target.detach(r.Context(), dbConn, currentHousehold(r.Context()), id, tagID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("detach tag: %s", err), http.StatusInternalServerError)
+			return
+		}
+		renderTagEditor(w, r, dbConn, target)
+	})
+}
+
+func renderTagEditor(w http.ResponseWriter, r *http.Request, dbConn *sqlx.DB, target taggable) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parse %s id: %s", target.path, err), http.StatusBadRequest)
+		return
+	}
+	editor, err := loadTagEditor(r.Context(), dbConn, currentHousehold(r.Context()), target, id)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("load tags: %s", err), http.StatusInternalServerError)
+		return
+	}
+	renderFragment(w, "tagEditor", editor)
+}
+
+func loadTagEditor(ctx context.Context, dbConn *sqlx.DB, householdID int, target taggable, id int) (tagEditor, error) {
+	attached, err := target.get(ctx, dbConn, householdID, id)
+	if err != nil {
+		return tagEditor{}, fmt.Errorf("get %s tags: %w", target.path, err)
+	}
+	all, err := db.GetTags(ctx, dbConn, householdID)
+	if err != nil {
+		return tagEditor{}, fmt.Errorf("get tags: %w", err)
+	}
+	url := fmt.Sprintf("/htmx/%s/%d/tags", target.path, id)
+	return newTagEditor(url, attached, all), nil
+}
+
+// urlHolder loads the holder of the id path parameter and writes an error if
+// there is none.
+func urlHolder(w http.ResponseWriter, r *http.Request, dbConn *sqlx.DB) (*db.Holder, bool) {
+	holderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, fmt.Sprintf("parse holder id: %s", err), http.StatusBadRequest)
+		return nil, false
+	}
+	holder, found, err := db.GetHolder(r.Context(), dbConn, currentHousehold(r.Context()), holderID)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("get holder: %s", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !found {
+		http.Error(w, "holder not found", http.StatusNotFound)
+		return nil, false
+	}
+	return holder, true
+}
+
+func renderFragment(w http.ResponseWriter, name string, data any) {
+	tmpl, err := readTemplates()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.ExecuteTemplate(w, name, data)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewTagEditor(t *testing.T) {
+	tag := func(id int, name string) db.Tag {
+		return db.Tag{ID: id, CreateTag: db.CreateTag{Name: name}}
+	}
+	all := []db.Tag{tag(1, "Food"), tag(2, "Rent"), tag(3, "Travel")}
+
+	tests := []struct {
+		name      string
+		attached  []db.Tag
+		available []db.Tag
+	}{
+		{
+			name:      "nothing attached",
+			available: all,
+		},
+		{
+			name:      "some attached",
+			attached:  []db.Tag{tag(2, "Rent")},
+			available: []db.Tag{tag(1, "Food"), tag(3, "Travel")},
+		},
+		{
+			name:     "all attached",
+			attached: all,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			editor := newTagEditor("/htmx/holder/1/tags", tt.attached, all)
+			assert.Equal(t, "/htmx/holder/1/tags", editor.URL)
+			assert.Equal(t, tt.attached, editor.Tags)
+			assert.Equal(t, tt.available, editor.Available)
+		})
+	}
+}
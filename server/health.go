@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/metrics"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jmoiron/sqlx"
+)
+
+// readyTimeout limits the database checks of /readyz.
+const readyTimeout = 2 * time.Second
+
+// serverMetrics are served at /metrics.
+type serverMetrics struct {
+	registry   *metrics.Registry
+	requests   *metrics.CounterVec
+	latency    *metrics.HistogramVec
+	importRows *metrics.CounterVec
+}
+
+func newServerMetrics(dbConn *sqlx.DB) *serverMetrics {
+	registry := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: registry,
+		requests: registry.NewCounterVec("sparschwein_http_requests_total",
+			"HTTP requests by method, route and status code.", "method", "route", "status"),
+		latency: registry.NewHistogramVec("sparschwein_http_request_duration_seconds",
+			"Latency of HTTP requests by method and route.", metrics.DefaultBuckets, "method", "route"),
+		importRows: registry.NewCounterVec("sparschwein_import_rows_total",
+			"Rows of imported bank exports by format and result: parsed, inserted, skipped as duplicate or rejected.",
+			"format", "result"),
+	}
+	if dbConn == nil {
+		return m
+	}
+	dbGauge := func(name, help string, value func(stats sql.DBStats) float64) {
+		registry.NewGaugeFunc("sparschwein_db_"+name, help, func() float64 {
+			return value(dbConn.Stats())
+		})
+	}
+	dbCounter := func(name, help string, value func(stats sql.DBStats) float64) {
+		registry.NewCounterFunc("sparschwein_db_"+name, help, func() float64 {
+			return value(dbConn.Stats())
+		})
+	}
+	dbGauge("max_open_connections", "Maximum number of open database connections.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxOpenConnections) })
+	dbGauge("open_connections", "Open database connections.",
+		func(stats sql.DBStats) float64 { return float64(stats.OpenConnections) })
+	dbGauge("in_use_connections", "Database connections in use.",
+		func(stats sql.DBStats) float64 { return float64(stats.InUse) })
+	dbGauge("idle_connections", "Idle database connections.",
+		func(stats sql.DBStats) float64 { return float64(stats.Idle) })
+	dbCounter("wait_count_total", "Times a query waited for a database connection.",
+		func(stats sql.DBStats) float64 { return float64(stats.WaitCount) })
+	dbCounter("wait_duration_seconds_total", "Time spent waiting for database connections.",
+		func(stats sql.DBStats) float64 { return stats.WaitDuration.Seconds() })
+	dbCounter("max_idle_closed_total", "Connections closed because of the idle limit.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxIdleClosed) })
+	dbCounter("max_idle_time_closed_total", "Connections closed because they were idle too long.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxIdleTimeClosed) })
+	dbCounter("max_lifetime_closed_total", "Connections closed because of their maximum lifetime.",
+		func(stats sql.DBStats) float64 { return float64(stats.MaxLifetimeClosed) })
+	return m
+}
+
+// instrument counts the requests by the chi route that handled them, so
+// the IDs in paths don't make up new series.
+func (m *serverMetrics) instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		m.requests.Add(1, r.Method, route, strconv.Itoa(status))
+		m.latency.Observe(time.Since(start).Seconds(), r.Method, route)
+	})
+}
+
+// recordImport counts the rows of an imported export.
+func (m *serverMetrics) recordImport(format string, summary *upload.Summary) {
+	m.importRows.Add(float64(summary.TransactionsInserted+summary.Duplicates), format, "parsed")
+	m.importRows.Add(float64(summary.TransactionsInserted), format, "inserted")
+	m.importRows.Add(float64(summary.Duplicates), format, "skipped")
+	m.importRows.Add(float64(summary.Rejected), format, "rejected")
+}
+
+// serveHealth tells that the process is up.
+func serveHealth(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	io.WriteString(w, "ok\n")
+}
+
+// serveReady tells whether the database can be reached and has the schema
+// this version expects.
+func serveReady(dbConn *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if err := checkReady(r.Context(), dbConn); err != nil {
+			util.Logger(r.Context()).Warn("not ready", slog.String("error", err.Error()))
+			w.WriteHeader(http.StatusServiceUnavailable)
+			fmt.Fprintf(w, "%s\n", err)
+			return
+		}
+		io.WriteString(w, "ok\n")
+	}
+}
+
+func checkReady(ctx context.Context, dbConn *sqlx.DB) error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	if err := dbConn.PingContext(ctx); err != nil {
+		return fmt.Errorf("ping database: %w", err)
+	}
+	version, err := db.GetSchemaVersion(ctx, dbConn)
+	if err != nil {
+		return err
+	}
+	if version != db.SchemaVersion {
+		return fmt.Errorf("schema version is %d instead of %d, run cmd/dbseed", version, db.SchemaVersion)
+	}
+	return nil
+}
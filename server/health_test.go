@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHealth(t *testing.T) {
+	w := httptest.NewRecorder()
+	serveHealth(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "ok\n", w.Body.String())
+}
+
+func TestServerMetrics(t *testing.T) {
+	m := newServerMetrics(nil)
+	r := chi.NewRouter()
+	r.Use(m.instrument)
+	r.Route("/htmx", func(r chi.Router) {
+		r.Get("/holder/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	for _, path := range []string{"/htmx/holder/1", "/htmx/holder/2", "/missing"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+	m.recordImport("dkb", &upload.Summary{TransactionsInserted: 3, Duplicates: 2, Rejected: 1})
+
+	var out strings.Builder
+	_, err := m.registry.WriteTo(&out)
+	require.NoError(t, err)
+	for _, line := range []string{
+		`sparschwein_http_requests_total{method="GET",route="/htmx/holder/{id}",status="200"} 2`,
+		`sparschwein_http_requests_total{method="GET",route="unmatched",status="404"} 1`,
+		`sparschwein_http_request_duration_seconds_count{method="GET",route="/htmx/holder/{id}"} 2`,
+		`sparschwein_import_rows_total{format="dkb",result="parsed"} 5`,
+		`sparschwein_import_rows_total{format="dkb",result="inserted"} 3`,
+		`sparschwein_import_rows_total{format="dkb",result="rejected"} 1`,
+		`sparschwein_import_rows_total{format="dkb",result="skipped"} 2`,
+	} {
+		assert.Contains(t, out.String(), line+"\n")
+	}
+}
+
+func TestServeReady(t *testing.T) {
+	dbConn := testdb.Open(t)
+	handler := serveReady(dbConn)
+
+	w := httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	_, err := dbConn.Exec("UPDATE schema_version SET version = 0")
+	require.NoError(t, err)
+	w = httptest.NewRecorder()
+	handler(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), "schema version is 0")
+}
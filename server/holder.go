@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// accountHolderType is the type of holders that are bank accounts. Only
+// their balance is meaningful.
+const accountHolderType = "iban"
+
+// holderDetail is the data of the holderInfo.html template.
+type holderDetail struct {
+	Holder db.Holder
+	Parent *db.Holder
+	// Holders are the choices for the parent.
+	Holders []db.Holder
+	Tags    tagEditor
+	// Transactions are newest first.
+	Transactions []holderDetailTransaction
+	InCents      int
+	OutCents     int
+	// ShowBalance is set for account holders. The balance starts at zero
+	// with the oldest imported transaction.
+	ShowBalance bool
+	Error       string
+}
+
+type holderDetailTransaction struct {
+	db.HolderTransaction
+	BalanceInCents int
+}
+
+// newHolderDetail sums up the transactions of the holder, which must be
+// ordered newest first.
+func newHolderDetail(holder db.Holder, transactions []db.HolderTransaction) holderDetail {
+	detail := holderDetail{
+		Holder:       holder,
+		Transactions: make([]holderDetailTransaction, len(transactions)),
+		ShowBalance:  holder.Type == accountHolderType,
+	}
+	balance := 0
+	for i := len(transactions) - 1; i >= 0; i-- {
+		transaction := transactions[i]
+		balance += transaction.SignedAmountInCents
+		if transaction.SignedAmountInCents > 0 {
+			detail.InCents += transaction.SignedAmountInCents
+		} else {
+			detail.OutCents -= transaction.SignedAmountInCents
+		}
+		detail.Transactions[i] = holderDetailTransaction{
+			HolderTransaction: transaction,
+			BalanceInCents:    balance,
+		}
+	}
+	return detail
+}
+
+func holderRoutes(r chi.Router, dbConn *sqlx.DB) {
+	r.Get("/holder", func(w http.ResponseWriter, r *http.Request) {
+		holderID, err := strconv.Atoi(r.URL.Query().Get("id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse holder id: %s", err), http.StatusBadRequest)
+			return
+		}
+		detail, found, err := loadHolderDetail(r, dbConn, holderID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("load holder: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "holder not found", http.StatusNotFound)
+			return
+		}
+		tmpl, err := readTemplates()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+			return
+		}
+		err = tmpl.ExecuteTemplate(w, "holderInfo.html", detail)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+func loadHolderDetail(r *http.Request, dbConn *sqlx.DB, holderID int) (*holderDetail, bool, error) {
+	ctx := r.Context()
+	householdID := currentHousehold(ctx)
+	holder, found, err := db.GetHolder(ctx, dbConn, householdID, holderID)
+	if err != nil {
+		return nil, false, fmt.Errorf("get holder: %w", err)
+	}
+	if !found {
+		return nil, false, nil
+	}
+	transactions, err := db.GetHolderTransactions(ctx, dbConn, householdID, holderID, db.HolderTransactionFilter{})
+	if err != nil {
+		return nil, false, fmt.Errorf("get holder transactions: %w", err)
+	}
+	detail := newHolderDetail(*holder, transactions)
+	detail.Tags, err = loadTagEditor(ctx, dbConn, householdID, holderTags, holderID)
+	if err != nil {
+		return nil, false, err
+	}
+	detail.Holders, err = db.GetHolders(ctx, dbConn, householdID)
+	if err != nil {
+		return nil, false, fmt.Errorf("get holders: %w", err)
+	}
+	if holder.ParentHolderID != nil {
+		detail.Parent, _, err = db.GetHolder(ctx, dbConn, householdID, *holder.ParentHolderID)
+		if err != nil {
+			return nil, false, fmt.Errorf("get parent holder: %w", err)
+		}
+	}
+	return &detail, true, nil
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHolderDetail(t *testing.T) {
+	transaction := func(signedAmount int) db.HolderTransaction {
+		return db.HolderTransaction{SignedAmountInCents: signedAmount}
+	}
+	tests := []struct {
+		name         string
+		holderType   string
+		transactions []db.HolderTransaction
+		balances     []int
+		in           int
+		out          int
+		showBalance  bool
+	}{
+		{
+			name:        "no transactions",
+			holderType:  accountHolderType,
+			balances:    []int{},
+			showBalance: true,
+		},
+		{
+			name:       "newest first",
+			holderType: accountHolderType,
+			transactions: []db.HolderTransaction{
+				transaction(-2500),
+				transaction(10000),
+				transaction(-500),
+			},
+			balances:    []int{7000, 9500, -500},
+			in:          10000,
+			out:         3000,
+			showBalance: true,
+		},
+		{
+			name:       "counterparty",
+			holderType: "dkb/payee",
+			transactions: []db.HolderTransaction{
+				transaction(1999),
+			},
+			balances: []int{1999},
+			in:       1999,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			holder := db.Holder{}
+			holder.Type = tt.holderType
+			detail := newHolderDetail(holder, tt.transactions)
+
+			balances := make([]int, 0, len(detail.Transactions))
+			for _, transaction := range detail.Transactions {
+				balances = append(balances, transaction.BalanceInCents)
+			}
+			assert.Equal(t, tt.balances, balances)
+			assert.Equal(t, tt.in, detail.InCents)
+			assert.Equal(t, tt.out, detail.OutCents)
+			assert.Equal(t, tt.showBalance, detail.ShowBalance)
+		})
+	}
+}
@@ -0,0 +1,299 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/auth"
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// householdFixture is the data of one household and a member that can
+// access it through a session and a token.
+type householdFixture struct {
+	HouseholdID   int
+	SessionToken  string
+	CSRFToken     string
+	APIToken      string
+	Holder        *db.Holder
+	Other         *db.Holder
+	TransactionID int
+	Tag           *db.Tag
+}
+
+func newHouseholdFixture(t *testing.T, ctx context.Context, dbConn *sqlx.DB, name string) householdFixture {
+	t.Helper()
+	household, err := db.InsertHousehold(ctx, dbConn, name)
+	require.NoError(t, err)
+	user, err := db.InsertUser(ctx, dbConn, db.CreateUser{Name: name, PasswordHash: "unused"})
+	require.NoError(t, err)
+	require.NoError(t, db.AddHouseholdMember(ctx, dbConn, household.ID, user.ID))
+
+	fixture := householdFixture{
+		HouseholdID:  household.ID,
+		SessionToken: name + "-session",
+		CSRFToken:    name + "-csrf",
+		APIToken:     name + "-token",
+	}
+	err = db.InsertSession(ctx, dbConn, db.Session{
+		TokenHash:   auth.HashToken(fixture.SessionToken),
+		UserID:      user.ID,
+		HouseholdID: household.ID,
+		CSRFToken:   fixture.CSRFToken,
+		ExpiresAt:   time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	_, err = db.InsertAPIToken(ctx, dbConn, user.ID, household.ID, "test", auth.HashToken(fixture.APIToken))
+	require.NoError(t, err)
+
+	fixture.Holder, err = db.InsertHolder(ctx, dbConn, household.ID, db.CreateHolder{
+		// both households know the same account
+		HolderIdentifier: db.HolderIdentifier{Type: "iban", Identifier: "DE02120300000000202051"},
+		Name:             name + " account",
+	})
+	require.NoError(t, err)
+	fixture.Other, err = db.InsertHolder(ctx, dbConn, household.ID, db.CreateHolder{
+		HolderIdentifier: db.HolderIdentifier{Type: "name", Identifier: name + " shop"},
+		Name:             name + " shop",
+	})
+	require.NoError(t, err)
+	day := time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+	transaction, err := db.InsertTransaction(ctx, dbConn, household.ID, db.CreateTransaction{
+		BaseTransaction: db.BaseTransaction{
+			AmountInCents: 1234,
+			Timestamp:     day,
+			BookingDate:   day,
+			ValueDate:     day,
+			Data: types.NullJSONText{
+				JSONText: types.JSONText(`{"Purpose": "` + name + ` purpose"}`),
+				Valid:    true,
+			},
+		},
+		FromHolderID: fixture.Holder.ID,
+		ToHolderID:   fixture.Other.ID,
+	})
+	require.NoError(t, err)
+	fixture.TransactionID = transaction.ID
+	fixture.Tag, err = db.InsertTag(ctx, dbConn, household.ID, db.CreateTag{Name: "Groceries"})
+	require.NoError(t, err)
+	require.NoError(t, db.AttachHolderTag(ctx, dbConn, household.ID, fixture.Other.ID, fixture.Tag.ID))
+	return fixture
+}
+
+// apiRequest sends a request with the token of the fixture.
+func (f householdFixture) apiRequest(t *testing.T, handler http.Handler, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, apiPathPrefix+path, strings.NewReader(body))
+	r.Header.Set("Authorization", "Bearer "+f.APIToken)
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+// pageRequest sends an htmx request with the session of the fixture.
+func (f householdFixture) pageRequest(t *testing.T, handler http.Handler, method, path string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+	r.AddCookie(&http.Cookie{Name: sessionCookie, Value: f.SessionToken})
+	r.Header.Set(csrfHeader, f.CSRFToken)
+	r.Header.Set("HX-Request", "true")
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestHouseholdIsolation(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	own := newHouseholdFixture(t, ctx, dbConn, "alice")
+	foreign := newHouseholdFixture(t, ctx, dbConn, "bob")
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+
+	t.Run("api reads", func(t *testing.T) {
+		paths := []string{
+			fmt.Sprintf("/holders/%d", foreign.Holder.ID),
+			fmt.Sprintf("/transactions/%d", foreign.TransactionID),
+			fmt.Sprintf("/tags/%d", foreign.Tag.ID),
+		}
+		for _, path := range paths {
+			w := own.apiRequest(t, handler, http.MethodGet, path, "")
+			assert.Equal(t, http.StatusNotFound, w.Code, path)
+		}
+	})
+
+	t.Run("api lists", func(t *testing.T) {
+		lists := []struct {
+			path    string
+			want    int
+			foreign []int
+		}{
+			{path: "/holders", want: 2, foreign: []int{foreign.Holder.ID, foreign.Other.ID}},
+			{path: "/transactions", want: 1, foreign: []int{foreign.TransactionID}},
+			{path: "/tags", want: 1, foreign: []int{foreign.Tag.ID}},
+		}
+		for _, list := range lists {
+			w := own.apiRequest(t, handler, http.MethodGet, list.path, "")
+			require.Equal(t, http.StatusOK, w.Code, list.path)
+			var response struct {
+				Items []struct {
+					ID int `json:"id"`
+				} `json:"items"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Len(t, response.Items, list.want, list.path)
+			for _, item := range response.Items {
+				assert.NotContains(t, list.foreign, item.ID, list.path)
+			}
+		}
+	})
+
+	t.Run("api writes", func(t *testing.T) {
+		tests := []struct {
+			method string
+			path   string
+			body   string
+			status int
+		}{
+			{
+				method: http.MethodPatch,
+				path:   fmt.Sprintf("/holders/%d", foreign.Holder.ID),
+				body:   `{"name": "stolen"}`,
+				status: http.StatusNotFound,
+			},
+			{
+				method: http.MethodDelete,
+				path:   fmt.Sprintf("/transactions/%d", foreign.TransactionID),
+				status: http.StatusNotFound,
+			},
+			{
+				method: http.MethodDelete,
+				path:   fmt.Sprintf("/tags/%d", foreign.Tag.ID),
+				status: http.StatusNotFound,
+			},
+			{
+				method: http.MethodPut,
+				path:   fmt.Sprintf("/holders/%d/tags/%d", own.Holder.ID, foreign.Tag.ID),
+				status: http.StatusNotFound,
+			},
+			{
+				method: http.MethodPut,
+				path:   fmt.Sprintf("/transactions/%d/tags/%d", foreign.TransactionID, own.Tag.ID),
+				status: http.StatusNotFound,
+			},
+			{
+				method: http.MethodPatch,
+				path:   fmt.Sprintf("/holders/%d", own.Holder.ID),
+				body:   fmt.Sprintf(`{"parentHolderId": %d}`, foreign.Holder.ID),
+				status: http.StatusUnprocessableEntity,
+			},
+			{
+				method: http.MethodPost,
+				path:   "/tags",
+				body:   fmt.Sprintf(`{"name": "Food", "parentTagId": %d}`, foreign.Tag.ID),
+				status: http.StatusUnprocessableEntity,
+			},
+			{
+				method: http.MethodPost,
+				path:   "/transactions",
+				body: fmt.Sprintf(`{"amountInCents": 100, "timestamp": "2023-05-02T00:00:00Z",
+					"bookingDate": "2023-05-02", "valueDate": "2023-05-02",
+					"fromHolderId": %d, "toHolderId": %d}`, own.Holder.ID, foreign.Other.ID),
+				status: http.StatusUnprocessableEntity,
+			},
+		}
+		for _, tt := range tests {
+			w := own.apiRequest(t, handler, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.status, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+		}
+
+		// nothing of the other household changed
+		holder, found, err := db.GetHolder(ctx, dbConn, foreign.HouseholdID, foreign.Holder.ID)
+		require.NoError(t, err)
+		require.True(t, found)
+		assert.Equal(t, foreign.Holder.Name, holder.Name)
+		_, found, err = db.GetTransaction(ctx, dbConn, foreign.HouseholdID, foreign.TransactionID)
+		require.NoError(t, err)
+		assert.True(t, found)
+		tags, err := db.GetTransactionTags(ctx, dbConn, foreign.HouseholdID, foreign.TransactionID)
+		require.NoError(t, err)
+		assert.Empty(t, tags)
+	})
+
+	t.Run("htmx", func(t *testing.T) {
+		tests := []struct {
+			method string
+			path   string
+			form   url.Values
+		}{
+			{method: http.MethodGet, path: fmt.Sprintf("/htmx/holder?id=%d", foreign.Holder.ID)},
+			{method: http.MethodGet, path: fmt.Sprintf("/htmx/holder/%d/name", foreign.Holder.ID)},
+			{method: http.MethodPost, path: fmt.Sprintf("/htmx/holder/%d/favorite", foreign.Holder.ID)},
+			{
+				method: http.MethodPost,
+				path:   fmt.Sprintf("/htmx/holder/%d/name", foreign.Holder.ID),
+				form:   url.Values{"name": {"stolen"}},
+			},
+			{
+				method: http.MethodPost,
+				path:   fmt.Sprintf("/htmx/holder/%d/tags", own.Holder.ID),
+				form:   url.Values{"tag": {fmt.Sprint(foreign.Tag.ID)}},
+			},
+			{method: http.MethodGet, path: fmt.Sprintf("/htmx/transaction/%d/split", foreign.TransactionID)},
+			{method: http.MethodGet, path: "/htmx/transaction/999999/split"},
+			{method: http.MethodPost, path: "/htmx/transaction/999999/split"},
+			{method: http.MethodPost, path: "/household", form: url.Values{"household": {fmt.Sprint(foreign.HouseholdID)}}},
+		}
+		for _, tt := range tests {
+			w := own.pageRequest(t, handler, tt.method, tt.path, tt.form)
+			assert.Equal(t, http.StatusNotFound, w.Code, "%s %s: %s", tt.method, tt.path, w.Body.String())
+		}
+
+		pages := []string{
+			"/",
+			"/transactions",
+			"/htmx/transactions",
+			fmt.Sprintf("/htmx/holder?id=%d", own.Holder.ID),
+			fmt.Sprintf("/htmx/holder/%d/tags", own.Holder.ID),
+		}
+		for _, path := range pages {
+			w := own.pageRequest(t, handler, http.MethodGet, path, nil)
+			require.Equal(t, http.StatusOK, w.Code, path)
+			assert.NotContains(t, w.Body.String(), "bob", path)
+		}
+	})
+
+	t.Run("membership", func(t *testing.T) {
+		user, _, err := db.GetUserByName(ctx, dbConn, "bob")
+		require.NoError(t, err)
+		require.NoError(t, db.AddHouseholdMember(ctx, dbConn, own.HouseholdID, user.ID))
+
+		// a token only opens the household it was created for
+		w := foreign.apiRequest(t, handler, http.MethodGet, fmt.Sprintf("/holders/%d", own.Holder.ID), "")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+
+		w = foreign.pageRequest(t, handler, http.MethodPost, "/household",
+			url.Values{"household": {fmt.Sprint(own.HouseholdID)}})
+		assert.Equal(t, "/", w.Header().Get("HX-Redirect"))
+		w = foreign.pageRequest(t, handler, http.MethodGet, "/", nil)
+		assert.Contains(t, w.Body.String(), own.Holder.Name)
+
+		require.NoError(t, db.RemoveHouseholdMember(ctx, dbConn, foreign.HouseholdID, user.ID))
+		w = foreign.apiRequest(t, handler, http.MethodGet, "/holders", "")
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
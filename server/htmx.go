@@ -1,15 +1,74 @@
 package server
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload"
 	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
 )
 
-func htmxRouter() http.Handler {
+func htmxRouter(dbConn *sqlx.DB, loc *time.Location, uploads *upload.Service, metrics *serverMetrics) http.Handler {
 	r := chi.NewRouter()
-	r.Get("/holder", func(w http.ResponseWriter, r *http.Request) {
-
+	holderRoutes(r, dbConn)
+	editRoutes(r, dbConn)
+	uploadRoutes(r, dbConn, uploads, metrics)
+	transactionRoutes(r, dbConn, loc)
+	r.Get("/dashboard", serveDashboard(dbConn, loc, "dashboardCharts"))
+	r.Get("/holder/{id}/transactions", func(w http.ResponseWriter, r *http.Request) {
+		holderID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse holder id: %s", err), http.StatusBadRequest)
+			return
+		}
+		filter, err := parseHolderTransactionFilter(r, loc)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse filter: %s", err), http.StatusBadRequest)
+			return
+		}
+		tmpl, err := readTemplates()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+			return
+		}
+		transactions, err := db.GetHolderTransactions(r.Context(), dbConn, currentHousehold(r.Context()), holderID, filter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get holder transactions: %s", err), http.StatusInternalServerError)
+			return
+		}
+		err = tmpl.ExecuteTemplate(w, "holderTransactions.html", transactions)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+			return
+		}
 	})
+	splitRoutes(r, dbConn)
 	return r
 }
+
+// parseHolderTransactionFilter reads the optional query parameters from
+// (inclusive), to (exclusive) and direction. Dates are days in loc.
+func parseHolderTransactionFilter(r *http.Request, loc *time.Location) (db.HolderTransactionFilter, error) {
+	var filter db.HolderTransactionFilter
+	query := r.URL.Query()
+	if from := query.Get("from"); from != "" {
+		date, err := time.ParseInLocation(time.DateOnly, from, loc)
+		if err != nil {
+			return filter, fmt.Errorf("parse from: %w", err)
+		}
+		filter.From = &date
+	}
+	if to := query.Get("to"); to != "" {
+		date, err := time.ParseInLocation(time.DateOnly, to, loc)
+		if err != nil {
+			return filter, fmt.Errorf("parse to: %w", err)
+		}
+		filter.To = &date
+	}
+	filter.Direction = db.Direction(query.Get("direction"))
+	return filter, nil
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Opsi/sparschwein/util"
+)
+
+// ListenConfig configures how the server accepts connections.
+type ListenConfig struct {
+	// Address is the host and port the server listens on.
+	Address string
+	// TLSCertFile and TLSKeyFile make the server speak HTTPS. Both are empty
+	// for plain HTTP.
+	TLSCertFile string
+	TLSKeyFile  string
+	// ReadHeaderTimeout limits reading the headers of a request, so slow
+	// clients can't keep connections open before any handler runs.
+	ReadHeaderTimeout time.Duration
+	// ReadTimeout limits reading a whole request, including the body.
+	ReadTimeout time.Duration
+	// WriteTimeout limits writing the response.
+	WriteTimeout time.Duration
+	// IdleTimeout closes keep-alive connections without requests.
+	IdleTimeout time.Duration
+	// ShutdownTimeout is how long requests in flight may take to finish
+	// when the server is stopped.
+	ShutdownTimeout time.Duration
+	// TrustedProxies are the addresses of reverse proxies whose
+	// X-Forwarded-For and X-Forwarded-Proto headers are believed.
+	TrustedProxies PrefixList
+
+	// envErr is the error of an environment variable that couldn't be
+	// parsed. The server doesn't start with it.
+	envErr error
+}
+
+// AddListenFlags adds the listen flags and returns the configuration struct
+// to be filled with the values from the flags.
+func AddListenFlags() *ListenConfig {
+	config := &ListenConfig{}
+
+	flag.StringVar(
+		&config.Address,
+		"listen",
+		util.LookupStringEnv("LISTEN_ADDRESS", ":8080"),
+		"address the server listens on (default: :8080)")
+	flag.StringVar(
+		&config.TLSCertFile,
+		"tls-cert",
+		util.LookupStringEnv("TLS_CERT", ""),
+		"certificate file for HTTPS (default: plain HTTP)")
+	flag.StringVar(
+		&config.TLSKeyFile,
+		"tls-key",
+		util.LookupStringEnv("TLS_KEY", ""),
+		"key file for HTTPS (default: plain HTTP)")
+	flag.DurationVar(
+		&config.ReadHeaderTimeout,
+		"read-header-timeout",
+		util.LookupDurationEnv("READ_HEADER_TIMEOUT", 10*time.Second),
+		"maximum duration for reading the headers of a request (default: 10s)")
+	flag.DurationVar(
+		&config.ReadTimeout,
+		"read-timeout",
+		util.LookupDurationEnv("READ_TIMEOUT", 30*time.Second),
+		"maximum duration for reading a request (default: 30s)")
+	flag.DurationVar(
+		&config.WriteTimeout,
+		"write-timeout",
+		util.LookupDurationEnv("WRITE_TIMEOUT", time.Minute),
+		"maximum duration for writing a response (default: 1m)")
+	flag.DurationVar(
+		&config.IdleTimeout,
+		"idle-timeout",
+		util.LookupDurationEnv("IDLE_TIMEOUT", 2*time.Minute),
+		"how long idle keep-alive connections are kept open (default: 2m)")
+	flag.DurationVar(
+		&config.ShutdownTimeout,
+		"shutdown-timeout",
+		util.LookupDurationEnv("SHUTDOWN_TIMEOUT", 30*time.Second),
+		"how long requests may take to finish on shutdown (default: 30s)")
+	config.lookupTrustedProxiesEnv()
+	flag.Var(
+		&config.TrustedProxies,
+		"trusted-proxies",
+		"comma separated addresses or CIDR ranges of reverse proxies whose X-Forwarded headers are trusted (default: none)")
+
+	return config
+}
+
+// lookupTrustedProxiesEnv reads the default of the trusted proxies from the
+// environment. Unlike for other variables, an invalid value isn't ignored:
+// the server would distrust its proxy and log wrong client addresses.
+func (c *ListenConfig) lookupTrustedProxiesEnv() {
+	proxies, ok := os.LookupEnv("TRUSTED_PROXIES")
+	if !ok {
+		return
+	}
+	if err := c.TrustedProxies.Set(proxies); err != nil {
+		c.envErr = fmt.Errorf("parse TRUSTED_PROXIES: %w", err)
+	}
+}
+
+// validate checks the configuration before the server starts.
+func (c ListenConfig) validate() error {
+	if c.envErr != nil {
+		return c.envErr
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return errors.New("TLS needs both a certificate and a key file")
+	}
+	return nil
+}
+
+// PrefixList is a flag value of comma separated addresses and CIDR ranges.
+type PrefixList []netip.Prefix
+
+func (l *PrefixList) String() string {
+	if l == nil {
+		return ""
+	}
+	prefixes := make([]string, len(*l))
+	for i, prefix := range *l {
+		prefixes[i] = prefix.String()
+	}
+	return strings.Join(prefixes, ",")
+}
+
+func (l *PrefixList) Set(value string) error {
+	var prefixes PrefixList
+	for _, field := range strings.Split(value, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if strings.Contains(field, "/") {
+			prefix, err := netip.ParsePrefix(field)
+			if err != nil {
+				return err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(field)
+		if err != nil {
+			return err
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	*l = prefixes
+	return nil
+}
+
+func (l PrefixList) contains(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range l {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+type httpsContextKey struct{}
+
+// isHTTPS reports whether the browser sent the request over HTTPS, directly
+// or through a trusted proxy.
+func isHTTPS(r *http.Request) bool {
+	https, _ := r.Context().Value(httpsContextKey{}).(bool)
+	return r.TLS != nil || https
+}
+
+// trustProxies replaces the remote address of requests from trusted proxies
+// with the client they forwarded the request for and remembers whether the
+// client used HTTPS. Headers of everyone else are ignored.
+func trustProxies(proxies PrefixList) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, err := netip.ParseAddrPort(r.RemoteAddr)
+			if len(proxies) == 0 || err != nil || !proxies.contains(peer.Addr()) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if client, ok := forwardedClient(r.Header.Values("X-Forwarded-For"), proxies); ok {
+				r.RemoteAddr = netip.AddrPortFrom(client, 0).String()
+			}
+			if strings.EqualFold(r.Header.Get("X-Forwarded-Proto"), "https") {
+				r = r.WithContext(context.WithValue(r.Context(), httpsContextKey{}, true))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwardedClient returns the last address of the X-Forwarded-For headers
+// that isn't a trusted proxy. Everything before it could be made up by the
+// client.
+func forwardedClient(headers []string, proxies PrefixList) (netip.Addr, bool) {
+	var addrs []string
+	for _, header := range headers {
+		addrs = append(addrs, strings.Split(header, ",")...)
+	}
+	var client netip.Addr
+	for i := len(addrs) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(addrs[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !proxies.contains(client) {
+			break
+		}
+	}
+	return client, client.IsValid()
+}
+
+// serve handles the connections of the listener until the context is done.
+// Then it waits for the requests in flight before it returns.
+func serve(ctx context.Context, listener net.Listener, handler http.Handler, config ListenConfig) error {
+	if err := config.validate(); err != nil {
+		listener.Close()
+		return err
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: config.ReadHeaderTimeout,
+		ReadTimeout:       config.ReadTimeout,
+		WriteTimeout:      config.WriteTimeout,
+		IdleTimeout:       config.IdleTimeout,
+	}
+	served := make(chan error, 1)
+	go func() {
+		if config.TLSCertFile != "" {
+			served <- server.ServeTLS(listener, config.TLSCertFile, config.TLSKeyFile)
+		} else {
+			served <- server.Serve(listener)
+		}
+	}()
+	slog.Info("serving",
+		slog.String("address", listener.Addr().String()),
+		slog.Bool("tls", config.TLSCertFile != ""))
+
+	select {
+	case err := <-served:
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+	slog.Info("shutting down, waiting for requests in flight")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), config.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("shutdown: %w", err)
+	}
+	return nil
+}
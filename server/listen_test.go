@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrefixList(t *testing.T) {
+	var proxies PrefixList
+	require.NoError(t, proxies.Set("10.0.0.0/8, 192.168.1.2,::1"))
+	assert.Equal(t, "10.0.0.0/8,192.168.1.2/32,::1/128", proxies.String())
+	assert.Error(t, proxies.Set("10.0.0.0/33"))
+	assert.Error(t, proxies.Set("proxy"))
+}
+
+func TestTrustProxies(t *testing.T) {
+	var proxies PrefixList
+	require.NoError(t, proxies.Set("10.0.0.0/8"))
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		proto      string
+		wantAddr   string
+		wantHTTPS  bool
+	}{
+		{
+			name:       "untrusted peer",
+			remoteAddr: "203.0.113.7:4711",
+			forwarded:  []string{"198.51.100.1"},
+			proto:      "https",
+			wantAddr:   "203.0.113.7:4711",
+		},
+		{
+			name:       "trusted proxy",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"198.51.100.1"},
+			proto:      "https",
+			wantAddr:   "198.51.100.1:0",
+			wantHTTPS:  true,
+		},
+		{
+			name:       "spoofed addresses before the client",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"192.0.2.66, 198.51.100.1", "10.0.0.3"},
+			proto:      "http",
+			wantAddr:   "198.51.100.1:0",
+		},
+		{
+			name:       "without header",
+			remoteAddr: "10.0.0.2:4711",
+			wantAddr:   "10.0.0.2:4711",
+		},
+		{
+			name:       "invalid header",
+			remoteAddr: "10.0.0.2:4711",
+			forwarded:  []string{"unknown"},
+			wantAddr:   "10.0.0.2:4711",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotAddr string
+			var gotHTTPS bool
+			handler := trustProxies(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotAddr, gotHTTPS = r.RemoteAddr, isHTTPS(r)
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, forwarded := range tt.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if tt.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", tt.proto)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+			assert.Equal(t, tt.wantAddr, gotAddr)
+			assert.Equal(t, tt.wantHTTPS, gotHTTPS)
+		})
+	}
+}
+
+func TestServeDrainsRequests(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	started, finish := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+		io.WriteString(w, "done")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- serve(ctx, listener, handler, ListenConfig{ShutdownTimeout: 5 * time.Second})
+	}()
+
+	responses := make(chan string, 1)
+	go func() {
+		response, err := http.Get("http://" + listener.Addr().String())
+		if err != nil {
+			responses <- err.Error()
+			return
+		}
+		defer response.Body.Close()
+		body, _ := io.ReadAll(response.Body)
+		responses <- string(body)
+	}()
+	<-started
+	cancel()
+
+	select {
+	case err := <-served:
+		t.Fatalf("serve returned before the request finished: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(finish)
+	assert.Equal(t, "done", <-responses)
+	assert.NoError(t, <-served)
+}
+
+func TestServeNeedsCertificateAndKey(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	err = serve(context.Background(), listener, http.NotFoundHandler(), ListenConfig{TLSCertFile: "cert.pem"})
+	assert.ErrorContains(t, err, "certificate and a key")
+}
+
+func TestTrustedProxiesEnv(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "10.0.0.1, 192.168.0.0/16", want: "10.0.0.1/32,192.168.0.0/16"},
+		{value: "", want: ""},
+		{value: "10.0.0.1,proxy.local", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			t.Setenv("TRUSTED_PROXIES", tt.value)
+			var config ListenConfig
+			config.lookupTrustedProxiesEnv()
+			if tt.wantErr {
+				assert.ErrorContains(t, config.validate(), "TRUSTED_PROXIES")
+				listener, err := net.Listen("tcp", "127.0.0.1:0")
+				require.NoError(t, err)
+				assert.Error(t, serve(context.Background(), listener, http.NotFoundHandler(), config))
+				return
+			}
+			assert.NoError(t, config.validate())
+			assert.Equal(t, tt.want, config.TrustedProxies.String())
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Opsi/sparschwein/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLogRequests(t *testing.T) {
+	var logs bytes.Buffer
+	defaultLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(defaultLogger) })
+
+	handler := logRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		util.Logger(r.Context()).Info("handling")
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		name    string
+		header  string
+		keepsID bool
+	}{
+		{name: "new id", keepsID: false},
+		{name: "id of proxy", header: "proxy-1234.5", keepsID: true},
+		{name: "invalid id", header: "id with spaces", keepsID: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs.Reset()
+			r := httptest.NewRequest(http.MethodGet, "/transactions", nil)
+			if tt.header != "" {
+				r.Header.Set(requestIDHeader, tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+
+			requestID := w.Header().Get(requestIDHeader)
+			require.NotEmpty(t, requestID)
+			if tt.keepsID {
+				assert.Equal(t, tt.header, requestID)
+			} else {
+				assert.NotEqual(t, tt.header, requestID)
+			}
+
+			decoder := json.NewDecoder(&logs)
+			var handling, request map[string]any
+			require.NoError(t, decoder.Decode(&handling))
+			require.NoError(t, decoder.Decode(&request))
+			assert.Equal(t, "handling", handling["msg"])
+			assert.Equal(t, requestID, handling["requestID"])
+			assert.Equal(t, "request", request["msg"])
+			assert.Equal(t, requestID, request["requestID"])
+			assert.Equal(t, "/transactions", request["path"])
+			assert.Equal(t, float64(http.StatusTeapot), request["status"])
+		})
+	}
+}
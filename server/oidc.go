@@ -0,0 +1,189 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Opsi/sparschwein/auth"
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// oidcCookie keeps the state, nonce and PKCE verifier of a login while
+	// the browser is at the issuer.
+	oidcCookie      = "sparschwein_oidc"
+	oidcCookiePath  = "/login/oidc"
+	oidcLoginExpiry = 10 * time.Minute
+)
+
+// errOIDCNameTaken is returned when a new subject of the issuer has the name
+// of an existing user. Existing users are only linked with cmd/users
+// link-oidc, or anyone choosing the name at the issuer would take them over.
+var errOIDCNameTaken = errors.New("name is taken by another user")
+
+// pendingOIDCLogin is the content of the oidcCookie.
+type pendingOIDCLogin struct {
+	auth.OIDCLogin
+	Next string
+}
+
+// startOIDCLogin sends the browser to the issuer.
+func (a *authenticator) startOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	login, err := auth.NewOIDCLogin()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("new login: %s", err), http.StatusInternalServerError)
+		return
+	}
+	value, err := json.Marshal(pendingOIDCLogin{
+		OIDCLogin: login,
+		Next:      safeRedirect(r.URL.Query().Get("next")),
+	})
+	if err != nil {
+		http.Error(w, fmt.Sprintf("marshal login: %s", err), http.StatusInternalServerError)
+		return
+	}
+	// the issuer redirects back with a top-level navigation, which Lax
+	// cookies survive
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcCookie,
+		Value:    base64.RawURLEncoding.EncodeToString(value),
+		Path:     oidcCookiePath,
+		MaxAge:   int(oidcLoginExpiry.Seconds()),
+		HttpOnly: true,
+		Secure:   isHTTPS(r),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, a.oidc.AuthCodeURL(login), http.StatusFound)
+}
+
+// oidcCallback finishes the login when the issuer sends the browser back.
+func (a *authenticator) oidcCallback(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	pending, ok := readOIDCCookie(r)
+	http.SetCookie(w, &http.Cookie{
+		Name:   oidcCookie,
+		Path:   oidcCookiePath,
+		MaxAge: -1,
+	})
+	if !ok || !equalTokens(query.Get("state"), pending.State) {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+	failed := loginPage{
+		Next:  pending.Next,
+		Error: fmt.Sprintf("The login with %s failed.", a.oidc.DisplayName()),
+	}
+	if issuerError := query.Get("error"); issuerError != "" {
+		util.Logger(ctx).Info("issuer rejected login",
+			slog.String("error", issuerError),
+			slog.String("description", query.Get("error_description")))
+		a.renderLogin(w, r, http.StatusUnauthorized, failed)
+		return
+	}
+
+	identity, err := a.oidc.Exchange(ctx, pending.OIDCLogin, query.Get("code"))
+	if err != nil {
+		util.Logger(ctx).Info("failed oidc login", slog.String("error", err.Error()))
+		a.renderLogin(w, r, http.StatusUnauthorized, failed)
+		return
+	}
+	user, err := a.oidcUser(ctx, identity)
+	if errors.Is(err, errOIDCNameTaken) {
+		util.Logger(ctx).Info("oidc login with taken name",
+			slog.String("subject", identity.Subject),
+			slog.String("name", identity.Username))
+		failed.Error = fmt.Sprintf("The name %q is already taken by another user.", identity.Username)
+		a.renderLogin(w, r, http.StatusForbidden, failed)
+		return
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("oidc user: %s", err), http.StatusInternalServerError)
+		return
+	}
+	a.finishLogin(w, r, user, pending.Next)
+}
+
+func readOIDCCookie(r *http.Request) (pendingOIDCLogin, bool) {
+	var pending pendingOIDCLogin
+	cookie, err := r.Cookie(oidcCookie)
+	if err != nil {
+		return pending, false
+	}
+	value, err := base64.RawURLEncoding.DecodeString(cookie.Value)
+	if err != nil {
+		return pending, false
+	}
+	if err := json.Unmarshal(value, &pending); err != nil {
+		return pending, false
+	}
+	pending.Next = safeRedirect(pending.Next)
+	return pending, true
+}
+
+// oidcUser returns the user of the identity. Unknown subjects become new
+// users without a password. If the issuer sent groups, they decide the
+// households of the user.
+func (a *authenticator) oidcUser(ctx context.Context, identity *auth.OIDCIdentity) (*db.User, error) {
+	tx, err := a.dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	user, err := linkOIDCUser(ctx, tx, identity)
+	if err != nil {
+		return nil, err
+	}
+	if identity.HasGroups {
+		households, err := db.GetHouseholdsByName(ctx, tx, identity.Households)
+		if err != nil {
+			return nil, err
+		}
+		householdIDs := make([]int, 0, len(households))
+		for _, household := range households {
+			householdIDs = append(householdIDs, household.ID)
+		}
+		if err := db.SetUserHouseholds(ctx, tx, user.ID, householdIDs); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit transaction: %w", err)
+	}
+	return user, nil
+}
+
+func linkOIDCUser(ctx context.Context, tx *sqlx.Tx, identity *auth.OIDCIdentity) (*db.User, error) {
+	user, found, err := db.GetUserByOIDCSubject(ctx, tx, identity.Subject)
+	if err != nil || found {
+		return user, err
+	}
+	name := identity.Username
+	if name == "" {
+		name = identity.Subject
+	}
+	if _, found, err := db.GetUserByName(ctx, tx, name); err != nil {
+		return nil, err
+	} else if found {
+		return nil, errOIDCNameTaken
+	}
+	user, err = db.InsertUser(ctx, tx, db.CreateUser{Name: name})
+	if err != nil {
+		return nil, err
+	}
+	if err := db.SetUserOIDCSubject(ctx, tx, user.ID, identity.Subject); err != nil {
+		return nil, err
+	}
+	user.OIDCSubject = &identity.Subject
+	util.Logger(ctx).Info("created oidc user", slog.Int("userID", user.ID), slog.String("name", user.Name))
+	return user, nil
+}
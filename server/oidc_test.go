@@ -0,0 +1,247 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/auth"
+	"github.com/Opsi/sparschwein/auth/oidctest"
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCallbackURL = "http://sparschwein.test/login/oidc/callback"
+
+func newTestOIDC(t *testing.T) (*auth.OIDCProvider, *oidctest.Issuer) {
+	t.Helper()
+	issuer, err := oidctest.NewIssuer("sparschwein")
+	require.NoError(t, err)
+	t.Cleanup(issuer.Close)
+	provider, err := auth.NewOIDCProvider(context.Background(), auth.OIDCConfig{
+		Issuer:        issuer.URL(),
+		ClientID:      "sparschwein",
+		RedirectURL:   testCallbackURL,
+		Scopes:        "openid groups",
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		GroupPrefix:   "sparschwein:",
+		DisplayName:   "Authelia",
+	})
+	require.NoError(t, err)
+	return provider, issuer
+}
+
+// oidcBrowser follows the login through the server and the issuer like a
+// browser would.
+type oidcBrowser struct {
+	t       *testing.T
+	handler http.Handler
+	cookie  *http.Cookie
+}
+
+// start opens /login/oidc and returns the page of the issuer.
+func (b *oidcBrowser) start(next string) *url.URL {
+	b.t.Helper()
+	w := httptest.NewRecorder()
+	b.handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login/oidc?next="+url.QueryEscape(next), nil))
+	require.Equal(b.t, http.StatusFound, w.Code)
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcCookie {
+			b.cookie = cookie
+		}
+	}
+	require.NotNil(b.t, b.cookie)
+	location, err := url.Parse(w.Header().Get("Location"))
+	require.NoError(b.t, err)
+	return location
+}
+
+// authorize lets the issuer log the user in and returns the callback.
+func (b *oidcBrowser) authorize(issuerURL *url.URL) *url.URL {
+	b.t.Helper()
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	response, err := client.Get(issuerURL.String())
+	require.NoError(b.t, err)
+	defer response.Body.Close()
+	require.Equal(b.t, http.StatusFound, response.StatusCode)
+	callback, err := url.Parse(response.Header.Get("Location"))
+	require.NoError(b.t, err)
+	return callback
+}
+
+func (b *oidcBrowser) callback(query url.Values) *httptest.ResponseRecorder {
+	b.t.Helper()
+	r := httptest.NewRequest(http.MethodGet, "/login/oidc/callback?"+query.Encode(), nil)
+	if b.cookie != nil {
+		r.AddCookie(b.cookie)
+	}
+	w := httptest.NewRecorder()
+	b.handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestOIDCLoginRedirect(t *testing.T) {
+	provider, issuer := newTestOIDC(t)
+	r := chi.NewRouter()
+	authRoutes(r, &authenticator{oidc: provider})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login?next=/transactions", nil))
+	assert.Contains(t, w.Body.String(), `href="/login/oidc?next=%2ftransactions"`)
+	assert.Contains(t, w.Body.String(), "Log in with Authelia")
+
+	browser := &oidcBrowser{t: t, handler: r}
+	location := browser.start("/transactions")
+	assert.Equal(t, issuer.URL()+"/authorize", location.Scheme+"://"+location.Host+location.Path)
+	query := location.Query()
+	assert.Equal(t, "sparschwein", query.Get("client_id"))
+	assert.Equal(t, testCallbackURL, query.Get("redirect_uri"))
+	assert.Equal(t, "S256", query.Get("code_challenge_method"))
+	assert.NotEmpty(t, query.Get("code_challenge"))
+	assert.NotEmpty(t, query.Get("nonce"))
+	assert.NotEmpty(t, query.Get("state"))
+	assert.True(t, browser.cookie.HttpOnly)
+	assert.Equal(t, http.SameSiteLaxMode, browser.cookie.SameSite)
+
+	pending, ok := readOIDCCookie(func() *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.AddCookie(browser.cookie)
+		return r
+	}())
+	require.True(t, ok)
+	assert.Equal(t, "/transactions", pending.Next)
+	assert.Equal(t, query.Get("state"), pending.State)
+}
+
+func TestOIDCCallbackErrors(t *testing.T) {
+	provider, _ := newTestOIDC(t)
+	r := chi.NewRouter()
+	authRoutes(r, &authenticator{oidc: provider})
+
+	t.Run("without cookie", func(t *testing.T) {
+		browser := &oidcBrowser{t: t, handler: r}
+		w := browser.callback(url.Values{"code": {"code"}, "state": {"state"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("wrong state", func(t *testing.T) {
+		browser := &oidcBrowser{t: t, handler: r}
+		browser.start("/")
+		w := browser.callback(url.Values{"code": {"code"}, "state": {"other"}})
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("rejected by issuer", func(t *testing.T) {
+		browser := &oidcBrowser{t: t, handler: r}
+		state := browser.start("/").Query().Get("state")
+		w := browser.callback(url.Values{"error": {"access_denied"}, "state": {state}})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Contains(t, w.Body.String(), "The login with Authelia failed.")
+	})
+
+	t.Run("unknown code", func(t *testing.T) {
+		browser := &oidcBrowser{t: t, handler: r}
+		state := browser.start("/").Query().Get("state")
+		w := browser.callback(url.Values{"code": {"forged"}, "state": {state}})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestOIDCLoginMapsUsersAndHouseholds(t *testing.T) {
+	dbConn := testdb.Open(t)
+	provider, issuer := newTestOIDC(t)
+	ctx := context.Background()
+	handler := newRouter(dbConn, Config{
+		Location: time.UTC,
+		Uploads:  &upload.Service{Location: time.UTC},
+		OIDC:     provider,
+	})
+
+	family, err := db.InsertHousehold(ctx, dbConn, "Family")
+	require.NoError(t, err)
+	flatShare, err := db.InsertHousehold(ctx, dbConn, "Flat Share")
+	require.NoError(t, err)
+
+	login := func(claims map[string]any) *httptest.ResponseRecorder {
+		issuer.SetClaims(claims)
+		browser := &oidcBrowser{t: t, handler: handler}
+		callback := browser.authorize(browser.start("/transactions"))
+		return browser.callback(callback.Query())
+	}
+	householdIDs := func(name string) []int {
+		user, found, err := db.GetUserByName(ctx, dbConn, name)
+		require.NoError(t, err)
+		require.True(t, found)
+		households, err := db.GetUserHouseholds(ctx, dbConn, user.ID)
+		require.NoError(t, err)
+		var ids []int
+		for _, household := range households {
+			ids = append(ids, household.ID)
+		}
+		return ids
+	}
+
+	// new users are created with the households of their groups
+	w := login(map[string]any{
+		"sub":                "alice-subject",
+		"preferred_username": "alice",
+		"groups":             []string{"sparschwein:Family", "sparschwein:Unknown", "admins"},
+	})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	assert.Equal(t, "/transactions", w.Header().Get("Location"))
+	assert.Equal(t, []int{family.ID}, householdIDs("alice"))
+
+	// the subject identifies the user, even if the name changed
+	w = login(map[string]any{
+		"sub":                "alice-subject",
+		"preferred_username": "alice.smith",
+		"groups":             []string{"sparschwein:Family", "sparschwein:Flat Share"},
+	})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	assert.Equal(t, []int{family.ID, flatShare.ID}, householdIDs("alice"))
+
+	// without a groups claim the memberships are kept
+	w = login(map[string]any{"sub": "alice-subject"})
+	require.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+	assert.Equal(t, []int{family.ID, flatShare.ID}, householdIDs("alice"))
+
+	// another subject can't take over a linked user
+	w = login(map[string]any{"sub": "mallory", "preferred_username": "alice"})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// nor a password user that was never linked
+	carol, err := db.InsertUser(ctx, dbConn, db.CreateUser{Name: "carol", PasswordHash: "unused"})
+	require.NoError(t, err)
+	require.NoError(t, db.AddHouseholdMember(ctx, dbConn, family.ID, carol.ID))
+	w = login(map[string]any{
+		"sub":                "mallory",
+		"preferred_username": "carol",
+		"groups":             []string{"sparschwein:Flat Share"},
+	})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	carol, found, err := db.GetUserByName(ctx, dbConn, "carol")
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Nil(t, carol.OIDCSubject)
+	assert.Equal(t, []int{family.ID}, householdIDs("carol"))
+
+	// until an admin links them
+	require.NoError(t, db.SetUserOIDCSubject(ctx, dbConn, carol.ID, "carol-subject"))
+	w = login(map[string]any{"sub": "carol-subject", "preferred_username": "carol"})
+	assert.Equal(t, http.StatusSeeOther, w.Code, w.Body.String())
+
+	// users without a household can't log in
+	w = login(map[string]any{"sub": "bob-subject", "preferred_username": "bob", "groups": []string{}})
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), "isn&#39;t a member of any household")
+}
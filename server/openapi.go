@@ -0,0 +1,17 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// openAPISpec describes the routes of apiRouter. It's maintained by hand;
+// TestOpenAPIMatchesRoutes fails if both drift apart.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+func serveOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
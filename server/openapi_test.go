@@ -0,0 +1,90 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type openAPIDocument struct {
+	Servers []struct {
+		URL string `json:"url"`
+	} `json:"servers"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	var doc openAPIDocument
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+	require.Len(t, doc.Servers, 1)
+	assert.Equal(t, apiPathPrefix, doc.Servers[0].URL)
+
+	var specRoutes []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			if method == "parameters" {
+				continue
+			}
+			specRoutes = append(specRoutes, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	router, ok := apiRouter(nil, time.UTC).(chi.Routes)
+	require.True(t, ok)
+	var routes []string
+	err := chi.Walk(router, func(method string, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+route)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, routes, specRoutes)
+}
+
+func TestOpenAPIReferences(t *testing.T) {
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal(openAPISpec, &doc))
+
+	var check func(node any)
+	check = func(node any) {
+		switch node := node.(type) {
+		case map[string]any:
+			for key, value := range node {
+				if ref, ok := value.(string); key == "$ref" && ok {
+					assert.True(t, resolves(doc, ref), "unresolved reference %s", ref)
+					continue
+				}
+				check(value)
+			}
+		case []any:
+			for _, value := range node {
+				check(value)
+			}
+		}
+	}
+	check(doc)
+}
+
+// resolves reports whether the local JSON pointer ref exists in doc.
+func resolves(doc map[string]any, ref string) bool {
+	if !strings.HasPrefix(ref, "#/") {
+		return false
+	}
+	var node any = doc
+	for _, part := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := node.(map[string]any)
+		if !ok {
+			return false
+		}
+		if node, ok = object[part]; !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -2,56 +2,144 @@ package server
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"html/template"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"github.com/Opsi/sparschwein/auth"
 	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/Opsi/sparschwein/util"
 	"github.com/go-chi/chi/v5"
-	"github.com/go-chi/chi/v5/middleware"
 	"github.com/jmoiron/sqlx"
+	"github.com/jmoiron/sqlx/types"
 )
 
-func ListenAndServe(dbConn *sqlx.DB) error {
-	r := chi.NewRouter()
-	r.Use(middleware.Logger)
+// Config configures the web interface.
+type Config struct {
+	// Location is the time zone dates are shown and entered in.
+	Location *time.Location
+	// Uploads imports the exports uploaded through the interface.
+	Uploads *upload.Service
+	// OIDC lets users log in at an issuer. It's nil if only passwords are
+	// allowed.
+	OIDC *auth.OIDCProvider
+	// Listen configures the address, TLS and timeouts of the server.
+	Listen ListenConfig
+	// Dev reads the templates and static files from the server directory on
+	// every request instead of using the embedded ones. The server has to be
+	// started from the root of the repository then.
+	Dev bool
+}
 
-	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		tmpl, err := readTemplates()
-		if err != nil {
-			http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
-			return
-		}
-		holders, err := db.GetHolders(r.Context(), dbConn)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("get holders: %s", err), http.StatusInternalServerError)
-			return
-		}
-		err = tmpl.ExecuteTemplate(w, "index.html", holders)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
-			return
-		}
-	})
+// ListenAndServe serves the web interface until the context is done.
+func ListenAndServe(ctx context.Context, dbConn *sqlx.DB, config Config) error {
+	if config.Dev {
+		useDevAssets()
+	} else if _, err := embeddedTemplates(); err != nil {
+		return err
+	}
+	if err := checkVendoredAssets(); err != nil {
+		return err
+	}
+	if err := config.Listen.validate(); err != nil {
+		return err
+	}
+	listener, err := net.Listen("tcp", config.Listen.Address)
+	if err != nil {
+		return fmt.Errorf("listen: %w", err)
+	}
+	return serve(ctx, listener, newRouter(dbConn, config), config.Listen)
+}
+
+// csp only allows the resources of the server itself. The pages don't use
+// inline scripts or styles and htmx is configured not to need them.
+const csp = "default-src 'self'; img-src 'self' data:; object-src 'none'; " +
+	"base-uri 'self'; form-action 'self'; frame-ancestors 'none'"
 
-	// serve static files
-	filesDir := http.Dir("server/static")
-	r.Get("/static/*", func(w http.ResponseWriter, r *http.Request) {
-		rctx := chi.RouteContext(r.Context())
-		pathPrefix := "/static/"
-		fs := http.StripPrefix(pathPrefix, http.FileServer(filesDir))
-		fs.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)))
+func contentSecurityPolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", csp)
+		next.ServeHTTP(w, r)
 	})
+}
+
+// newRouter serves the login and static files to everyone, the pages to
+// users with a session and the JSON API to users with a token.
+func newRouter(dbConn *sqlx.DB, config Config) http.Handler {
+	loc, uploads := config.Location, config.Uploads
+	metrics := newServerMetrics(dbConn)
+	r := chi.NewRouter()
+	r.Use(metrics.instrument)
+	r.Use(trustProxies(config.Listen.TrustedProxies))
+	r.Use(logRequests)
+	r.Use(contentSecurityPolicy)
+	authenticator := &authenticator{dbConn: dbConn, oidc: config.OIDC}
+
+	r.Get("/healthz", serveHealth)
+	r.Get("/readyz", serveReady(dbConn))
+	r.Method(http.MethodGet, "/metrics", metrics.registry)
+	r.Get("/static/*", serveStatic)
+	authRoutes(r, authenticator)
+	r.Get("/api/openapi.json", serveOpenAPISpec)
+	r.With(authenticator.requireToken).Mount(apiPathPrefix, apiRouter(dbConn, loc))
 
-	r.Mount("/htmx", htmxRouter())
+	r.Group(func(r chi.Router) {
+		r.Use(authenticator.requireSession)
+		r.Post("/logout", authenticator.logout)
+		r.Get("/household", authenticator.serveHouseholdMenu)
+		r.Post("/household", authenticator.switchHousehold)
 
-	return http.ListenAndServe(":8080", r)
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			tmpl, err := readTemplates()
+			if err != nil {
+				http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+				return
+			}
+			holders, err := db.GetHolders(r.Context(), dbConn, currentHousehold(r.Context()))
+			if err != nil {
+				http.Error(w, fmt.Sprintf("get holders: %s", err), http.StatusInternalServerError)
+				return
+			}
+			err = tmpl.ExecuteTemplate(w, "index.html", holders)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+				return
+			}
+		})
+
+		r.Get("/dashboard", serveDashboard(dbConn, loc, "dashboard.html"))
+		r.Get("/transactions", serveTransactionsPage(dbConn))
+		r.Get("/upload", serveUploadPage(dbConn, uploads))
+
+		r.Mount("/htmx", htmxRouter(dbConn, loc, uploads, metrics))
+	})
+	return r
 }
 
-func readTemplates() (*template.Template, error) {
-	tmpl, err := template.ParseGlob("server/templates/*.html")
-	if err != nil {
-		return nil, fmt.Errorf("parse templates: %w", err)
+var templateFuncs = template.FuncMap{
+	"cents":   util.FormatCents,
+	"purpose": purpose,
+	"static":  staticURL,
+}
+
+// purpose returns the purpose the bank stored in the data of a transaction.
+func purpose(data types.NullJSONText) string {
+	if !data.Valid {
+		return ""
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data.JSONText, &fields); err != nil {
+		return ""
+	}
+	for key, value := range fields {
+		if text, ok := value.(string); ok && strings.EqualFold(key, "purpose") {
+			return text
+		}
 	}
-	return tmpl, nil
+	return ""
 }
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPurpose(t *testing.T) {
+	tests := []struct {
+		name string
+		data types.NullJSONText
+		want string
+	}{
+		{
+			name: "null",
+			data: types.NullJSONText{},
+			want: "",
+		},
+		{
+			name: "dkb row",
+			data: types.NullJSONText{JSONText: types.JSONText(`{"Purpose": "Miete Mai", "Payee": "Vermieter"}`), Valid: true},
+			want: "Miete Mai",
+		},
+		{
+			name: "lower case",
+			data: types.NullJSONText{JSONText: types.JSONText(`{"purpose": "Miete Mai"}`), Valid: true},
+			want: "Miete Mai",
+		},
+		{
+			name: "no purpose",
+			data: types.NullJSONText{JSONText: types.JSONText(`{"Payee": "Vermieter"}`), Valid: true},
+			want: "",
+		},
+		{
+			name: "not an object",
+			data: types.NullJSONText{JSONText: types.JSONText(`[1, 2]`), Valid: true},
+			want: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, purpose(tt.data))
+		})
+	}
+}
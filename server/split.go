@@ -0,0 +1,227 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// splitForm is the data of the splitForm.html template.
+type splitForm struct {
+	Transaction db.Transaction
+	Parts       []splitFormPart
+	Tags        []db.Tag
+	Error       string
+	Saved       bool
+}
+
+// splitFormPart is a row of the split form. Key connects the fields of the
+// row, because rows can be added in the browser.
+type splitFormPart struct {
+	Key    string
+	Amount string
+	Note   string
+	TagIDs map[int]bool
+	Tags   []db.Tag
+}
+
+func splitRoutes(r chi.Router, dbConn *sqlx.DB) {
+	r.Get("/transaction/{id}/split", func(w http.ResponseWriter, r *http.Request) {
+		transactionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse transaction id: %s", err), http.StatusBadRequest)
+			return
+		}
+		form, err := loadSplitForm(r, dbConn, transactionID)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "transaction not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("load split form: %s", err), http.StatusInternalServerError)
+			return
+		}
+		renderSplitForm(w, form)
+	})
+
+	r.Get("/transaction/{id}/split/row", func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := readTemplates()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+			return
+		}
+		tags, err := db.GetTags(r.Context(), dbConn, currentHousehold(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get tags: %s", err), http.StatusInternalServerError)
+			return
+		}
+		part := splitFormPart{
+			Key:  strconv.FormatInt(time.Now().UnixNano(), 36),
+			Tags: tags,
+		}
+		err = tmpl.ExecuteTemplate(w, "splitRow", part)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+			return
+		}
+	})
+
+	r.Post("/transaction/{id}/split", func(w http.ResponseWriter, r *http.Request) {
+		transactionID, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parse transaction id: %s", err), http.StatusBadRequest)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, fmt.Sprintf("parse form: %s", err), http.StatusBadRequest)
+			return
+		}
+
+		splitErr := saveSplit(r, dbConn, transactionID)
+		form, err := loadSplitForm(r, dbConn, transactionID)
+		if errors.Is(err, db.ErrNotFound) {
+			http.Error(w, "transaction not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, fmt.Sprintf("load split form: %s", err), http.StatusInternalServerError)
+			return
+		}
+		if splitErr != nil {
+			// show the entered values again, so they can be corrected
+			form.Parts = submittedSplitParts(r, form.Tags)
+			form.Error = splitErr.Error()
+		} else {
+			form.Saved = true
+		}
+		renderSplitForm(w, form)
+	})
+}
+
+func loadSplitForm(r *http.Request, dbConn *sqlx.DB, transactionID int) (*splitForm, error) {
+	ctx := r.Context()
+	householdID := currentHousehold(ctx)
+	transaction, ok, err := db.GetTransaction(ctx, dbConn, householdID, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction: %w", err)
+	}
+	if !ok {
+		return nil, db.ErrNotFound
+	}
+	tags, err := db.GetTags(ctx, dbConn, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("get tags: %w", err)
+	}
+	splits, err := db.GetTransactionSplits(ctx, dbConn, householdID, transactionID)
+	if err != nil {
+		return nil, fmt.Errorf("get transaction splits: %w", err)
+	}
+
+	form := &splitForm{
+		Transaction: *transaction,
+		Tags:        tags,
+	}
+	for _, split := range splits {
+		splitTags, err := db.GetTransactionTags(ctx, dbConn, householdID, split.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get transaction tags: %w", err)
+		}
+		part := splitFormPart{
+			Key:    strconv.Itoa(split.ID),
+			Amount: util.FormatCents(split.AmountInCents),
+			Note:   split.Note,
+			TagIDs: make(map[int]bool),
+			Tags:   tags,
+		}
+		for _, tag := range splitTags {
+			part.TagIDs[tag.ID] = true
+		}
+		form.Parts = append(form.Parts, part)
+	}
+	// a new split starts with two empty parts
+	for i := len(form.Parts); i < 2; i++ {
+		form.Parts = append(form.Parts, splitFormPart{
+			Key:  fmt.Sprintf("new%d", i),
+			Tags: tags,
+		})
+	}
+	return form, nil
+}
+
+// submittedSplitParts reads the rows of the submitted form. Rows without an
+// amount and note are ignored.
+func submittedSplitParts(r *http.Request, tags []db.Tag) []splitFormPart {
+	var parts []splitFormPart
+	for _, key := range r.PostForm["part"] {
+		part := splitFormPart{
+			Key:    key,
+			Amount: strings.TrimSpace(r.PostFormValue("amount-" + key)),
+			Note:   strings.TrimSpace(r.PostFormValue("note-" + key)),
+			TagIDs: make(map[int]bool),
+			Tags:   tags,
+		}
+		if part.Amount == "" && part.Note == "" {
+			continue
+		}
+		for _, tagID := range r.PostForm["tags-"+key] {
+			id, err := strconv.Atoi(tagID)
+			if err != nil {
+				continue
+			}
+			part.TagIDs[id] = true
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+func saveSplit(r *http.Request, dbConn *sqlx.DB, transactionID int) error {
+	var parts []db.SplitPart
+	for _, submitted := range submittedSplitParts(r, nil) {
+		amountInCents, err := util.ParseEuros(submitted.Amount)
+		if err != nil {
+			return err
+		}
+		part := db.SplitPart{
+			AmountInCents: amountInCents,
+			Note:          submitted.Note,
+		}
+		for tagID := range submitted.TagIDs {
+			part.TagIDs = append(part.TagIDs, tagID)
+		}
+		parts = append(parts, part)
+	}
+
+	ctx := r.Context()
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := db.SplitTransaction(ctx, tx, currentHousehold(ctx), transactionID, parts); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func renderSplitForm(w http.ResponseWriter, form *splitForm) {
+	tmpl, err := readTemplates()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+		return
+	}
+	err = tmpl.ExecuteTemplate(w, "splitForm.html", form)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+		return
+	}
+}
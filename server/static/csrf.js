@@ -0,0 +1,10 @@
+// Sends the CSRF token of the session with every htmx request. The server
+// rejects requests that change data without it.
+document.addEventListener("htmx:configRequest", (event) => {
+    const cookie = document.cookie
+        .split("; ")
+        .find((cookie) => cookie.startsWith("sparschwein_csrf="));
+    if (cookie) {
+        event.detail.headers["X-CSRF-Token"] = cookie.split("=")[1];
+    }
+});
@@ -0,0 +1,26 @@
+// Lets an export be dropped anywhere on the drop zone of the upload form.
+// The change event triggers the preview of htmx.
+const dropZone = document.querySelector(".upload-drop-zone");
+const fileInput = document.getElementById("upload-file");
+
+["dragenter", "dragover"].forEach((name) => {
+    dropZone.addEventListener(name, (event) => {
+        event.preventDefault();
+        dropZone.classList.add("upload-drop-zone-active");
+    });
+});
+
+["dragleave", "drop"].forEach((name) => {
+    dropZone.addEventListener(name, () => {
+        dropZone.classList.remove("upload-drop-zone-active");
+    });
+});
+
+dropZone.addEventListener("drop", (event) => {
+    event.preventDefault();
+    if (event.dataTransfer.files.length === 0) {
+        return;
+    }
+    fileInput.files = event.dataTransfer.files;
+    fileInput.dispatchEvent(new Event("change", { bubbles: true }));
+});
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/util"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// transactionsPage is the data of the transactions.html template.
+type transactionsPage struct {
+	Holders []db.Holder
+	Tags    []db.Tag
+}
+
+// transactionRows is the data of the transactionRows.html template. NextURL
+// loads the next page and is empty on the last page. Error explains an
+// invalid filter; htmx only swaps successful responses, so it is rendered
+// instead of the rows.
+type transactionRows struct {
+	Transactions []db.ListedTransaction
+	NextURL      string
+	Error        string
+}
+
+func serveTransactionsPage(dbConn *sqlx.DB) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		tmpl, err := readTemplates()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+			return
+		}
+		var page transactionsPage
+		page.Holders, err = db.GetHolders(r.Context(), dbConn, currentHousehold(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get holders: %s", err), http.StatusInternalServerError)
+			return
+		}
+		page.Tags, err = db.GetTags(r.Context(), dbConn, currentHousehold(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get tags: %s", err), http.StatusInternalServerError)
+			return
+		}
+		err = tmpl.ExecuteTemplate(w, "transactions.html", page)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+func transactionRoutes(r chi.Router, dbConn *sqlx.DB, loc *time.Location) {
+	r.Get("/transactions", func(w http.ResponseWriter, r *http.Request) {
+		filter, err := parseTransactionFilter(r, loc)
+		if err != nil {
+			renderFragment(w, "transactionRows.html", transactionRows{Error: err.Error()})
+			return
+		}
+		// the date input picks the last day to show, the filter excludes it
+		if filter.To != nil {
+			to := filter.To.AddDate(0, 0, 1)
+			filter.To = &to
+		}
+		tmpl, err := readTemplates()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read templates: %s", err), http.StatusInternalServerError)
+			return
+		}
+		transactions, err := db.ListTransactions(r.Context(), dbConn, currentHousehold(r.Context()), filter)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("list transactions: %s", err), http.StatusInternalServerError)
+			return
+		}
+		rows := transactionRows{Transactions: transactions}
+		if len(transactions) == filter.Limit {
+			query := r.URL.Query()
+			query.Set("cursor", encodeCursor(transactions[len(transactions)-1].Cursor()))
+			rows.NextURL = "/htmx/transactions?" + query.Encode()
+		}
+		err = tmpl.ExecuteTemplate(w, "transactionRows.html", rows)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("execute template: %s", err), http.StatusInternalServerError)
+			return
+		}
+	})
+}
+
+// parseDate parses a day in loc.
+func parseDate(field string, value string, loc *time.Location) (time.Time, error) {
+	date, err := time.ParseInLocation(time.DateOnly, value, loc)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s must be a date like 2006-01-02", field)
+	}
+	return date, nil
+}
+
+// parseTransactionFilter reads the query parameters holder, direction, from
+// (inclusive), to (exclusive, the page makes it inclusive), tag, minAmount,
+// maxAmount (euros), q, sort, order, limit and cursor.
+func parseTransactionFilter(r *http.Request, loc *time.Location) (db.TransactionFilter, error) {
+	var filter db.TransactionFilter
+	query := r.URL.Query()
+	parseID := func(name string) (*int, error) {
+		value := query.Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s must be an id", name)
+		}
+		return &id, nil
+	}
+	parseDate := func(name string) (*time.Time, error) {
+		value := query.Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		date, err := parseDate(name, value, loc)
+		if err != nil {
+			return nil, err
+		}
+		return &date, nil
+	}
+	parseAmount := func(name string) (*int, error) {
+		value := query.Get(name)
+		if value == "" {
+			return nil, nil
+		}
+		cents, err := util.ParseEuros(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		return &cents, nil
+	}
+
+	var err error
+	if filter.HolderID, err = parseID("holder"); err != nil {
+		return filter, err
+	}
+	if filter.TagID, err = parseID("tag"); err != nil {
+		return filter, err
+	}
+	if filter.From, err = parseDate("from"); err != nil {
+		return filter, err
+	}
+	if filter.To, err = parseDate("to"); err != nil {
+		return filter, err
+	}
+	if filter.MinAmountInCents, err = parseAmount("minAmount"); err != nil {
+		return filter, err
+	}
+	if filter.MaxAmountInCents, err = parseAmount("maxAmount"); err != nil {
+		return filter, err
+	}
+	filter.Direction = db.Direction(query.Get("direction"))
+	filter.Text = query.Get("q")
+	filter.Sort = db.TransactionSort(query.Get("sort"))
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, fmt.Errorf("order must be asc or desc")
+	}
+	if err := filter.Validate(); err != nil {
+		return filter, err
+	}
+	if filter.Limit, err = pageSize(r); err != nil {
+		return filter, err
+	}
+	if cursor := query.Get("cursor"); cursor != "" {
+		var after db.TransactionCursor
+		if err := decodeCursor(cursor, &after); err != nil {
+			return filter, err
+		}
+		filter.After = &after
+	}
+	return filter, nil
+}
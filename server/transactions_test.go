@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/internal/testdb"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionRowsShowFilterErrors(t *testing.T) {
+	// invalid filters are rejected before the database is used
+	r := chi.NewRouter()
+	transactionRoutes(r, nil, time.UTC)
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{query: "direction=in", want: "direction needs a holder"},
+		{query: "from=01.05.2023", want: "from must be a date like 2006-01-02"},
+		{query: "holder=abc", want: "holder"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/transactions?"+tt.query, nil))
+			// htmx doesn't swap error responses
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Contains(t, w.Body.String(), `<p class="edit-error">`)
+			assert.Contains(t, w.Body.String(), tt.want)
+			assert.NotContains(t, w.Body.String(), "No transactions")
+		})
+	}
+}
+
+func TestTransactionRowsFilter(t *testing.T) {
+	dbConn := testdb.Open(t)
+	ctx := context.Background()
+	f := newHouseholdFixture(t, ctx, dbConn, "alice")
+	handler := newRouter(dbConn, Config{Location: time.UTC, Uploads: &upload.Service{Location: time.UTC}})
+	day := time.Date(2023, 5, 2, 0, 0, 0, 0, time.UTC)
+	_, err := db.InsertTransaction(ctx, dbConn, f.HouseholdID, db.CreateTransaction{
+		BaseTransaction: db.BaseTransaction{
+			AmountInCents: 80000,
+			Timestamp:     day,
+			BookingDate:   day,
+			ValueDate:     day,
+			Data: types.NullJSONText{
+				JSONText: types.JSONText(`{"Purpose": "Miete Mai", "Payee": "Vermieter"}`),
+				Valid:    true,
+			},
+		},
+		FromHolderID: f.Holder.ID,
+		ToHolderID:   f.Other.ID,
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{query: "q=miete", want: 1},
+		{query: "q=alice", want: 2},
+		// only the purpose of the data is searched
+		{query: "q=Vermieter", want: 0},
+		{query: "q=Payee", want: 0},
+		// the last day is shown
+		{query: "to=2023-05-01", want: 1},
+		{query: "from=2023-05-02&to=2023-05-02", want: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			w := f.pageRequest(t, handler, http.MethodGet, "/htmx/transactions?"+tt.query, nil)
+			require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+			assert.Equal(t, tt.want, strings.Count(w.Body.String(), `class="transaction-list-entry"`), w.Body.String())
+		})
+	}
+
+	// the API keeps the exclusive upper bound
+	w := f.apiRequest(t, handler, http.MethodGet, "/transactions?to=2023-05-02", "")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	response := decodeJSON[page[apiTransaction]](t, w)
+	require.Len(t, response.Items, 1)
+	assert.Equal(t, f.TransactionID, response.Items[0].ID)
+}
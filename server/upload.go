@@ -0,0 +1,180 @@
+package server
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/go-chi/chi/v5"
+	"github.com/jmoiron/sqlx"
+)
+
+// maxUploadSize limits the size of an uploaded export. Exports of several
+// years are still well below.
+const maxUploadSize = 10 << 20
+
+// uploadPage is the data of the upload.html template.
+type uploadPage struct {
+	Formats []string
+	Holders []db.Holder
+}
+
+// uploadPreview is the data of the uploadPreview.html template. Format,
+// Owner and Data are sent back to import the export after confirming.
+type uploadPreview struct {
+	Format       string
+	Owner        string
+	Data         string
+	NewHolders   []db.CreateHolder
+	Transactions []uploadRow
+	Duplicates   []uploadRow
+	Rejected     []upload.RejectedRow
+	Error        string
+}
+
+// uploadRow is a transaction of the preview.
+type uploadRow struct {
+	upload.TransactionToCreate
+	FromName string
+	ToName   string
+	Tags     []string
+}
+
+// newUploadPreview orders the new holders by name and resolves the names of
+// the holders of the transactions.
+func newUploadPreview(preview *upload.Preview) uploadPreview {
+	result := uploadPreview{
+		NewHolders: make([]db.CreateHolder, 0, len(preview.HoldersToCreate)),
+		Rejected:   preview.Rejected,
+	}
+	for _, holder := range preview.HoldersToCreate {
+		result.NewHolders = append(result.NewHolders, holder)
+	}
+	sort.Slice(result.NewHolders, func(i, j int) bool {
+		return result.NewHolders[i].Name < result.NewHolders[j].Name
+	})
+
+	rows := func(transactions []upload.TransactionToCreate) []uploadRow {
+		rows := make([]uploadRow, 0, len(transactions))
+		for _, transaction := range transactions {
+			row := uploadRow{
+				TransactionToCreate: transaction,
+				FromName:            preview.HolderName(transaction.FromIdentifier),
+				ToName:              preview.HolderName(transaction.ToIdentifier),
+			}
+			for _, hit := range transaction.RuleHits {
+				row.Tags = append(row.Tags, hit.RuleName)
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+	result.Transactions = rows(preview.Transactions)
+	result.Duplicates = rows(preview.Duplicates)
+	return result
+}
+
+func serveUploadPage(dbConn *sqlx.DB, uploads *upload.Service) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		holders, err := db.GetHolders(r.Context(), dbConn, currentHousehold(r.Context()))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("get holders: %s", err), http.StatusInternalServerError)
+			return
+		}
+		renderFragment(w, "upload.html", uploadPage{
+			Formats: uploads.Formats(),
+			Holders: holders,
+		})
+	}
+}
+
+func uploadRoutes(r chi.Router, dbConn *sqlx.DB, uploads *upload.Service, metrics *serverMetrics) {
+	r.Post("/upload/preview", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+		if err := r.ParseMultipartForm(maxUploadSize); err != nil {
+			renderFragment(w, "uploadPreview.html", uploadPreview{
+				Error: fmt.Sprintf("The upload is invalid or larger than %d MB.", maxUploadSize>>20),
+			})
+			return
+		}
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			renderFragment(w, "uploadPreview.html", uploadPreview{Error: "Choose a file to upload."})
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(file)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("read upload: %s", err), http.StatusBadRequest)
+			return
+		}
+		format, owner := r.FormValue("format"), r.FormValue("owner")
+
+		options, err := uploadOptions(owner)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		preview, err := uploads.Preview(r.Context(), dbConn, currentHousehold(r.Context()), format, data, options)
+		if err != nil {
+			renderFragment(w, "uploadPreview.html", uploadPreview{Error: uploadErrorMessage(err)})
+			return
+		}
+		result := newUploadPreview(preview)
+		result.Format = format
+		result.Owner = owner
+		result.Data = base64.StdEncoding.EncodeToString(data)
+		renderFragment(w, "uploadPreview.html", result)
+	})
+
+	r.Post("/upload/import", func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, 2*maxUploadSize)
+		data, err := base64.StdEncoding.DecodeString(r.FormValue("data"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("decode data: %s", err), http.StatusBadRequest)
+			return
+		}
+		options, err := uploadOptions(r.FormValue("owner"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		format := r.FormValue("format")
+		summary, err := uploads.Import(r.Context(), dbConn, currentHousehold(r.Context()), format, data, options)
+		if err != nil {
+			renderFragment(w, "uploadPreview.html", uploadPreview{Error: uploadErrorMessage(err)})
+			return
+		}
+		metrics.recordImport(format, summary)
+		renderFragment(w, "uploadResult", summary)
+	})
+}
+
+// uploadOptions reads the optional owner of new account holders.
+func uploadOptions(owner string) (upload.DryRunOptions, error) {
+	var options upload.DryRunOptions
+	if owner == "" {
+		return options, nil
+	}
+	ownerID, err := strconv.Atoi(owner)
+	if err != nil {
+		return options, fmt.Errorf("parse owner id: %w", err)
+	}
+	options.OwnerHolderID = &ownerID
+	return options, nil
+}
+
+// uploadErrorMessage explains why an export can't be read. Parse errors are
+// shown as they are, because they point to the broken line.
+func uploadErrorMessage(err error) string {
+	if errors.Is(err, upload.ErrUnknownFormat) {
+		return "The format isn't supported."
+	}
+	return fmt.Sprintf("The export can't be imported: %s", err)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/rules"
+	"github.com/Opsi/sparschwein/upload"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewUploadPreview(t *testing.T) {
+	account := db.HolderIdentifier{Type: "iban", Identifier: "DE02120300000000202051"}
+	bakery := db.HolderIdentifier{Type: "dkb/payee", Identifier: "Bäckerei"}
+	landlord := db.HolderIdentifier{Type: "dkb/payee", Identifier: "Vermieter"}
+
+	existing := db.Holder{ID: 1}
+	existing.HolderIdentifier = account
+	existing.Name = "Girokonto"
+
+	preview := &upload.Preview{
+		DryRunResult: &upload.DryRunResult{
+			ExistingHolders: map[db.HolderIdentifier]db.Holder{account: existing},
+			HoldersToCreate: map[db.HolderIdentifier]db.CreateHolder{
+				landlord: {HolderIdentifier: landlord, Name: "Vermieter"},
+				bakery:   {HolderIdentifier: bakery, Name: "Bäckerei"},
+			},
+			Transactions: []upload.TransactionToCreate{{
+				FromIdentifier: account,
+				ToIdentifier:   bakery,
+				RuleHits:       []rules.Hit{{RuleID: 1, RuleName: "Food", TagID: 2}},
+			}},
+			Duplicates: []upload.TransactionToCreate{{
+				FromIdentifier: account,
+				ToIdentifier:   landlord,
+			}},
+		},
+		Rejected: []upload.RejectedRow{{Line: 7, Reason: "row is not yet booked"}},
+	}
+
+	result := newUploadPreview(preview)
+
+	require.Len(t, result.NewHolders, 2)
+	assert.Equal(t, "Bäckerei", result.NewHolders[0].Name)
+	assert.Equal(t, "Vermieter", result.NewHolders[1].Name)
+	require.Len(t, result.Transactions, 1)
+	assert.Equal(t, "Girokonto", result.Transactions[0].FromName)
+	assert.Equal(t, "Bäckerei", result.Transactions[0].ToName)
+	assert.Equal(t, []string{"Food"}, result.Transactions[0].Tags)
+	require.Len(t, result.Duplicates, 1)
+	assert.Equal(t, "Vermieter", result.Duplicates[0].ToName)
+	assert.Equal(t, preview.Rejected, result.Rejected)
+}
@@ -6,18 +6,47 @@ import (
 	"log/slog"
 
 	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/iban"
 	"github.com/jmoiron/sqlx/types"
 )
 
 type account struct {
 	HolderType string
 	IBAN       string
+	// IBANValid is false if the IBAN failed the validation. The account is
+	// still imported, but the holder data flags it.
+	IBANValid bool
+	BankName  string
+	BIC       string
+}
+
+// newAccount validates the IBAN and looks up the bank.
+func newAccount(holderType string, rawIBAN string) account {
+	a := account{
+		HolderType: holderType,
+		IBAN:       iban.Normalize(rawIBAN),
+	}
+	if err := iban.Validate(a.IBAN); err != nil {
+		slog.Warn("account has an invalid iban",
+			slog.String("iban", a.IBAN),
+			slog.String("error", err.Error()))
+		return a
+	}
+	a.IBANValid = true
+	if bank, ok := iban.LookupBank(a.IBAN); ok {
+		a.BankName = bank.Name
+		a.BIC = bank.BIC
+	}
+	return a
 }
 
 func (a account) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.String("holderType", a.HolderType),
 		slog.String("iban", a.IBAN),
+		slog.Bool("ibanValid", a.IBANValid),
+		slog.String("bankName", a.BankName),
+		slog.String("bic", a.BIC),
 	)
 }
 
@@ -40,7 +69,7 @@ func (a account) createHolder() db.CreateHolder {
 		HolderIdentifier: a.holderIndentifier(),
 		ParentHolderID:   nil,
 		Favorite:         true,
-		Name:             fmt.Sprintf("%s %s", a.HolderType, a.IBAN),
+		Name:             fmt.Sprintf("%s %s", a.HolderType, iban.Format(a.IBAN)),
 		Data: types.NullJSONText{
 			JSONText: accountInfoBytes,
 			Valid:    true,
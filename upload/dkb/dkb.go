@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/Opsi/sparschwein/upload"
+	"github.com/Opsi/sparschwein/upload/normalize"
 )
 
 var (
@@ -37,37 +38,47 @@ type headerInfo struct {
 	BalanceInCents int
 }
 
-func ParseCSV(csvData []byte) ([]upload.TransactionCreator, error) {
+// headerLines is the number of lines before the first record.
+const headerLines = 5
+
+// ParseCSV parses a DKB CSV export. Dates in the export are calendar days
+// in loc. The names of the counterparties are cleaned up by the normalizer,
+// which may be nil.
+// Records that can't be imported are returned as rejected rows.
+func ParseCSV(csvData []byte, loc *time.Location, normalizer *normalize.Normalizer) ([]upload.TransactionCreator, []upload.RejectedRow, error) {
 	// first we ne to trim down the first 4 lines
 	reader := bufio.NewReader(bytes.NewReader(csvData))
 
 	info, err := checkFirstLines(reader)
 	if err != nil {
-		return nil, fmt.Errorf("check first lines: %w", err)
+		return nil, nil, fmt.Errorf("check first lines: %w", err)
 	}
 
-	rows, err := parseRows(reader)
+	rows, rejected, err := parseRows(reader)
 	if err != nil {
-		return nil, fmt.Errorf("parse rows: %w", err)
+		return nil, nil, fmt.Errorf("parse rows: %w", err)
 	}
 
 	creators := make([]upload.TransactionCreator, 0)
 	for _, row := range rows {
 		creators = append(creators, transactionCreator{
-			Row:     row,
-			Account: &info.account,
+			Row:        row,
+			Account:    &info.account,
+			Location:   loc,
+			Normalizer: normalizer,
 		})
 	}
-	return creators, nil
+	return creators, rejected, nil
 }
 
-func parseRows(reader *bufio.Reader) ([]csvRow, error) {
+func parseRows(reader *bufio.Reader) ([]csvRow, []upload.RejectedRow, error) {
 	// Create a new reader
 	csvReader := csv.NewReader(reader)
 	csvReader.Comma = ';'
 	csvReader.FieldsPerRecord = 11
 
 	rows := make([]csvRow, 0)
+	var rejected []upload.RejectedRow
 	recordCount := 0
 	for {
 		// Read each record
@@ -78,7 +89,7 @@ func parseRows(reader *bufio.Reader) ([]csvRow, error) {
 			break
 		}
 		if err != nil {
-			return nil, fmt.Errorf("read csv record %d: %w", recordCount, err)
+			return nil, nil, fmt.Errorf("read csv record %d: %w", recordCount, err)
 		}
 
 		row, err := parseRow(record)
@@ -86,11 +97,17 @@ func parseRows(reader *bufio.Reader) ([]csvRow, error) {
 			slog.Warn("skipping record because of error",
 				slog.Any("record", record),
 				slog.String("error", err.Error()))
+			line, _ := csvReader.FieldPos(0)
+			rejected = append(rejected, upload.RejectedRow{
+				Line:   headerLines + line,
+				Fields: record,
+				Reason: err.Error(),
+			})
 			continue
 		}
 		rows = append(rows, row)
 	}
-	return rows, nil
+	return rows, rejected, nil
 }
 
 func parseRow(row []string) (csvRow, error) {
@@ -129,6 +146,7 @@ func parseRow(row []string) (csvRow, error) {
 	}, nil
 }
 
+// parseDate parses a calendar day. The result is midnight UTC of that day.
 func parseDate(dateBytes []byte) (time.Time, error) {
 	// parse the date of the form "dd.mm.yyyy"
 	date, err := time.Parse("02.01.2006", string(dateBytes))
@@ -163,12 +181,11 @@ func (i *headerInfo) parseFirstLine(line []byte) error {
 	if holderType == "" {
 		return fmt.Errorf("holder type is empty")
 	}
-	iban := strings.TrimSpace(string(matches[2]))
-	if iban == "" {
+	rawIBAN := strings.TrimSpace(string(matches[2]))
+	if rawIBAN == "" {
 		return fmt.Errorf("iban is empty")
 	}
-	i.HolderType = holderType
-	i.IBAN = iban
+	i.account = newAccount(holderType, rawIBAN)
 	return nil
 }
 
@@ -2,6 +2,10 @@ package dkb
 
 import (
 	"testing"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload/normalize"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -13,6 +17,8 @@ func TestParseFirstLine(t *testing.T) {
 		line       string
 		holderType string
 		iban       string
+		ibanValid  bool
+		bic        string
 	}{
 		{
 			name:       "valid",
@@ -24,6 +30,13 @@ func TestParseFirstLine(t *testing.T) {
 			line:       `HEHEHEJKHJK"Konto";"Tagesgeldkonto DE12345678901234567890"\n`,
 			holderType: "Tagesgeldkonto",
 			iban:       "DE12345678901234567890",
+		}, {
+			name:       "valid iban with known bank",
+			line:       `"Konto";"Girokonto DE02120300000000202051"`,
+			holderType: "Girokonto",
+			iban:       "DE02120300000000202051",
+			ibanValid:  true,
+			bic:        "BYLADEM1001",
 		},
 	}
 	for _, tt := range tests {
@@ -33,6 +46,204 @@ func TestParseFirstLine(t *testing.T) {
 			require.NoError(t, err)
 			assert.Equal(t, tt.holderType, info.HolderType)
 			assert.Equal(t, tt.iban, info.IBAN)
+			assert.Equal(t, tt.ibanValid, info.IBANValid)
+			assert.Equal(t, tt.bic, info.BIC)
+		})
+	}
+}
+
+func TestTransactionDates(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	require.NoError(t, err)
+
+	row, err := parseRow([]string{
+		"01.10.23", "02.10.23", "Gebucht", "Max Mustermann", "Erika Musterfrau",
+		"Miete", "Ausgang", "-1.234,56 €", "", "", "",
+	})
+	require.NoError(t, err)
+	creator := transactionCreator{
+		Row:      row,
+		Account:  &account{HolderType: "Girokonto", IBAN: "DE12345678901234567890"},
+		Location: berlin,
+	}
+	transaction := creator.Transaction()
+
+	assert.Equal(t, 123456, transaction.AmountInCents)
+	assert.Equal(t, time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), transaction.BookingDate)
+	assert.Equal(t, time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC), transaction.ValueDate)
+	// midnight in berlin is still the previous day in UTC
+	assert.Equal(t, time.Date(2023, 10, 1, 22, 0, 0, 0, time.UTC), transaction.Timestamp.UTC())
+}
+
+func TestCounterpartyHolder(t *testing.T) {
+	normalizer, err := normalize.New(normalize.DefaultConfig())
+	require.NoError(t, err)
+
+	row, err := parseRow([]string{
+		"01.10.23", "01.10.23", "Gebucht", "Max Mustermann", "REWE SAGT DANKE 1234",
+		"Einkauf", "Ausgang", "-12,34 €", "", "", "",
+	})
+	require.NoError(t, err)
+	creator := transactionCreator{
+		Row:        row,
+		Account:    &account{HolderType: "Girokonto", IBAN: "DE12345678901234567890"},
+		Location:   time.UTC,
+		Normalizer: normalizer,
+	}
+	holder := creator.ToHolder()
+
+	assert.Equal(t, "dkb/payee", holder.Type)
+	assert.Equal(t, "Rewe", holder.Identifier)
+	assert.Equal(t, "Rewe", holder.Name)
+	assert.JSONEq(t, `{"RawName": "REWE SAGT DANKE 1234"}`, string(holder.Data.JSONText))
+}
+
+func TestCounterpartyHolderWithoutNormalizer(t *testing.T) {
+	row, err := parseRow([]string{
+		"01.10.23", "01.10.23", "Gebucht", "Max Mustermann", " REWE SAGT DANKE 1234 ",
+		"Einkauf", "Ausgang", "-12,34 €", "", "", "",
+	})
+	require.NoError(t, err)
+	creator := transactionCreator{
+		Row:      row,
+		Account:  &account{HolderType: "Girokonto", IBAN: "DE12345678901234567890"},
+		Location: time.UTC,
+	}
+	holder := creator.ToHolder()
+
+	assert.Equal(t, "REWE SAGT DANKE 1234", holder.Identifier)
+	assert.Equal(t, "REWE SAGT DANKE 1234", holder.Name)
+}
+
+func TestCounterpartyIdentifier(t *testing.T) {
+	normalizer, err := normalize.New(normalize.DefaultConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		purpose    string
+		creditorID string
+		want       db.HolderIdentifier
+	}{
+		{
+			name: "name",
+			want: db.HolderIdentifier{Type: "dkb/payee", Identifier: "Hausverwaltung Huber"},
+		}, {
+			name:       "creditor id",
+			purpose:    "Beitrag DE02500105170137075030",
+			creditorID: "DE98ZZZ09999999999",
+			want:       db.HolderIdentifier{Type: "sepa-creditor", Identifier: "DE98ZZZ09999999999"},
+		}, {
+			name:       "invalid creditor id",
+			creditorID: "DE97ZZZ09999999999",
+			want:       db.HolderIdentifier{Type: "dkb/payee", Identifier: "Hausverwaltung Huber"},
+		}, {
+			name:    "iban in purpose",
+			purpose: "Miete von DE02 1203 0000 0000 2020 51 an DE02 5001 0517 0137 0750 30",
+			want:    db.HolderIdentifier{Type: "iban", Identifier: "DE02500105170137075030"},
+		}, {
+			name:    "invalid iban in purpose",
+			purpose: "Miete an DE12345678901234567890",
+			want:    db.HolderIdentifier{Type: "dkb/payee", Identifier: "Hausverwaltung Huber"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator := transactionCreator{
+				Row: csvRow{
+					Payee:         "HAUSVERWALTUNG HUBER",
+					Purpose:       tt.purpose,
+					AmountInCents: -100000,
+					CreditorID:    tt.creditorID,
+				},
+				Account:    &account{HolderType: "Girokonto", IBAN: "DE02120300000000202051"},
+				Location:   time.UTC,
+				Normalizer: normalizer,
+			}
+			assert.Equal(t, tt.want, creator.ToHolder().HolderIdentifier)
+		})
+	}
+}
+
+func TestLegacyIdentifier(t *testing.T) {
+	normalizer, err := normalize.New(normalize.DefaultConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		amountInCents int
+		creditorID    string
+		want          db.HolderIdentifier
+		changed       bool
+	}{
+		{
+			name:          "normalized payee",
+			amountInCents: -100000,
+			want:          db.HolderIdentifier{Type: "dkb/payee", Identifier: "HAUSVERWALTUNG HUBER"},
+			changed:       true,
+		}, {
+			name:          "payee creditor id",
+			amountInCents: -100000,
+			creditorID:    "DE98ZZZ09999999999",
+			want:          db.HolderIdentifier{Type: "dkb/payee", Identifier: "HAUSVERWALTUNG HUBER"},
+			changed:       true,
+		}, {
+			name:          "payer",
+			amountInCents: 100000,
+			want:          db.HolderIdentifier{Type: "dkb/payer", Identifier: "Max Mustermann"},
+			changed:       false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator := transactionCreator{
+				Row: csvRow{
+					Payer:         "Max Mustermann",
+					Payee:         "HAUSVERWALTUNG HUBER",
+					AmountInCents: tt.amountInCents,
+					CreditorID:    tt.creditorID,
+				},
+				Account:    &account{HolderType: "Girokonto", IBAN: "DE02120300000000202051"},
+				Location:   time.UTC,
+				Normalizer: normalizer,
+			}
+			counterparty := creator.ToHolder()
+			if tt.amountInCents > 0 {
+				counterparty = creator.FromHolder()
+			}
+			legacy, changed := creator.LegacyIdentifier(counterparty)
+			assert.Equal(t, tt.changed, changed)
+			if changed {
+				assert.Equal(t, tt.want, legacy)
+			}
+
+			// the account holder never changed
+			_, changed = creator.LegacyIdentifier(creator.AccountHolder())
+			assert.False(t, changed)
 		})
 	}
 }
+
+func TestParseCSVRejectsRows(t *testing.T) {
+	normalizer, err := normalize.New(normalize.DefaultConfig())
+	require.NoError(t, err)
+
+	csvData := `"Konto";"Girokonto DE12345678901234567890"
+""
+"Kontostand vom 03.10.2023:";"1.000,00 EUR"
+""
+"Buchungsdatum";"Wertstellung";"Status";"Zahlungspflichtige*r";"Zahlungsempfänger*in";"Verwendungszweck";"Umsatztyp";"Betrag (€)";"Gläubiger-ID";"Mandatsreferenz";"Kundenreferenz"
+"01.10.23";"02.10.23";"Gebucht";"Max Mustermann";"Erika Musterfrau";"Miete";"Ausgang";"-1.234,56 €";"";"";""
+"";"03.10.23";"Vorgemerkt";"Max Mustermann";"Bäckerei";"Brötchen";"Ausgang";"-3,50 €";"";"";""
+"xx.10.23";"03.10.23";"Gebucht";"Max Mustermann";"Bäckerei";"Brötchen";"Ausgang";"-3,50 €";"";"";""
+`
+	creators, rejected, err := ParseCSV([]byte(csvData), time.UTC, normalizer)
+	require.NoError(t, err)
+	assert.Len(t, creators, 1)
+	require.Len(t, rejected, 2)
+	assert.Equal(t, 7, rejected[0].Line)
+	assert.Equal(t, "row is not yet booked", rejected[0].Reason)
+	assert.Equal(t, 8, rejected[1].Line)
+	assert.Contains(t, rejected[1].Reason, "booking date")
+	assert.Equal(t, "xx.10.23", rejected[1].Fields[0])
+}
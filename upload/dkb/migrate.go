@@ -0,0 +1,135 @@
+package dkb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload/normalize"
+	"github.com/jmoiron/sqlx"
+)
+
+// Rekey records how a counterparty holder was re-keyed.
+type Rekey struct {
+	HolderID   int
+	From       db.HolderIdentifier
+	To         db.HolderIdentifier
+	MergedInto *int
+}
+
+func (r Rekey) LogValue() slog.Value {
+	attrs := []slog.Attr{
+		slog.Int("holderID", r.HolderID),
+		slog.Any("from", r.From),
+		slog.Any("to", r.To),
+	}
+	if r.MergedInto != nil {
+		attrs = append(attrs, slog.Int("mergedInto", *r.MergedInto))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+// RekeyHolders gives the counterparties created by older versions of the
+// importer the identifier a new import would give them, e.g. their creditor
+// id or IBAN instead of their name. If another holder already has the new
+// identifier, the counterparty is merged into it. Otherwise the old
+// identifier is kept as an alias. Counterparties whose transactions don't
+// agree on one identifier are left alone. Only the holders of the household
+// are looked at.
+func RekeyHolders(ctx context.Context, dbConn sqlx.ExtContext, householdID int, normalizer *normalize.Normalizer) ([]Rekey, error) {
+	holders, err := db.GetHolders(ctx, dbConn, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("get holders: %w", err)
+	}
+
+	var rekeys []Rekey
+	for _, holder := range holders {
+		if holder.Type != "dkb/payer" && holder.Type != "dkb/payee" {
+			continue
+		}
+		identifier, ok, err := newCounterpartyIdentifier(ctx, dbConn, normalizer, holder)
+		if err != nil {
+			return nil, fmt.Errorf("new identifier of holder %d: %w", holder.ID, err)
+		}
+		if !ok || identifier == holder.HolderIdentifier {
+			continue
+		}
+		rekey := Rekey{
+			HolderID: holder.ID,
+			From:     holder.HolderIdentifier,
+			To:       identifier,
+		}
+
+		existing, ok, err := db.GetHolderByIdentifier(ctx, dbConn, householdID, identifier)
+		if err != nil {
+			return nil, fmt.Errorf("get holder by identifier: %w", err)
+		}
+		if ok && existing.ID != holder.ID {
+			err = db.MergeHolders(ctx, dbConn, householdID, holder.ID, existing.ID)
+			if err != nil {
+				return nil, fmt.Errorf("merge holder %d into %d: %w", holder.ID, existing.ID, err)
+			}
+			rekey.MergedInto = &existing.ID
+		} else {
+			err = db.UpdateHolderIdentifier(ctx, dbConn, householdID, holder.ID, identifier)
+			if err != nil {
+				return nil, fmt.Errorf("update identifier of holder %d: %w", holder.ID, err)
+			}
+			err = db.AddHolderAlias(ctx, dbConn, householdID, holder.HolderIdentifier, holder.ID)
+			if err != nil {
+				return nil, fmt.Errorf("add alias of holder %d: %w", holder.ID, err)
+			}
+		}
+		slog.Debug("rekeyed holder", slog.Any("rekey", rekey))
+		rekeys = append(rekeys, rekey)
+	}
+	return rekeys, nil
+}
+
+// newCounterpartyIdentifier computes the identifier of the counterparty from
+// the rows of its transactions. It returns false if there are no rows or
+// they disagree.
+func newCounterpartyIdentifier(ctx context.Context,
+	dbConn sqlx.QueryerContext,
+	normalizer *normalize.Normalizer,
+	holder db.Holder) (db.HolderIdentifier, bool, error) {
+	transactions, err := db.GetHolderTransactions(ctx, dbConn, holder.HouseholdID, holder.ID, db.HolderTransactionFilter{})
+	if err != nil {
+		return db.HolderIdentifier{}, false, fmt.Errorf("get holder transactions: %w", err)
+	}
+
+	identifiers := make(map[db.HolderIdentifier]struct{})
+	var identifier db.HolderIdentifier
+	for _, transaction := range transactions {
+		if !transaction.Data.Valid {
+			continue
+		}
+		var row csvRow
+		if err := json.Unmarshal(transaction.Data.JSONText, &row); err != nil {
+			return db.HolderIdentifier{}, false, fmt.Errorf("unmarshal row of transaction %d: %w", transaction.ID, err)
+		}
+		// the other side of the transaction is the own account
+		creator := transactionCreator{
+			Row:        row,
+			Account:    &account{IBAN: transaction.Counterparty.Identifier},
+			Normalizer: normalizer,
+		}
+		rawName := row.Payee
+		if holder.Type == "dkb/payer" {
+			rawName = row.Payer
+		}
+		identifier = creator.counterpartyHolder(holder.Type, rawName).HolderIdentifier
+		identifiers[identifier] = struct{}{}
+	}
+	if len(identifiers) != 1 {
+		if len(identifiers) > 1 {
+			slog.Warn("transactions of holder disagree on the identifier",
+				slog.Int("holderID", holder.ID),
+				slog.Int("identifiers", len(identifiers)))
+		}
+		return db.HolderIdentifier{}, false, nil
+	}
+	return identifier, true, nil
+}
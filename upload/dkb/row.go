@@ -3,10 +3,13 @@ package dkb
 import (
 	"encoding/json"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/iban"
 	"github.com/Opsi/sparschwein/upload"
+	"github.com/Opsi/sparschwein/upload/normalize"
 	"github.com/jmoiron/sqlx/types"
 )
 
@@ -45,9 +48,17 @@ func (r csvRow) LogValue() slog.Value {
 type transactionCreator struct {
 	Row     csvRow
 	Account *account
+	// Location is the time zone the dates of the row are in.
+	Location *time.Location
+	// Normalizer cleans up the names of the counterparties. Without one the
+	// names are only trimmed.
+	Normalizer *normalize.Normalizer
 }
 
-var _ upload.TransactionCreator = transactionCreator{}
+var (
+	_ upload.TransactionCreator = transactionCreator{}
+	_ upload.LegacyHolders      = transactionCreator{}
+)
 
 func (t transactionCreator) Transaction() db.BaseTransaction {
 	data, err := json.Marshal(t.Row)
@@ -58,7 +69,9 @@ func (t transactionCreator) Transaction() db.BaseTransaction {
 	}
 	return db.BaseTransaction{
 		AmountInCents: max(t.Row.AmountInCents, -t.Row.AmountInCents),
-		Timestamp:     t.Row.ValueDate,
+		Timestamp:     startOfDay(t.Row.ValueDate, t.Location),
+		BookingDate:   t.Row.BookingDate,
+		ValueDate:     t.Row.ValueDate,
 		Data: types.NullJSONText{
 			JSONText: data,
 			Valid:    true,
@@ -67,44 +80,115 @@ func (t transactionCreator) Transaction() db.BaseTransaction {
 	}
 }
 
+func (t transactionCreator) AccountHolder() db.CreateHolder {
+	return t.Account.createHolder()
+}
+
+// startOfDay returns midnight in loc of the calendar day of date.
+func startOfDay(date time.Time, loc *time.Location) time.Time {
+	year, month, day := date.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, loc)
+}
+
 func (t transactionCreator) FromHolder() db.CreateHolder {
 	if t.Row.AmountInCents < 0 {
 		// The owner of the account is the payer
 		return t.Account.createHolder()
 	}
 	// The owner of the account is the payee
-	return db.CreateHolder{
-		HolderIdentifier: db.HolderIdentifier{
-			Type:       "dkb/payer",
-			Identifier: t.Row.Payer,
-		},
-		ParentHolderID: nil,
-		Favorite:       false,
-		Name:           t.Row.Payer,
-		Data: types.NullJSONText{
-			JSONText: nil,
-			Valid:    false,
-		},
-	}
+	return t.counterpartyHolder("dkb/payer", t.Row.Payer)
 }
 
 func (t transactionCreator) ToHolder() db.CreateHolder {
 	if t.Row.AmountInCents < 0 {
 		// The owner of the account is the payer
-		return db.CreateHolder{
-			HolderIdentifier: db.HolderIdentifier{
-				Type:       "dkb/payee",
-				Identifier: t.Row.Payee,
-			},
-			ParentHolderID: nil,
-			Favorite:       false,
-			Name:           t.Row.Payee,
-			Data: types.NullJSONText{
-				JSONText: nil,
-				Valid:    false,
-			},
-		}
+		return t.counterpartyHolder("dkb/payee", t.Row.Payee)
 	}
 	// The owner of the account is the payee
 	return t.Account.createHolder()
 }
+
+// LegacyIdentifier returns the identifier the importer gave the counterparty
+// before names were normalized and creditor ids and IBANs were preferred:
+// its raw name.
+func (t transactionCreator) LegacyIdentifier(holder db.CreateHolder) (db.HolderIdentifier, bool) {
+	if holder.HolderIdentifier == t.Account.createHolder().HolderIdentifier {
+		return db.HolderIdentifier{}, false
+	}
+	legacy := db.HolderIdentifier{
+		Type:       "dkb/payer",
+		Identifier: t.Row.Payer,
+	}
+	if t.Row.AmountInCents < 0 {
+		legacy = db.HolderIdentifier{
+			Type:       "dkb/payee",
+			Identifier: t.Row.Payee,
+		}
+	}
+	return legacy, legacy != holder.HolderIdentifier
+}
+
+// counterpartyIdentifier prefers identifiers that stay the same across banks
+// and name spellings: the SEPA creditor id, then an IBAN in the purpose that
+// isn't the own one, and only then the normalized name.
+func (t transactionCreator) counterpartyIdentifier(holderType string, name string) db.HolderIdentifier {
+	creditorID := iban.Normalize(t.Row.CreditorID)
+	if iban.ValidCreditorID(creditorID) {
+		return db.HolderIdentifier{
+			Type:       "sepa-creditor",
+			Identifier: creditorID,
+		}
+	}
+	for _, found := range iban.Find(t.Row.Purpose) {
+		if found == iban.Normalize(t.Account.IBAN) {
+			continue
+		}
+		return db.HolderIdentifier{
+			Type:       "iban",
+			Identifier: found,
+		}
+	}
+	return db.HolderIdentifier{
+		Type:       holderType,
+		Identifier: name,
+	}
+}
+
+// counterpartyHolder creates the counterparty with its normalized name. The
+// raw name is kept in the data of the holder.
+func (t transactionCreator) counterpartyHolder(holderType string, rawName string) db.CreateHolder {
+	name := strings.TrimSpace(rawName)
+	if t.Normalizer != nil {
+		name = t.Normalizer.Name(rawName, t.Row.Purpose)
+	}
+	identifier := t.counterpartyIdentifier(holderType, name)
+	counterparty := struct {
+		RawName  string
+		BankName string `json:",omitempty"`
+		BIC      string `json:",omitempty"`
+	}{
+		RawName: rawName,
+	}
+	if identifier.Type == "iban" {
+		if bank, ok := iban.LookupBank(identifier.Identifier); ok {
+			counterparty.BankName = bank.Name
+			counterparty.BIC = bank.BIC
+		}
+	}
+	data, err := json.Marshal(counterparty)
+	if err != nil {
+		slog.Error("error marshalling counterparty data",
+			slog.String("error", err.Error()),
+			slog.String("rawName", rawName))
+	}
+	return db.CreateHolder{
+		HolderIdentifier: identifier,
+		ParentHolderID:   nil,
+		Favorite:         false,
+		Name:             name,
+		Data: types.NullJSONText{
+			JSONText: data,
+			Valid:    err == nil,
+		},
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"log/slog"
 
 	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/rules"
 	"github.com/jmoiron/sqlx"
 )
 
@@ -14,12 +15,23 @@ type TransactionToCreate struct {
 	Transaction    db.BaseTransaction
 	FromIdentifier db.HolderIdentifier
 	ToIdentifier   db.HolderIdentifier
+	// RuleHits are the rules matching the transaction. Their tags are
+	// attached when the transaction is inserted.
+	RuleHits []rules.Hit
 }
 
 type DryRunResult struct {
+	// HouseholdID is the household the export is imported into.
+	HouseholdID     int
 	ExistingHolders map[db.HolderIdentifier]db.Holder
 	HoldersToCreate map[db.HolderIdentifier]db.CreateHolder
-	Transactions    []TransactionToCreate
+	// Aliases map the identifiers of holders that were only found by their
+	// legacy identifier to the holder ID. They are added as aliases on
+	// import, so the next import finds the holders directly.
+	Aliases      map[db.HolderIdentifier]int
+	Transactions []TransactionToCreate
+	// Duplicates are already in the database and won't be inserted.
+	Duplicates []TransactionToCreate
 }
 
 var _ json.Marshaler = DryRunResult{}
@@ -28,9 +40,11 @@ func (r DryRunResult) MarshalJSON() ([]byte, error) {
 	asJson := struct {
 		Holders      []db.CreateHolder
 		Transactions []TransactionToCreate
+		Duplicates   []TransactionToCreate
 	}{
 		Holders:      make([]db.CreateHolder, 0, len(r.HoldersToCreate)),
 		Transactions: r.Transactions,
+		Duplicates:   r.Duplicates,
 	}
 	for _, holder := range r.HoldersToCreate {
 		asJson.Holders = append(asJson.Holders, holder)
@@ -43,10 +57,47 @@ func (r DryRunResult) LogValue() slog.Value {
 		slog.Int("existingHolders", len(r.ExistingHolders)),
 		slog.Int("holdersToCreate", len(r.HoldersToCreate)),
 		slog.Int("transactions", len(r.Transactions)),
+		slog.Int("duplicates", len(r.Duplicates)),
+		slog.Int("ruleHits", r.RuleHitCount()),
 	)
 }
 
-func (r *DryRunResult) CheckHolder(ctx context.Context, dbConn sqlx.QueryerContext, cHolder db.CreateHolder) error {
+// RuleHitCount returns the number of rule hits over all transactions.
+func (r DryRunResult) RuleHitCount() int {
+	count := 0
+	for _, transaction := range r.Transactions {
+		count += len(transaction.RuleHits)
+	}
+	return count
+}
+
+// HolderName returns the name of the existing or to be created holder.
+func (r DryRunResult) HolderName(identifier db.HolderIdentifier) string {
+	if holder, ok := r.ExistingHolders[identifier]; ok {
+		return holder.Name
+	}
+	return r.HoldersToCreate[identifier].Name
+}
+
+// applyRules records the hits of the rules on the transaction.
+func (r DryRunResult) applyRules(compiledRules []rules.Rule, transaction *TransactionToCreate) error {
+	subject, err := rules.NewSubject(
+		transaction.Transaction,
+		r.HolderName(transaction.FromIdentifier),
+		r.HolderName(transaction.ToIdentifier))
+	if err != nil {
+		return fmt.Errorf("new subject: %w", err)
+	}
+	transaction.RuleHits = rules.Apply(compiledRules, subject)
+	return nil
+}
+
+// CheckHolder looks the holder up by its identifier and then by the legacy
+// identifiers and records whether it has to be created.
+func (r *DryRunResult) CheckHolder(ctx context.Context,
+	dbConn sqlx.QueryerContext,
+	cHolder db.CreateHolder,
+	legacy ...db.HolderIdentifier) error {
 	if _, ok := r.ExistingHolders[cHolder.HolderIdentifier]; ok {
 		return nil
 	}
@@ -55,7 +106,7 @@ func (r *DryRunResult) CheckHolder(ctx context.Context, dbConn sqlx.QueryerConte
 	}
 
 	// check if the holder exists
-	holder, ok, err := db.GetHolderByIdentifier(ctx, dbConn, cHolder.HolderIdentifier)
+	holder, ok, err := db.GetHolderByIdentifier(ctx, dbConn, r.HouseholdID, cHolder.HolderIdentifier)
 	if err != nil {
 		return fmt.Errorf("get holder: %w", err)
 	}
@@ -64,6 +115,19 @@ func (r *DryRunResult) CheckHolder(ctx context.Context, dbConn sqlx.QueryerConte
 		return nil
 	}
 
+	// older imports may have created the holder with another identifier
+	for _, identifier := range legacy {
+		holder, ok, err := db.GetHolderByIdentifier(ctx, dbConn, r.HouseholdID, identifier)
+		if err != nil {
+			return fmt.Errorf("get holder by legacy identifier: %w", err)
+		}
+		if ok {
+			r.ExistingHolders[cHolder.HolderIdentifier] = *holder
+			r.Aliases[cHolder.HolderIdentifier] = holder.ID
+			return nil
+		}
+	}
+
 	// if the holder doesn't exist, we need to create it
 	r.HoldersToCreate[cHolder.HolderIdentifier] = cHolder
 	return nil
@@ -71,7 +135,7 @@ func (r *DryRunResult) CheckHolder(ctx context.Context, dbConn sqlx.QueryerConte
 
 func (r *DryRunResult) InsertHolders(ctx context.Context, dbConn sqlx.ExtContext) error {
 	for cIdentifier, cHolder := range r.HoldersToCreate {
-		newHolder, err := db.InsertHolder(ctx, dbConn, cHolder)
+		newHolder, err := db.InsertHolder(ctx, dbConn, r.HouseholdID, cHolder)
 		if _, ok := r.ExistingHolders[cIdentifier]; ok {
 			// this should never happen
 			return fmt.Errorf("holder already exists")
@@ -85,28 +149,87 @@ func (r *DryRunResult) InsertHolders(ctx context.Context, dbConn sqlx.ExtContext
 	return nil
 }
 
+// InsertAliases adds the identifiers of the holders found by their legacy
+// identifier as aliases.
+func (r *DryRunResult) InsertAliases(ctx context.Context, dbConn sqlx.ExtContext) error {
+	for identifier, holderID := range r.Aliases {
+		if err := db.AddHolderAlias(ctx, dbConn, r.HouseholdID, identifier, holderID); err != nil {
+			return fmt.Errorf("add alias of holder %d: %w", holderID, err)
+		}
+	}
+	clear(r.Aliases)
+	return nil
+}
+
+// DryRunOptions configure a dry run.
+type DryRunOptions struct {
+	// OwnerHolderID becomes the parent of the account holders that are
+	// created, e.g. the person owning the accounts.
+	OwnerHolderID *int
+}
+
+// DryRun checks which holders and transactions of the export are new to the
+// household.
 func DryRun(ctx context.Context,
 	dbConn sqlx.QueryerContext,
-	creators []TransactionCreator) (*DryRunResult, error) {
+	householdID int,
+	creators []TransactionCreator,
+	options DryRunOptions) (*DryRunResult, error) {
 	// this is a dry run, so we just print the transactions
 	// and holders that would be created
 
 	result := &DryRunResult{
+		HouseholdID:     householdID,
 		ExistingHolders: make(map[db.HolderIdentifier]db.Holder),
 		HoldersToCreate: make(map[db.HolderIdentifier]db.CreateHolder),
+		Aliases:         make(map[db.HolderIdentifier]int),
 		Transactions:    make([]TransactionToCreate, 0),
 	}
 
+	dbRules, err := db.GetRules(ctx, dbConn, householdID)
+	if err != nil {
+		return nil, fmt.Errorf("get rules: %w", err)
+	}
+	compiledRules, err := rules.CompileEnabled(dbRules)
+	if err != nil {
+		return nil, fmt.Errorf("compile rules: %w", err)
+	}
+
+	if options.OwnerHolderID != nil {
+		_, ok, err := db.GetHolder(ctx, dbConn, householdID, *options.OwnerHolderID)
+		if err != nil {
+			return nil, fmt.Errorf("get owner: %w", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("owner %d doesn't exist", *options.OwnerHolderID)
+		}
+	}
+
 	// first we go over the holders and check which ones already exist
 	for _, creator := range creators {
-		if err := result.CheckHolder(ctx, dbConn, creator.FromHolder()); err != nil {
+		fromHolder := creator.FromHolder()
+		if err := result.CheckHolder(ctx, dbConn, fromHolder, legacyIdentifiers(creator, fromHolder)...); err != nil {
 			return nil, fmt.Errorf("check from holder: %w", err)
 		}
-		if err := result.CheckHolder(ctx, dbConn, creator.ToHolder()); err != nil {
+		toHolder := creator.ToHolder()
+		if err := result.CheckHolder(ctx, dbConn, toHolder, legacyIdentifiers(creator, toHolder)...); err != nil {
 			return nil, fmt.Errorf("check to holder: %w", err)
 		}
 	}
 
+	// new accounts are attached to the owner
+	if options.OwnerHolderID != nil {
+		for _, creator := range creators {
+			identifier := creator.AccountHolder().HolderIdentifier
+			accountHolder, ok := result.HoldersToCreate[identifier]
+			if !ok {
+				continue
+			}
+			accountHolder.ParentHolderID = options.OwnerHolderID
+			result.HoldersToCreate[identifier] = accountHolder
+		}
+	}
+
 	// then we go over the transactions and check which ones already exist
 	for _, creator := range creators {
 		createTransaction := TransactionToCreate{
@@ -114,6 +237,9 @@ func DryRun(ctx context.Context,
 			FromIdentifier: creator.FromHolder().HolderIdentifier,
 			ToIdentifier:   creator.ToHolder().HolderIdentifier,
 		}
+		if err := result.applyRules(compiledRules, &createTransaction); err != nil {
+			return nil, fmt.Errorf("apply rules: %w", err)
+		}
 		// if the from holder doesn't exist, the transaction can't exist
 		fromHolder, ok := result.ExistingHolders[createTransaction.FromIdentifier]
 		if !ok {
@@ -127,7 +253,7 @@ func DryRun(ctx context.Context,
 			continue
 		}
 		// if both holders exist, we need to check if the transaction exists
-		ok, err := db.DoesTransactionExist(ctx, dbConn, db.CreateTransaction{
+		ok, err := db.DoesTransactionExist(ctx, dbConn, householdID, db.CreateTransaction{
 			BaseTransaction: createTransaction.Transaction,
 			FromHolderID:    fromHolder.ID,
 			ToHolderID:      toHolder.ID,
@@ -135,9 +261,25 @@ func DryRun(ctx context.Context,
 		if err != nil {
 			return nil, fmt.Errorf("does transaction exist: %w", err)
 		}
-		if !ok {
+		if ok {
+			result.Duplicates = append(result.Duplicates, createTransaction)
+		} else {
 			result.Transactions = append(result.Transactions, createTransaction)
 		}
 	}
 	return result, nil
 }
+
+// legacyIdentifiers returns the legacy identifier of the holder if the
+// creator knows one.
+func legacyIdentifiers(creator TransactionCreator, holder db.CreateHolder) []db.HolderIdentifier {
+	legacy, ok := creator.(LegacyHolders)
+	if !ok {
+		return nil
+	}
+	identifier, ok := legacy.LegacyIdentifier(holder)
+	if !ok {
+		return nil
+	}
+	return []db.HolderIdentifier{identifier}
+}
@@ -0,0 +1,169 @@
+package normalize
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Intermediary is a payment provider that appears instead of the actual
+// counterparty, e.g. PayPal.
+type Intermediary struct {
+	// Name is a regular expression matching the raw name of the
+	// intermediary. If it has a capture group, the group is used as the
+	// counterparty name when the purpose doesn't reveal it.
+	Name string
+	// Purpose is a regular expression whose first capture group extracts
+	// the actual counterparty from the purpose.
+	Purpose string
+}
+
+// Config configures a Normalizer.
+type Config struct {
+	// Strip are regular expressions that are removed from the name, e.g.
+	// terminal suffixes or store numbers.
+	Strip []string
+	// Intermediaries are unfolded to the actual counterparty.
+	Intermediaries []Intermediary
+}
+
+// DefaultConfig returns a configuration that works for the usual german bank
+// exports.
+func DefaultConfig() Config {
+	return Config{
+		Strip: []string{
+			// card terminal suffixes like "//MUENCHEN/DE"
+			`//.*$`,
+			`(?i)\bVISA Debitkartenumsatz\b`,
+			`(?i)\bsagt danke\b`,
+			// store numbers like "FIL. 1234" or "#1234"
+			`(?i)\b(fil\.?|filiale|markt-?nr\.?)\s*\d+\b`,
+			`#\d+\b`,
+			// transaction ids with digits that are at least 8 characters long
+			`\b[A-Za-z]*\d[A-Za-z0-9-]{7,}\b`,
+			// trailing store numbers
+			`\s\d{2,}$`,
+		},
+		Intermediaries: []Intermediary{
+			{
+				Name:    `(?i)paypal`,
+				Purpose: `(?i)Ihr Einkauf bei\s+([^,]+)`,
+			}, {
+				Name:    `(?i)klarna`,
+				Purpose: `(?i)(?:Ihr Einkauf bei|Bestellung bei|Kauf bei)\s+([^,]+)`,
+			}, {
+				Name: `(?i)^sumup\s*\*\s*(.+)$`,
+			},
+		},
+	}
+}
+
+// ReadConfig reads a JSON configuration file.
+func ReadConfig(path string) (Config, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("read file: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("unmarshal: %w", err)
+	}
+	return config, nil
+}
+
+type intermediary struct {
+	name    *regexp.Regexp
+	purpose *regexp.Regexp
+}
+
+// Normalizer cleans up the names of counterparties, so different spellings
+// of the same counterparty end up as one holder.
+type Normalizer struct {
+	strip          []*regexp.Regexp
+	intermediaries []intermediary
+}
+
+// New compiles the configuration.
+func New(config Config) (*Normalizer, error) {
+	n := &Normalizer{}
+	for _, pattern := range config.Strip {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("compile strip pattern %q: %w", pattern, err)
+		}
+		n.strip = append(n.strip, regex)
+	}
+	for _, config := range config.Intermediaries {
+		var compiled intermediary
+		var err error
+		compiled.name, err = regexp.Compile(config.Name)
+		if err != nil {
+			return nil, fmt.Errorf("compile intermediary name %q: %w", config.Name, err)
+		}
+		if config.Purpose != "" {
+			compiled.purpose, err = regexp.Compile(config.Purpose)
+			if err != nil {
+				return nil, fmt.Errorf("compile intermediary purpose %q: %w", config.Purpose, err)
+			}
+		}
+		n.intermediaries = append(n.intermediaries, compiled)
+	}
+	return n, nil
+}
+
+// Name returns the cleaned up name of the counterparty. The purpose is used
+// to find the actual counterparty behind an intermediary. If nothing is left
+// after cleaning, the trimmed raw name is returned.
+func (n *Normalizer) Name(raw, purpose string) string {
+	name := n.unfold(strings.TrimSpace(raw), purpose)
+	for _, regex := range n.strip {
+		name = regex.ReplaceAllString(name, " ")
+	}
+	name = strings.Join(strings.Fields(name), " ")
+	name = strings.Trim(name, " ,.-/*")
+	if name == "" {
+		return strings.TrimSpace(raw)
+	}
+	return fixCasing(name)
+}
+
+func (n *Normalizer) unfold(name, purpose string) string {
+	for _, intermediary := range n.intermediaries {
+		nameMatch := intermediary.name.FindStringSubmatch(name)
+		if nameMatch == nil {
+			continue
+		}
+		if intermediary.purpose != nil {
+			purposeMatch := intermediary.purpose.FindStringSubmatch(purpose)
+			if len(purposeMatch) > 1 && strings.TrimSpace(purposeMatch[1]) != "" {
+				return strings.TrimSpace(purposeMatch[1])
+			}
+		}
+		if len(nameMatch) > 1 && strings.TrimSpace(nameMatch[1]) != "" {
+			return strings.TrimSpace(nameMatch[1])
+		}
+		return name
+	}
+	return name
+}
+
+// fixCasing converts names written in all caps to title case. Short words
+// are kept, because they are usually abbreviations like "DM" or "AG".
+func fixCasing(name string) string {
+	if strings.IndexFunc(name, unicode.IsLower) >= 0 {
+		return name
+	}
+	words := strings.Split(name, " ")
+	for i, word := range words {
+		if utf8.RuneCountInString(word) <= 3 {
+			continue
+		}
+		first, size := utf8.DecodeRuneInString(word)
+		words[i] = string(unicode.ToUpper(first)) + strings.ToLower(word[size:])
+	}
+	return strings.Join(words, " ")
+}
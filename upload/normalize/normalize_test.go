@@ -0,0 +1,72 @@
+package normalize
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestName(t *testing.T) {
+	normalizer, err := New(DefaultConfig())
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		raw     string
+		purpose string
+		want    string
+	}{
+		{
+			name: "already clean",
+			raw:  "Erika Mustermann",
+			want: "Erika Mustermann",
+		}, {
+			name: "terminal suffix",
+			raw:  "EDEKA SUEDBAYERN//MUENCHEN/DE",
+			want: "Edeka Suedbayern",
+		}, {
+			name: "store number",
+			raw:  "REWE SAGT DANKE 1234",
+			want: "Rewe",
+		}, {
+			name: "card payment",
+			raw:  "VISA Debitkartenumsatz DM FIL.2345",
+			want: "DM",
+		}, {
+			name: "transaction id",
+			raw:  "AMAZON PAYMENTS EUROPE 302-1234567-1234567",
+			want: "Amazon Payments Europe",
+		}, {
+			name:    "paypal",
+			raw:     "PayPal (Europe) S.a.r.l. et Cie., S.C.A.",
+			purpose: "1040012345678 PP.5432.PP . Spotify AB, Ihr Einkauf bei Spotify AB",
+			want:    "Spotify AB",
+		}, {
+			name:    "paypal without merchant",
+			raw:     "PayPal (Europe) S.a.r.l. et Cie., S.C.A.",
+			purpose: "1040012345678 PP.5432.PP",
+			want:    "PayPal (Europe) S.a.r.l. et Cie., S.C.A",
+		}, {
+			name: "sumup",
+			raw:  "SumUp *Cafe am Markt",
+			want: "Cafe am Markt",
+		}, {
+			name: "nothing left",
+			raw:  " 12345678 ",
+			want: "12345678",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, normalizer.Name(tt.raw, tt.purpose))
+		})
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	_, err := New(Config{Strip: []string{"("}})
+	assert.Error(t, err)
+	_, err = New(Config{Intermediaries: []Intermediary{{Name: "x", Purpose: "("}}})
+	assert.Error(t, err)
+}
@@ -0,0 +1,169 @@
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload/normalize"
+	"github.com/jmoiron/sqlx"
+)
+
+var ErrUnknownFormat = errors.New("unknown format")
+
+// Service parses bank exports, previews and imports them. It is used by
+// cmd/upload and the web interface.
+type Service struct {
+	// Parsers maps the name of a format, e.g. "dkb", to its parser.
+	Parsers    map[string]Parser
+	Location   *time.Location
+	Normalizer *normalize.Normalizer
+}
+
+// Preview is what an import of an export would change.
+type Preview struct {
+	*DryRunResult
+	Rejected []RejectedRow
+}
+
+func (p Preview) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.Any("result", p.DryRunResult),
+		slog.Int("rejected", len(p.Rejected)),
+	)
+}
+
+// Formats returns the names of the supported formats, sorted.
+func (s *Service) Formats() []string {
+	formats := make([]string, 0, len(s.Parsers))
+	for format := range s.Parsers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Preview parses the export and dry runs it against the household.
+func (s *Service) Preview(ctx context.Context,
+	dbConn sqlx.QueryerContext,
+	householdID int,
+	format string,
+	data []byte,
+	options DryRunOptions) (*Preview, error) {
+
+	parse, ok := s.Parsers[format]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownFormat, format)
+	}
+	creators, rejected, err := parse(data, s.Location, s.Normalizer)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", format, err)
+	}
+	result, err := DryRun(ctx, dbConn, householdID, creators, options)
+	if err != nil {
+		return nil, fmt.Errorf("dry run: %w", err)
+	}
+	return &Preview{
+		DryRunResult: result,
+		Rejected:     rejected,
+	}, nil
+}
+
+// Summary counts what an import changed.
+type Summary struct {
+	HoldersCreated       int
+	TransactionsInserted int
+	Duplicates           int
+	Rejected             int
+	RuleHits             int
+}
+
+// Summary counts what importing the preview changes.
+func (p Preview) Summary() Summary {
+	return Summary{
+		HoldersCreated:       len(p.HoldersToCreate),
+		TransactionsInserted: len(p.Transactions),
+		Duplicates:           len(p.Duplicates),
+		Rejected:             len(p.Rejected),
+		RuleHits:             p.RuleHitCount(),
+	}
+}
+
+// Import inserts the new holders and transactions of the export into the
+// household in a single database transaction. The export is dry run again
+// inside the transaction while holding the lock of the household, so
+// importing the same file twice, even at once, doesn't create duplicates.
+func (s *Service) Import(ctx context.Context,
+	dbConn *sqlx.DB,
+	householdID int,
+	format string,
+	data []byte,
+	options DryRunOptions) (*Summary, error) {
+
+	tx, err := dbConn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+	// concurrent imports would both miss the transactions of the other
+	if err := db.LockHousehold(ctx, tx, householdID); err != nil {
+		return nil, err
+	}
+
+	preview, err := s.Preview(ctx, tx, householdID, format, data, options)
+	if err != nil {
+		return nil, err
+	}
+	summary := preview.Summary()
+	if err := preview.Insert(ctx, tx); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit: %w", err)
+	}
+	return &summary, nil
+}
+
+// Insert inserts the holders and transactions of the dry run and attaches
+// the tags of the matching rules.
+func (r *DryRunResult) Insert(ctx context.Context, dbConn sqlx.ExtContext) error {
+	if err := r.InsertHolders(ctx, dbConn); err != nil {
+		return fmt.Errorf("insert holders: %w", err)
+	}
+	if err := r.InsertAliases(ctx, dbConn); err != nil {
+		return fmt.Errorf("insert aliases: %w", err)
+	}
+
+	for _, transaction := range r.Transactions {
+		fromHolder, ok := r.ExistingHolders[transaction.FromIdentifier]
+		if !ok {
+			return fmt.Errorf("from holder not found")
+		}
+		toHolder, ok := r.ExistingHolders[transaction.ToIdentifier]
+		if !ok {
+			return fmt.Errorf("to holder not found")
+		}
+
+		create := db.CreateTransaction{
+			BaseTransaction: transaction.Transaction,
+			FromHolderID:    fromHolder.ID,
+			ToHolderID:      toHolder.ID,
+		}
+
+		inserted, err := db.InsertTransaction(ctx, dbConn, r.HouseholdID, create)
+		if err != nil {
+			return fmt.Errorf("insert transaction: %w", err)
+		}
+		for _, hit := range transaction.RuleHits {
+			err = db.AttachTransactionTag(ctx, dbConn, r.HouseholdID, inserted.ID, hit.TagID)
+			if err != nil {
+				return fmt.Errorf("attach tag of rule %d: %w", hit.RuleID, err)
+			}
+		}
+	}
+	return nil
+}
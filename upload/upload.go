@@ -1,11 +1,39 @@
 package upload
 
 import (
+	"time"
+
 	"github.com/Opsi/sparschwein/db"
+	"github.com/Opsi/sparschwein/upload/normalize"
 )
 
 type TransactionCreator interface {
 	Transaction() db.BaseTransaction
 	FromHolder() db.CreateHolder
 	ToHolder() db.CreateHolder
+	// AccountHolder returns the holder of the account the statement belongs
+	// to. It is either the from or the to holder.
+	AccountHolder() db.CreateHolder
+}
+
+// LegacyHolders is implemented by creators whose holders older versions of
+// the importer identified differently. The dry run falls back to the legacy
+// identifier if no holder has the current one.
+type LegacyHolders interface {
+	// LegacyIdentifier returns the identifier older versions gave the
+	// holder. It returns false if the identifier didn't change.
+	LegacyIdentifier(holder db.CreateHolder) (db.HolderIdentifier, bool)
 }
+
+// RejectedRow is a row of an export that can't be imported, e.g. because it
+// isn't booked yet.
+type RejectedRow struct {
+	// Line is the line number in the file, starting at 1.
+	Line   int
+	Fields []string
+	Reason string
+}
+
+// Parser parses the export of a bank. Dates in the export are calendar days
+// in loc.
+type Parser func(data []byte, loc *time.Location, normalizer *normalize.Normalizer) ([]TransactionCreator, []RejectedRow, error)
@@ -4,6 +4,7 @@ import (
 	"log/slog"
 	"os"
 	"strconv"
+	"time"
 )
 
 func LookupStringEnv(key string, fallback string) string {
@@ -26,3 +27,18 @@ func LookupIntEnv(key string, fallback int) int {
 	}
 	return asInt
 }
+
+func LookupDurationEnv(key string, fallback time.Duration) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		slog.Warn("Could not parse environment variable as duration",
+			slog.String("key", key),
+			slog.String("error", err.Error()))
+		return fallback
+	}
+	return duration
+}
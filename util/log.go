@@ -1,6 +1,7 @@
 package util
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log/slog"
@@ -67,3 +68,19 @@ func (c LogConfig) InitSlogDefault() error {
 	slog.SetDefault(slog.New(handler))
 	return nil
 }
+
+type loggerContextKey struct{}
+
+// WithLogger returns a context carrying the logger, e.g. one with the ID of
+// the request being served.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// Logger returns the logger of the context or the default logger.
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerContextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
@@ -0,0 +1,82 @@
+package util
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// FormatCents formats an amount in cents the german way, e.g. "-1.234,56".
+func FormatCents(cents int) string {
+	sign := ""
+	if cents < 0 {
+		sign = "-"
+		cents = -cents
+	}
+	euros := fmt.Sprintf("%d", cents/100)
+
+	// group the euros in blocks of three digits
+	var grouped strings.Builder
+	for i, digit := range euros {
+		if i > 0 && (len(euros)-i)%3 == 0 {
+			grouped.WriteByte('.')
+		}
+		grouped.WriteRune(digit)
+	}
+	return fmt.Sprintf("%s%s,%02d", sign, grouped.String(), cents%100)
+}
+
+// ParseEuros parses amounts like "1000", "-12,5", "1.234,56" or "12.50" into
+// cents. If the amount contains a comma, it is the decimal separator and dots
+// separate thousands. Otherwise a dot is the decimal separator. At most two
+// decimal places are allowed.
+func ParseEuros(amount string) (int, error) {
+	trimmed := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(amount), "€"))
+	euros, cents := trimmed, ""
+	if strings.Contains(trimmed, ",") {
+		euros, cents, _ = strings.Cut(strings.ReplaceAll(trimmed, ".", ""), ",")
+	} else {
+		euros, cents, _ = strings.Cut(trimmed, ".")
+	}
+	sign := 1
+	if rest, ok := strings.CutPrefix(euros, "-"); ok {
+		sign, euros = -1, rest
+	} else {
+		euros = strings.TrimPrefix(euros, "+")
+	}
+	if euros == "" && cents == "" || !isDigits(euros) || !isDigits(cents) {
+		return 0, fmt.Errorf("parse amount %q: not a number", trimmed)
+	}
+	if len(cents) > 2 {
+		return 0, fmt.Errorf("parse amount %q: more than two decimal places", trimmed)
+	}
+
+	total := 0
+	if euros != "" {
+		parsed, err := strconv.Atoi(euros)
+		if err != nil || parsed > math.MaxInt/100-1 {
+			return 0, fmt.Errorf("parse amount %q: too large", trimmed)
+		}
+		total = parsed * 100
+	}
+	if cents != "" {
+		// "12,5" are 50 cents
+		parsed, err := strconv.Atoi((cents + "0")[:2])
+		if err != nil {
+			return 0, fmt.Errorf("parse amount %q: %w", trimmed, err)
+		}
+		total += parsed
+	}
+	return sign * total, nil
+}
+
+// isDigits reports whether s only consists of the digits 0 to 9.
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
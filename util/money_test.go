@@ -0,0 +1,62 @@
+package util_test
+
+import (
+	"testing"
+
+	"github.com/Opsi/sparschwein/util"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormatCents(t *testing.T) {
+	tests := []struct {
+		name  string
+		cents int
+		want  string
+	}{
+		{name: "zero", cents: 0, want: "0,00"},
+		{name: "cents only", cents: 7, want: "0,07"},
+		{name: "negative", cents: -1999, want: "-19,99"},
+		{name: "thousands", cents: 123456, want: "1.234,56"},
+		{name: "millions", cents: -123456789, want: "-1.234.567,89"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, util.FormatCents(tt.cents))
+		})
+	}
+}
+
+func TestParseEuros(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   int
+	}{
+		{amount: "1000", want: 100000},
+		{amount: "12,5", want: 1250},
+		{amount: "-12,34", want: -1234},
+		{amount: "1.234,56 €", want: 123456},
+		{amount: "12.50", want: 1250},
+		{amount: " 0,01 ", want: 1},
+		{amount: "0.29", want: 29},
+		{amount: "1.005,10", want: 100510},
+		{amount: "+3", want: 300},
+		{amount: ",5", want: 50},
+		{amount: "1.000.000,00", want: 100000000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			got, err := util.ParseEuros(tt.amount)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	invalid := []string{"much", "", "-", ",", "NaN", "Inf", "-Infinity", "1e3", "0x10", "1,234", "12.345", "1,2,3", "--1", "99999999999999999999"}
+	for _, amount := range invalid {
+		t.Run(amount, func(t *testing.T) {
+			_, err := util.ParseEuros(amount)
+			assert.Error(t, err)
+		})
+	}
+}